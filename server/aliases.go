@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the GIF aliases curated for each team, like /gif :shipit:
+
+const (
+	commandAlias       = "alias"
+	commandAliasAdd    = "add"
+	commandAliasRemove = "remove"
+	commandAliasList   = "list"
+
+	aliasesKeyPrefix = "aliases_"
+)
+
+var (
+	aliasNameRegexp = regexp.MustCompile(`^:([a-z0-9_+-]+):$`)
+	aliasAddRegexp  = regexp.MustCompile(`^:?([a-zA-Z0-9_+-]+):?\s+(\S+)(?:\s+"(.*)")?$`)
+)
+
+type alias struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Caption   string `json:"caption"`
+	CreatorID string `json:"creatorId"`
+}
+
+// parseAliasName returns the name of the alias if the keywords are an alias like :shipit:
+func parseAliasName(keywords string) (string, bool) {
+	match := aliasNameRegexp.FindStringSubmatch(strings.ToLower(strings.TrimSpace(keywords)))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// executeCommandAlias lists the aliases of the team, or adds or removes one for team administrators
+func (p *Plugin) executeCommandAlias(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	subcommand, parameters, _ := strings.Cut(arguments, " ")
+	parameters = strings.TrimSpace(parameters)
+	switch subcommand {
+	case "", commandAliasList:
+		return p.executeCommandAliasList(args)
+	case commandAliasAdd:
+		return p.executeCommandAliasAdd(parameters, args)
+	case commandAliasRemove:
+		return p.executeCommandAliasRemove(parameters, args)
+	default:
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown alias command, try `/%s %s %s|%s|%s`.", triggerGif, commandAlias, commandAliasAdd, commandAliasRemove, commandAliasList))
+	}
+}
+
+// executeCommandAliasPost posts the GIF of the alias in the channel, or previews it first if preview is true
+func (p *Plugin) executeCommandAliasPost(name, caption, altText string, preview bool, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	aliases, err := p.getAliases(args.TeamId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load the GIF aliases of the team", err)
+	}
+	index := findAlias(aliases, name)
+	if index < 0 {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("There is no GIF alias :%s: in this team, see the available aliases with `/%s %s %s`.", name, triggerGif, commandAlias, commandAliasList))
+	}
+
+	if caption == "" {
+		caption = aliases[index].Caption
+	}
+	return p.postSavedGif(":"+name+":", caption, describeGif(provider.NewGifFromURL(aliases[index].URL), altText), preview, args)
+}
+
+func (p *Plugin) executeCommandAliasList(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	aliases, err := p.getAliases(args.TeamId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load the GIF aliases of the team", err)
+	}
+	if len(aliases) == 0 {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("There is no GIF alias in this team yet, team administrators can add one with `/%s %s %s :name: <GIF URL> \"[caption]\"`.", triggerGif, commandAlias, commandAliasAdd))
+	}
+
+	lines := []string{"GIF aliases of the team, to post with `/" + triggerGif + " :name:`:"}
+	for _, alias := range aliases {
+		line := fmt.Sprintf("- **:%s:**: %s", alias.Name, alias.URL)
+		if alias.Caption != "" {
+			line += " \"" + alias.Caption + "\""
+		}
+		lines = append(lines, line)
+	}
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+func (p *Plugin) executeCommandAliasAdd(parameters string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if !p.canManageAliases(args) {
+		return p.sendEphemeralBotMessage(args, "Only team administrators can manage the GIF aliases.")
+	}
+	match := aliasAddRegexp.FindStringSubmatch(parameters)
+	if match == nil {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Could not read the alias, try `/%s %s %s :name: <GIF URL> \"[caption]\"`.", triggerGif, commandAlias, commandAliasAdd))
+	}
+	gifURL, urlErr := url.ParseRequestURI(match[2])
+	if urlErr != nil || (gifURL.Scheme != "http" && gifURL.Scheme != "https") {
+		return p.sendEphemeralBotMessage(args, "The GIF URL must be a valid HTTP or HTTPS URL.")
+	}
+
+	added := alias{Name: strings.ToLower(match[1]), URL: gifURL.String(), Caption: match[3], CreatorID: args.UserId}
+	err := p.updateAliases(args.TeamId, func(aliases []alias) []alias {
+		if index := findAlias(aliases, added.Name); index >= 0 {
+			aliases[index] = added
+			return aliases
+		}
+		aliases = append(aliases, added)
+		sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+		return aliases
+	})
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to save the GIF alias", err)
+	}
+	return p.sendEphemeralBotMessage(args, fmt.Sprintf("The GIF alias :%s: was saved, post it with `/%s :%s:`.", added.Name, triggerGif, added.Name))
+}
+
+func (p *Plugin) executeCommandAliasRemove(parameters string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if !p.canManageAliases(args) {
+		return p.sendEphemeralBotMessage(args, "Only team administrators can manage the GIF aliases.")
+	}
+	name := strings.ToLower(strings.Trim(parameters, ":"))
+	removed := false
+	err := p.updateAliases(args.TeamId, func(aliases []alias) []alias {
+		index := findAlias(aliases, name)
+		removed = index >= 0
+		if !removed {
+			return aliases
+		}
+		return append(aliases[:index], aliases[index+1:]...)
+	})
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to remove the GIF alias", err)
+	}
+	if !removed {
+		return p.sendEphemeralBotMessage(args, "There is no GIF alias :"+name+": in this team.")
+	}
+	return p.sendEphemeralBotMessage(args, "The GIF alias :"+name+": was removed.")
+}
+
+// canManageAliases returns true if the user of the command is a team or system administrator
+func (p *Plugin) canManageAliases(args *model.CommandArgs) bool {
+	return p.API.HasPermissionToTeam(args.UserId, args.TeamId, model.PermissionManageTeam) ||
+		p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem)
+}
+
+func (p *Plugin) getAliases(teamID string) ([]alias, error) {
+	aliases := []alias{}
+	if err := p.pluginClient.KV.Get(aliasesKeyPrefix+teamID, &aliases); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// updateAliases changes the aliases of the team atomically, as they can be updated from several servers
+func (p *Plugin) updateAliases(teamID string, update func(aliases []alias) []alias) error {
+	return p.pluginClient.KV.SetAtomicWithRetries(aliasesKeyPrefix+teamID, func(oldValue []byte) (interface{}, error) {
+		aliases := []alias{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &aliases); err != nil {
+				return nil, err
+			}
+		}
+		return update(aliases), nil
+	})
+}
+
+// findAlias returns the index of the alias with the name, or -1 if there is none
+func findAlias(aliases []alias, name string) int {
+	for i, alias := range aliases {
+		if alias.Name == name {
+			return i
+		}
+	}
+	return -1
+}
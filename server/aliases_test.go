@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
+	mock_pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi/mock_pluginapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+)
+
+const testTeamID = "gif-team"
+
+var testAlias = alias{Name: "shipit", URL: testGifURL, Caption: "Ship it!"}
+
+func initAliasesTest(t *testing.T, aliases []alias, isTeamAdmin bool) (*plugintest.API, *Plugin, *[]alias, *string) {
+	api, p := initMockAPI()
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+	kv := mock_pluginapi.NewMockKVService(mockCtrl)
+	p.pluginClient = &pluginapi.Client{KV: kv}
+	expectNoSettingsOverrides(kv)
+
+	stored := &aliases
+	kv.EXPECT().Get(aliasesKeyPrefix+testTeamID, gomock.Any()).AnyTimes().DoAndReturn(func(_ string, o interface{}) error {
+		*o.(*[]alias) = append([]alias{}, *stored...)
+		return nil
+	})
+	kv.EXPECT().SetAtomicWithRetries(aliasesKeyPrefix+testTeamID, gomock.Any()).AnyTimes().DoAndReturn(func(_ string, valueFunc func([]byte) (interface{}, error)) error {
+		oldValue, _ := json.Marshal(*stored)
+		newValue, err := valueFunc(oldValue)
+		if err != nil {
+			return err
+		}
+		*stored = newValue.([]alias)
+		return nil
+	})
+
+	api.On("HasPermissionToTeam", testUserID, testTeamID, model.PermissionManageTeam).Return(isTeamAdmin)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+	return api, p, stored, captureEphemeral(api)
+}
+
+func generateAliasCommandArgs(command string) *model.CommandArgs {
+	return &model.CommandArgs{Command: command, UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID}
+}
+
+func TestParseAliasName(t *testing.T) {
+	testCases := []struct {
+		keywords     string
+		expectedName string
+		expectedOK   bool
+	}{
+		{keywords: ":shipit:", expectedName: "shipit", expectedOK: true},
+		{keywords: ":Ship_It+1:", expectedName: "ship_it+1", expectedOK: true},
+		{keywords: "shipit", expectedName: "", expectedOK: false},
+		{keywords: ":ship it:", expectedName: "", expectedOK: false},
+		{keywords: "::", expectedName: "", expectedOK: false},
+	}
+	for _, testCase := range testCases {
+		name, ok := parseAliasName(testCase.keywords)
+		assert.Equal(t, testCase.expectedOK, ok, testCase.keywords)
+		assert.Equal(t, testCase.expectedName, name, testCase.keywords)
+	}
+}
+
+func TestExecuteCommandShouldPostAliasWithoutSearching(t *testing.T) {
+	_, p, _, _ := initAliasesTest(t, []alias{testAlias}, false)
+	p.gifProvider = &mockGifProviderFail{"the provider should not be called"}
+
+	response, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif :shipit:"))
+	assert.Nil(t, err)
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, testGifURL)
+	assert.Contains(t, response.Text, "Ship it!")
+}
+
+func TestExecuteCommandWithPreviewShouldPreviewAliasWithoutSearching(t *testing.T) {
+	_, p, message := initTestPlugin()
+	_, _ = p.pluginClient.KV.Set(aliasesKeyPrefix+testTeamID, []alias{testAlias})
+	p.gifProvider = &mockGifProviderFail{"the provider should not be called"}
+
+	response, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gifs :shipit:"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, *message, testGifURL)
+
+	var sessions []previewState
+	for key, value := range p.pluginClient.KV.(*mockKVStore).values {
+		if strings.HasPrefix(key, previewSessionKeyPrefix) {
+			var session previewState
+			assert.Nil(t, json.Unmarshal(value, &session))
+			sessions = append(sessions, session)
+		}
+	}
+	if assert.Len(t, sessions, 1) {
+		assert.Len(t, sessions[0].Gifs, 1)
+		assert.Equal(t, ":shipit:", sessions[0].Keywords)
+		assert.Equal(t, "Ship it!", sessions[0].Caption)
+		assert.True(t, sessions[0].Saved)
+	}
+}
+
+func TestExecuteCommandShouldPostAliasWithCustomCaption(t *testing.T) {
+	_, p, _, _ := initAliasesTest(t, []alias{testAlias}, false)
+
+	response, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif :shipit: \"Release day\""))
+	assert.Nil(t, err)
+	assert.Contains(t, response.Text, "Release day")
+	assert.NotContains(t, response.Text, "Ship it!")
+}
+
+func TestExecuteCommandShouldNotifyUserOfUnknownAlias(t *testing.T) {
+	_, p, _, message := initAliasesTest(t, []alias{testAlias}, false)
+
+	response, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif :unknown:"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, *message, "no GIF alias :unknown:")
+}
+
+func TestExecuteCommandAliasAddShouldSaveAliasForTeamAdmins(t *testing.T) {
+	_, p, stored, message := initAliasesTest(t, []alias{testAlias}, true)
+
+	_, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif alias add :LGTM: "+testGifURLNext+" \"Looks good\""))
+	assert.Nil(t, err)
+	assert.Equal(t, []alias{{Name: "lgtm", URL: testGifURLNext, Caption: "Looks good", CreatorID: testUserID}, testAlias}, *stored)
+	assert.Contains(t, *message, "saved")
+}
+
+func TestExecuteCommandAliasAddShouldRefuseInvalidURL(t *testing.T) {
+	_, p, stored, message := initAliasesTest(t, []alias{}, true)
+
+	_, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif alias add lgtm javascript:alert(1)"))
+	assert.Nil(t, err)
+	assert.Empty(t, *stored)
+	assert.Contains(t, *message, "valid HTTP")
+}
+
+func TestExecuteCommandAliasShouldRefuseChangesFromOtherUsers(t *testing.T) {
+	for _, command := range []string{"/gif alias add lgtm " + testGifURL, "/gif alias remove shipit"} {
+		_, p, stored, message := initAliasesTest(t, []alias{testAlias}, false)
+
+		_, err := p.ExecuteCommand(nil, generateAliasCommandArgs(command))
+		assert.Nil(t, err, command)
+		assert.Equal(t, []alias{testAlias}, *stored, command)
+		assert.Contains(t, *message, "Only team administrators", command)
+	}
+}
+
+func TestExecuteCommandAliasRemoveShouldRemoveAlias(t *testing.T) {
+	_, p, stored, message := initAliasesTest(t, []alias{testAlias}, true)
+
+	_, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif alias remove :shipit:"))
+	assert.Nil(t, err)
+	assert.Empty(t, *stored)
+	assert.Contains(t, *message, "removed")
+}
+
+func TestExecuteCommandAliasListShouldListAliases(t *testing.T) {
+	_, p, _, message := initAliasesTest(t, []alias{testAlias}, false)
+
+	_, err := p.ExecuteCommand(nil, generateAliasCommandArgs("/gif alias list"))
+	assert.Nil(t, err)
+	assert.Contains(t, *message, ":shipit:")
+	assert.Contains(t, *message, testGifURL)
+}
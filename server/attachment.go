@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"unicode"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to posting the GIFs: as the text of the post, or as a file attached to the post
+// when the attachment display mode is configured
+
+const defaultAttachmentName = "gif"
+
+// respondWithGif posts the GIF in the channel of the command: with the command response, or with a post
+// created by the plugin in the attachment display mode, as a command response can't have files
+func (p *Plugin) respondWithGif(config *pluginConf.Configuration, args *model.CommandArgs, keywords, caption string, gif provider.Gif, attributionMessage string) (*model.CommandResponse, *model.AppError) {
+	entry := auditEntry{Action: auditActionPost, UserID: args.UserId, ChannelID: args.ChannelId, Keywords: keywords, Caption: caption, Provider: gif.Provider, GifID: gif.ID, GifURL: gif.URL}
+	if config.DisplayMode != pluginConf.DisplayModeAttachment {
+		text := generateGifCaption(config.DisplayMode, keywords, caption, p.getProxiedGif(gif, true), attributionMessage, config.IncludeGifDescription)
+		p.recordAuditEntry(entry)
+		p.recordHistory(args.UserId, keywords, caption, gif)
+		return &model.CommandResponse{ResponseType: model.CommandResponseTypeInChannel, Text: text, Attachments: p.generateReportAttachments(gif)}, nil
+	}
+
+	post := &model.Post{
+		UserId:    args.UserId,
+		ChannelId: args.ChannelId,
+		RootId:    args.RootId,
+	}
+	p.setGifPostContent(config, post, keywords, caption, gif, attributionMessage)
+	createdPost, err := p.API.CreatePost(post)
+	if err != nil {
+		return nil, err
+	}
+	entry.PostID = createdPost.Id
+	p.recordAuditEntry(entry)
+	p.recordHistory(args.UserId, keywords, caption, gif)
+	return &model.CommandResponse{}, nil
+}
+
+// setGifPostContent sets the message of the post of the GIF, and attaches the GIF file to the post in the
+// attachment display mode. If the GIF can't be attached, the post contains a link to the GIF instead.
+// The post has a Report button when the reports are enabled.
+func (p *Plugin) setGifPostContent(config *pluginConf.Configuration, post *model.Post, keywords, caption string, gif provider.Gif, attributionMessage string) {
+	displayMode := config.DisplayMode
+	if displayMode == pluginConf.DisplayModeAttachment {
+		fileInfo, err := p.uploadGif(config, post.ChannelId, keywords, gif.URL)
+		if err == nil {
+			post.FileIds = model.StringArray{fileInfo.Id}
+		} else {
+			p.API.LogWarn("Unable to attach the GIF to the post, a link is posted instead", "url", gif.URL, "error", err.Error())
+			displayMode = pluginConf.DisplayModeFullURL
+		}
+	}
+	post.Message = generateGifCaption(displayMode, keywords, caption, p.getProxiedGif(gif, true), attributionMessage, config.IncludeGifDescription)
+	if attachments := p.generateReportAttachments(gif); attachments != nil {
+		post.AddProp("attachments", attachments)
+	}
+}
+
+// uploadGif downloads the GIF, or reads it for a GIF of the local library, and uploads it as a file of the channel.
+// The configuration is the one of the channel, which can have its own maximum size.
+func (p *Plugin) uploadGif(config *pluginConf.Configuration, channelID, keywords, gifURL string) (*model.FileInfo, error) {
+	maxSize := config.AttachmentMaxSizeMB * bytesPerMB
+	var content []byte
+	var contentType string
+	var err error
+	if libraryPath := strings.TrimPrefix(gifURL, p.rootURL+provider.URLLocalLibrary); libraryPath != gifURL {
+		content, contentType, err = readLocalLibraryGif(config.LocalLibraryDirectory, libraryPath, maxSize)
+	} else {
+		content, contentType, err = downloadMedia(gifURL, maxSize, config.GetAllowedPrivateMediaHosts())
+	}
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, appErr := p.API.UploadFile(content, channelID, getAttachmentName(keywords)+allowedMediaContentTypes[contentType])
+	if appErr != nil {
+		return nil, appErr
+	}
+	return fileInfo, nil
+}
+
+// readLocalLibraryGif returns the content and the content type of the GIF of the local library directory, from the
+// escaped path of its URL, if its size is below maxSize. The library route requires a session, so the GIF can't be downloaded.
+func readLocalLibraryGif(directory, escapedName string, maxSize int) ([]byte, string, error) {
+	name, err := url.PathUnescape(escapedName)
+	if err != nil {
+		return nil, "", err
+	}
+	file, info, contentType, err := openLocalLibraryGif(directory, name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	if info.Size() > int64(maxSize) {
+		return nil, "", fmt.Errorf("the media size %d is larger than the maximum size %d", info.Size(), maxSize)
+	}
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, contentType, nil
+}
+
+// getAttachmentName returns a file name without extension made of the letters and digits of the keywords
+func getAttachmentName(keywords string) string {
+	name := strings.Join(strings.FieldsFunc(keywords, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "-")
+	if name == "" {
+		return defaultAttachmentName
+	}
+	return name
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func initAttachmentTest(t *testing.T, status int) (*plugintest.API, *Plugin, string, **model.Post) {
+	allowLocalMedia(t)
+	api, p := initMockAPI()
+	p.configuration.DisplayMode = pluginConf.DisplayModeAttachment
+	p.configuration.AttachmentMaxSizeMB = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(testMediaContent))
+	}))
+	t.Cleanup(server.Close)
+
+	var createdPost *model.Post
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		createdPost = args.Get(0).(*model.Post)
+	}).Return(&model.Post{}, nil)
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return api, p, server.URL + "/kitty.gif", &createdPost
+}
+
+func TestRespondWithGifShouldPostAttachedGif(t *testing.T) {
+	api, p, gifURL, createdPost := initAttachmentTest(t, http.StatusOK)
+	api.On("UploadFile", []byte(testMediaContent), testChannelID, "happy-kitty.gif").Return(&model.FileInfo{Id: "file42"}, nil)
+
+	response, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID, RootId: testRootID}, "happy kitty", "", provider.NewGifFromURL(gifURL), "")
+
+	assert.Nil(t, err)
+	assert.Empty(t, response.Text)
+	assert.NotNil(t, *createdPost)
+	assert.Equal(t, model.StringArray{"file42"}, (*createdPost).FileIds)
+	assert.Equal(t, testUserID, (*createdPost).UserId)
+	assert.Equal(t, testRootID, (*createdPost).RootId)
+	assert.Contains(t, (*createdPost).Message, "happy kitty")
+	assert.NotContains(t, (*createdPost).Message, "![")
+}
+
+func TestRespondWithGifShouldPostLinkWhenDownloadFails(t *testing.T) {
+	api, p, gifURL, createdPost := initAttachmentTest(t, http.StatusNotFound)
+
+	_, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "happy kitty", "", provider.NewGifFromURL(gifURL), "")
+
+	assert.Nil(t, err)
+	assert.Empty(t, (*createdPost).FileIds)
+	assert.Contains(t, (*createdPost).Message, gifURL)
+	api.AssertNotCalled(t, "UploadFile", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRespondWithGifShouldPostLinkWhenGifIsTooLarge(t *testing.T) {
+	_, p, gifURL, createdPost := initAttachmentTest(t, http.StatusOK)
+	p.configuration.AttachmentMaxSizeMB = 0
+
+	_, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "happy kitty", "", provider.NewGifFromURL(gifURL), "")
+
+	assert.Nil(t, err)
+	assert.Empty(t, (*createdPost).FileIds)
+	assert.Contains(t, (*createdPost).Message, gifURL)
+}
+
+func TestRespondWithGifShouldUseMaxSizeOfChannelConfiguration(t *testing.T) {
+	api, p, gifURL, createdPost := initAttachmentTest(t, http.StatusOK)
+	api.On("UploadFile", []byte(testMediaContent), testChannelID, "happy-kitty.gif").Return(&model.FileInfo{Id: "file42"}, nil)
+	p.configuration.AttachmentMaxSizeMB = 0
+	channelConfig := *p.configuration
+	channelConfig.AttachmentMaxSizeMB = 1
+
+	_, err := p.respondWithGif(&channelConfig, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "happy kitty", "", provider.NewGifFromURL(gifURL), "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.StringArray{"file42"}, (*createdPost).FileIds)
+}
+
+func TestHandleSendShouldAttachGif(t *testing.T) {
+	api, p, gifURL, createdPost := initAttachmentTest(t, http.StatusOK)
+	api.On("DeleteEphemeralPost", testUserID, testPostID).Return()
+	api.On("UploadFile", []byte(testMediaContent), testChannelID, "kitty.gif").Return(&model.FileInfo{Id: "file42"}, nil)
+	request := generateTestIntegrationRequest(1)
+	request.Gifs[1] = provider.NewGifFromURL(gifURL)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleSend(p, w, request)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, model.StringArray{"file42"}, (*createdPost).FileIds)
+	assert.Contains(t, (*createdPost).Message, testCaption)
+}
+
+func TestRespondWithGifShouldAttachGifOfLocalLibrary(t *testing.T) {
+	api, p, _, createdPost := initAttachmentTest(t, http.StatusNotFound)
+	p.rootURL = "https://mattermost.example.com/plugins/giphy"
+	p.configuration.LocalLibraryDirectory = t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(p.configuration.LocalLibraryDirectory, "ship it.gif"), []byte(testMediaContent), 0600))
+	api.On("UploadFile", []byte(testMediaContent), testChannelID, "ship-it.gif").Return(&model.FileInfo{Id: "file42"}, nil)
+
+	_, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "ship it", "", provider.NewGifFromURL(p.rootURL+"/library/ship%20it.gif"), "")
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.StringArray{"file42"}, (*createdPost).FileIds)
+}
+
+func TestReadLocalLibraryGifShouldRefuseOtherFiles(t *testing.T) {
+	directory := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "big.gif"), []byte(testMediaContent), 0600))
+
+	for _, name := range []string{"..%2Fsecret.gif", "%2E%2E%2Fsecret.gif", "tags.json", "missing.gif"} {
+		_, _, err := readLocalLibraryGif(directory, name, bytesPerMB)
+		assert.Error(t, err, name)
+	}
+	_, _, err := readLocalLibraryGif(directory, "big.gif", 1)
+	assert.Error(t, err)
+}
+
+func TestGetAttachmentName(t *testing.T) {
+	assert.Equal(t, "happy-kitty", getAttachmentName("happy kitty"))
+	assert.Equal(t, "shipit", getAttachmentName(":shipit:"))
+	assert.Equal(t, "prêt-à-tout", getAttachmentName("prêt à tout!"))
+	assert.Equal(t, defaultAttachmentName, getAttachmentName("../"))
+}
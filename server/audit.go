@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+// Contains what's related to the audit log of the posted GIFs, stored in the KV store for the configured
+// retention, and shown to the system administrators with /gif audit or exported as CSV or JSON
+
+const (
+	commandAudit = "audit"
+
+	URLAudit = "/audit"
+
+	auditKeyPrefix     = "audit_"
+	auditKeyDateFormat = "20060102"
+	auditMaxRetries    = 5
+	auditDefaultDays   = 7
+	auditListMaxSize   = 20
+
+	auditActionPost            = "post"
+	auditActionRejectedRequest = "rejected_request"
+	auditActionReport          = "report"
+	auditActionDeletePost      = "delete_post"
+	auditActionBlockGif        = "block_gif"
+
+	auditFormatCSV  = "csv"
+	auditFormatJSON = "json"
+)
+
+// auditEntry records a GIF posted or reported by a user, the action of an administrator on a report, or a rejected action request
+type auditEntry struct {
+	// Timestamp is in milliseconds since the epoch
+	Timestamp int64  `json:"timestamp"`
+	Action    string `json:"action"`
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id,omitempty"`
+	Keywords  string `json:"keywords,omitempty"`
+	Caption   string `json:"caption,omitempty"`
+	// Provider and GifID identify the posted GIF for the provider that found it, whatever its URL
+	Provider string `json:"provider,omitempty"`
+	GifID    string `json:"gif_id,omitempty"`
+	GifURL   string `json:"gif_url,omitempty"`
+	// PostID is empty when the GIF was posted by the response of a command, as its post is created by the server
+	PostID  string `json:"post_id,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// getAuditKey returns the key of the audit entries of the day of the time: the entries are stored by UTC day
+func getAuditKey(t time.Time) string {
+	return auditKeyPrefix + t.UTC().Format(auditKeyDateFormat)
+}
+
+// recordAuditEntry adds the entry to the audit entries of the current day, unless the audit log is disabled.
+// The entries of a day expire together, once all of them are older than the retention.
+func (p *Plugin) recordAuditEntry(entry auditEntry) {
+	retentionDays := p.getConfiguration().AuditLogRetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+
+	current := now()
+	entry.Timestamp = current.UnixMilli()
+	key := getAuditKey(current)
+	dayStart := current.UTC().Truncate(24 * time.Hour)
+	expiry := dayStart.Add(time.Duration(retentionDays+1) * 24 * time.Hour).Sub(current)
+	for i := 0; i < auditMaxRetries; i++ {
+		var oldValue []byte
+		if err := p.pluginClient.KV.Get(key, &oldValue); err != nil {
+			p.API.LogWarn("Unable to read the audit log", "key", key, "error", err.Error())
+			return
+		}
+		entries := []auditEntry{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &entries); err != nil {
+				p.API.LogWarn("Unable to read the audit log", "key", key, "error", err.Error())
+				return
+			}
+		}
+		newValue, err := json.Marshal(append(entries, entry))
+		if err != nil {
+			p.API.LogWarn("Unable to write the audit log", "key", key, "error", err.Error())
+			return
+		}
+
+		saved, err := p.pluginClient.KV.Set(key, newValue, pluginapi.SetAtomic(oldValue), pluginapi.SetExpiry(expiry))
+		if err != nil {
+			p.API.LogWarn("Unable to write the audit log", "key", key, "error", err.Error())
+			return
+		}
+		if saved {
+			return
+		}
+		// Another entry was recorded in the meantime: try again with the new entries
+	}
+	p.API.LogWarn("Unable to write the audit log after several attempts", "key", key)
+}
+
+// getAuditEntries returns the audit entries recorded during the last days, optionally only those of a user,
+// from the oldest to the most recent
+func (p *Plugin) getAuditEntries(days int, userID string) ([]auditEntry, error) {
+	current := now()
+	since := current.Add(-time.Duration(days) * 24 * time.Hour).UnixMilli()
+	entries := []auditEntry{}
+	for day := days; day >= 0; day-- {
+		var value []byte
+		if err := p.pluginClient.KV.Get(getAuditKey(current.Add(-time.Duration(day)*24*time.Hour)), &value); err != nil {
+			return nil, err
+		}
+		if len(value) == 0 {
+			continue
+		}
+		dayEntries := []auditEntry{}
+		if err := json.Unmarshal(value, &dayEntries); err != nil {
+			return nil, err
+		}
+		for _, entry := range dayEntries {
+			if entry.Timestamp >= since && (userID == "" || entry.UserID == userID) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// executeCommandAudit shows the most recent audit entries to a system administrator, with the links to export them
+func (p *Plugin) executeCommandAudit(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return p.sendEphemeralBotMessage(args, "Only the system administrators can see the audit log.")
+	}
+	retentionDays := p.getConfiguration().AuditLogRetentionDays
+	if retentionDays <= 0 {
+		return p.sendEphemeralBotMessage(args, "The audit log is disabled in the plugin configuration.")
+	}
+
+	days := auditDefaultDays
+	var user *model.User
+	for _, field := range strings.Fields(arguments) {
+		if strings.HasPrefix(field, "@") {
+			var appErr *model.AppError
+			if user, appErr = p.API.GetUserByUsername(strings.TrimPrefix(field, "@")); appErr != nil {
+				return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown user %s.", field))
+			}
+		} else if value, err := strconv.Atoi(field); err == nil && value > 0 {
+			days = value
+		} else {
+			return p.sendEphemeralBotMessage(args, fmt.Sprintf("Could not read the audit query, try `/%s %s [days] [@username]`.", triggerGif, commandAudit))
+		}
+	}
+	if days > retentionDays {
+		days = retentionDays
+	}
+	userID := ""
+	if user != nil {
+		userID = user.Id
+	}
+
+	entries, err := p.getAuditEntries(days, userID)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to read the audit log", err)
+	}
+	lines := []string{fmt.Sprintf("%d GIF audit entries during the last %d days.", len(entries), days)}
+	if len(entries) > auditListMaxSize {
+		lines[0] += fmt.Sprintf(" The %d most recent entries:", auditListMaxSize)
+		entries = entries[len(entries)-auditListMaxSize:]
+	}
+	if len(entries) > 0 {
+		lines = append(lines, "| Time (UTC) | Action | User | Channel | Keywords | Caption | GIF |", "|---|---|---|---|---|---|---|")
+	}
+	names := p.newAuditNameResolver()
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		lines = append(lines, fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s |",
+			time.UnixMilli(entry.Timestamp).UTC().Format(time.DateTime), entry.Action, names.user(entry.UserID), names.channel(entry.ChannelID),
+			escapeAuditTableCell(entry.Keywords), escapeAuditTableCell(entry.Caption), escapeAuditTableCell(entry.GifURL)))
+	}
+
+	query := url.Values{"days": {strconv.Itoa(days)}}
+	if userID != "" {
+		query.Set("user_id", userID)
+	}
+	exportURL := p.rootURL + URLAudit + "?" + query.Encode()
+	lines = append(lines, fmt.Sprintf("Export the entries as [CSV](%s&format=%s) or [JSON](%s&format=%s).", exportURL, auditFormatCSV, exportURL, auditFormatJSON))
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+// auditNameResolver returns the names of the users and channels of the audit entries, or their ID if they can't be found
+type auditNameResolver struct {
+	p        *Plugin
+	users    map[string]string
+	channels map[string]string
+}
+
+func (p *Plugin) newAuditNameResolver() *auditNameResolver {
+	return &auditNameResolver{p: p, users: map[string]string{}, channels: map[string]string{}}
+}
+
+func (r *auditNameResolver) user(userID string) string {
+	if _, ok := r.users[userID]; !ok {
+		r.users[userID] = userID
+		if user, err := r.p.API.GetUser(userID); err == nil {
+			r.users[userID] = "@" + user.Username
+		}
+	}
+	return r.users[userID]
+}
+
+func (r *auditNameResolver) channel(channelID string) string {
+	if channelID == "" {
+		return ""
+	}
+	if _, ok := r.channels[channelID]; !ok {
+		r.channels[channelID] = channelID
+		if channel, err := r.p.API.GetChannel(channelID); err == nil {
+			r.channels[channelID] = "~" + channel.Name
+		}
+	}
+	return r.channels[channelID]
+}
+
+// escapeAuditTableCell prevents the text from breaking the Markdown table
+func escapeAuditTableCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "\n", " ").Replace(text)
+}
+
+// handleAudit exports the audit entries of the last days as CSV or JSON, for the system administrators
+func (p *Plugin) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if !p.API.HasPermissionTo(r.Header.Get("Mattermost-User-Id"), model.PermissionManageSystem) {
+		http.Error(w, "Only system administrators can export the audit log", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	days, err := strconv.Atoi(query.Get("days"))
+	if err != nil || days <= 0 {
+		days = auditDefaultDays
+	}
+	if retentionDays := p.getConfiguration().AuditLogRetentionDays; days > retentionDays {
+		days = retentionDays
+	}
+	entries, err := p.getAuditEntries(days, query.Get("user_id"))
+	if err != nil {
+		p.API.LogWarn("Unable to read the audit log", "error", err.Error())
+		http.Error(w, "Unable to read the audit log", http.StatusInternalServerError)
+		return
+	}
+
+	fileName := "gif-audit-" + now().UTC().Format(auditKeyDateFormat)
+	switch format := query.Get("format"); format {
+	case auditFormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+fileName+".json\"")
+		if err := json.NewEncoder(w).Encode(entries); err != nil {
+			p.API.LogWarn("Could not write the audit log", "error", err.Error())
+		}
+	case auditFormatCSV, "":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+fileName+".csv\"")
+		if err := writeAuditCSV(w, entries); err != nil {
+			p.API.LogWarn("Could not write the audit log", "error", err.Error())
+		}
+	default:
+		http.Error(w, "Unknown export format "+format, http.StatusBadRequest)
+	}
+}
+
+func writeAuditCSV(w http.ResponseWriter, entries []auditEntry) error {
+	writer := csv.NewWriter(w)
+	records := [][]string{{"time", "action", "user_id", "channel_id", "keywords", "caption", "provider", "gif_id", "gif_url", "post_id", "details"}}
+	for _, entry := range entries {
+		record := []string{time.UnixMilli(entry.Timestamp).UTC().Format(time.RFC3339)}
+		// The report reasons, the keywords and the GIF URLs come from the users, every text column is escaped
+		for _, text := range []string{entry.Action, entry.UserID, entry.ChannelID, entry.Keywords, entry.Caption, entry.Provider, entry.GifID, entry.GifURL, entry.PostID, entry.Details} {
+			record = append(record, escapeAuditCSVCell(text))
+		}
+		records = append(records, record)
+	}
+	return writer.WriteAll(records)
+}
+
+// escapeAuditCSVCell prevents the texts typed by the users from being read as formulas by spreadsheet applications
+func escapeAuditCSVCell(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+var testAuditTime = time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func initAuditTest(t *testing.T) (*plugintest.API, *Plugin, *string) {
+	api, p, message := initTestPlugin()
+	p.configuration.AuditLogRetentionDays = 30
+	p.rootURL = "/plugins/giphy"
+	setNow(t, testAuditTime)
+	return api, p, message
+}
+
+func TestRecordAuditEntryShouldStoreEntriesByDay(t *testing.T) {
+	_, p, _ := initAuditTest(t)
+
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, ChannelID: testChannelID, Keywords: "cat"})
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: "other-user", ChannelID: testChannelID, Keywords: "dog"})
+
+	var entries []auditEntry
+	assert.Nil(t, p.pluginClient.KV.Get("audit_20240310", &entries))
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "cat", entries[0].Keywords)
+	assert.Equal(t, testAuditTime.UnixMilli(), entries[0].Timestamp)
+	assert.Equal(t, "dog", entries[1].Keywords)
+}
+
+func TestRespondWithGifShouldAuditTheProviderAndTheIDOfTheGif(t *testing.T) {
+	_, p, _ := initAuditTest(t)
+	// The GIF was found by the fallback provider, not the main provider of the configuration
+	p.configuration.FallbackProviders = "tenor"
+	gif := provider.Gif{ID: "tenor42", Provider: "tenor", URL: "https://media.tenor.com/AAAA/cat.gif"}
+
+	_, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "cat", "", gif, "")
+
+	assert.Nil(t, err)
+	entries, _ := p.getAuditEntries(1, "")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "tenor", entries[0].Provider)
+	assert.Equal(t, "tenor42", entries[0].GifID)
+	assert.Equal(t, gif.URL, entries[0].GifURL)
+}
+
+func TestHandleSendShouldAuditTheProviderAndTheIDOfTheGif(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("DeleteEphemeralPost", testUserID, testPostID).Return()
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: "created-post"}, nil)
+	request := generateTestIntegrationRequest(1)
+	request.Gifs[1] = provider.Gif{ID: "tenor42", Provider: "tenor", URL: "https://media.tenor.com/AAAA/cat.gif"}
+
+	(&defaultHTTPHandler{}).handleSend(p, httptest.NewRecorder(), request)
+
+	entries, _ := p.getAuditEntries(1, "")
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "tenor", entries[0].Provider)
+	assert.Equal(t, "tenor42", entries[0].GifID)
+	assert.Equal(t, "created-post", entries[0].PostID)
+}
+
+func TestRecordAuditEntryShouldDoNothingWhenDisabled(t *testing.T) {
+	_, p, _ := initAuditTest(t)
+	p.configuration.AuditLogRetentionDays = 0
+
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID})
+
+	assert.Empty(t, p.pluginClient.KV.(*mockKVStore).values)
+}
+
+func TestGetAuditEntriesShouldFilterByDaysAndUser(t *testing.T) {
+	_, p, _ := initAuditTest(t)
+	setNow(t, testAuditTime.Add(-5*24*time.Hour))
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, Keywords: "old"})
+	setNow(t, testAuditTime.Add(-time.Hour))
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, Keywords: "recent"})
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: "other-user", Keywords: "other"})
+	setNow(t, testAuditTime)
+
+	entries, err := p.getAuditEntries(7, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"old", "recent", "other"}, getAuditKeywords(entries))
+
+	entries, err = p.getAuditEntries(2, testUserID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"recent"}, getAuditKeywords(entries))
+}
+
+func getAuditKeywords(entries []auditEntry) []string {
+	keywords := []string{}
+	for _, entry := range entries {
+		keywords = append(keywords, entry.Keywords)
+	}
+	return keywords
+}
+
+func TestExecuteCommandAuditShouldBeRefusedToOtherUsers(t *testing.T) {
+	api, p, message := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif audit", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Only the system administrators can see the audit log.", *message)
+}
+
+func TestExecuteCommandAuditShouldListTheEntriesOfTheUser(t *testing.T) {
+	api, p, message := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	api.On("GetUserByUsername", "gifuser").Return(&model.User{Id: testUserID, Username: "gifuser"}, nil)
+	api.On("GetUser", testUserID).Return(&model.User{Id: testUserID, Username: "gifuser"}, nil)
+	api.On("GetChannel", testChannelID).Return(&model.Channel{Id: testChannelID, Name: "town-square"}, nil)
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, ChannelID: testChannelID, Keywords: "cat", Caption: "a|b", GifURL: "https://gifs.test/cat.gif"})
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: "other-user", ChannelID: testChannelID, Keywords: "dog"})
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif audit 3 @gifuser", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.Contains(t, *message, "1 GIF audit entries during the last 3 days.")
+	assert.Contains(t, *message, "| 2024-03-10 12:00:00 | post | @gifuser | ~town-square | cat | a\\|b | https://gifs.test/cat.gif |")
+	assert.NotContains(t, *message, "dog")
+	assert.Contains(t, *message, "[CSV](/plugins/giphy/audit?days=3&user_id=gif-user&format=csv)")
+}
+
+func TestExecuteCommandAuditShouldRefuseInvalidArguments(t *testing.T) {
+	api, p, message := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif audit yesterday", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.Contains(t, *message, "Could not read the audit query")
+}
+
+func TestHandleAuditShouldExportJSON(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, ChannelID: testChannelID, Keywords: "cat", PostID: testPostID})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLAudit+"?days=2&format=json", nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	result := w.Result()
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "attachment; filename=\"gif-audit-20240310.json\"", result.Header.Get("Content-Disposition"))
+	var entries []auditEntry
+	assert.Nil(t, json.NewDecoder(result.Body).Decode(&entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, testPostID, entries[0].PostID)
+}
+
+func TestHandleAuditShouldExportCSV(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: testUserID, ChannelID: testChannelID, Keywords: "=cat", Caption: "hello, world"})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLAudit+"?format=csv", nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, 200, w.Result().StatusCode)
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "keywords", records[0][4])
+	assert.Equal(t, []string{"provider", "gif_id"}, records[0][6:8])
+	assert.Equal(t, []string{"2024-03-10T12:00:00Z", auditActionPost, testUserID, testChannelID, "'=cat", "hello, world"}, records[1][:6])
+}
+
+func TestHandleAuditShouldEscapeTheReportReasonsInCSV(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	p.recordAuditEntry(auditEntry{Action: auditActionReport, UserID: testUserID, GifURL: "@SUM(A1)", PostID: testPostID, Details: "=HYPERLINK(\"https://evil.example.com\")"})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLAudit+"?format=csv", nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, []string{"gif_url", "post_id", "details"}, records[0][8:])
+	assert.Equal(t, []string{"'@SUM(A1)", testPostID, "'=HYPERLINK(\"https://evil.example.com\")"}, records[1][8:])
+}
+
+func TestHandleAuditShouldBeRefusedToOtherUsers(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLAudit, nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, 403, w.Result().StatusCode)
+}
+
+func TestHandleAuditShouldRefuseUnknownFormat(t *testing.T) {
+	api, p, _ := initAuditTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLAudit+"?format=xml", nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, 400, w.Result().StatusCode)
+}
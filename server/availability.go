@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+)
+
+// Contains what's related to the channels and the hours where the GIFs are disabled by the administrators
+
+// checkGifsAllowed returns a message explaining why GIFs can't be posted in the channel right now,
+// or an empty string if they can
+func (p *Plugin) checkGifsAllowed(teamID, channelID string) string {
+	config := p.getChannelConfiguration(teamID, channelID)
+	if !p.isChannelAllowed(config, channelID) {
+		return "GIFs are disabled in this channel."
+	}
+
+	quietHours, err := config.GetQuietHours()
+	if err != nil {
+		p.API.LogWarn("Unable to read the quiet hours", "error", err.Error())
+		return ""
+	}
+	if quietHours != nil && quietHours.Contains(now()) {
+		return fmt.Sprintf("GIFs are disabled during the quiet hours, from %s to %s (%s).", config.QuietHoursStart, config.QuietHoursEnd, quietHours.Location.String())
+	}
+	return ""
+}
+
+// isChannelAllowed returns true if the channel is not excluded by the lists of allowed and blocked channels,
+// which contain channel names or IDs
+func (p *Plugin) isChannelAllowed(config *pluginConf.Configuration, channelID string) bool {
+	allowed, blocked := config.GetAllowedChannels(), config.GetBlockedChannels()
+	if len(allowed) == 0 && len(blocked) == 0 {
+		return true
+	}
+
+	channel, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		p.API.LogWarn("Unable to get the channel to check if GIFs are allowed", "channelId", channelID, "error", appErr.Error())
+		return true
+	}
+	matches := func(list []string) bool {
+		for _, value := range list {
+			if value == strings.ToLower(channel.Id) || value == strings.ToLower(channel.Name) {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(blocked) {
+		return false
+	}
+	return len(allowed) == 0 || matches(allowed)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+// initAvailabilityTest returns a plugin without GIF provider, so that any search fails the test
+func initAvailabilityTest(t *testing.T, current time.Time) (*plugintest.API, *Plugin, *string) {
+	api, p, message := initTestPlugin()
+	api.On("GetChannel", testChannelID).Return(&model.Channel{Id: testChannelID, Name: "incidents"}, nil).Maybe()
+	setNow(t, current)
+	return api, p, message
+}
+
+func executeAvailabilityCommand(t *testing.T, p *Plugin, command string) *model.CommandResponse {
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: command, UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+	assert.Nil(t, err)
+	return response
+}
+
+func TestExecuteCommandShouldRefuseGifsInBlockedChannel(t *testing.T) {
+	_, p, message := initAvailabilityTest(t, time.Now())
+	p.configuration.BlockedChannels = "town-square, Incidents"
+
+	executeAvailabilityCommand(t, p, "/gif kitty")
+	assert.Equal(t, "GIFs are disabled in this channel.", *message)
+
+	*message = ""
+	executeAvailabilityCommand(t, p, "/gif trending")
+	assert.Equal(t, "GIFs are disabled in this channel.", *message)
+
+	*message = ""
+	executeAvailabilityCommand(t, p, "/gif fav kitty")
+	assert.Equal(t, "GIFs are disabled in this channel.", *message)
+}
+
+func TestExecuteCommandShouldRefuseGifsOutsideAllowedChannels(t *testing.T) {
+	_, p, message := initAvailabilityTest(t, time.Now())
+	p.configuration.AllowedChannels = "random,off-topic"
+
+	executeAvailabilityCommand(t, p, "/gifs kitty")
+
+	assert.Equal(t, "GIFs are disabled in this channel.", *message)
+}
+
+func TestExecuteCommandShouldAllowGifsInAllowedChannel(t *testing.T) {
+	_, p, _ := initAvailabilityTest(t, time.Now())
+	p.gifProvider = newMockGifProvider()
+	p.configuration.AllowedChannels = "random," + testChannelID
+	p.configuration.DisablePostingWithoutPreview = false
+
+	response := executeAvailabilityCommand(t, p, "/gif kitty")
+
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+}
+
+func TestExecuteCommandShouldKeepManagementSubcommandsInBlockedChannel(t *testing.T) {
+	_, p, message := initAvailabilityTest(t, time.Now())
+	p.configuration.BlockedChannels = testChannelID
+
+	executeAvailabilityCommand(t, p, "/gif prefs")
+
+	assert.Contains(t, *message, "Your GIF preferences")
+}
+
+func TestExecuteCommandShouldRefuseGifsDuringQuietHours(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	_, p, message := initAvailabilityTest(t, time.Date(2026, 10, 17, 23, 30, 0, 0, paris))
+	p.configuration.QuietHoursStart = "22:00"
+	p.configuration.QuietHoursEnd = "07:00"
+	p.configuration.QuietHoursTimezone = "Europe/Paris"
+
+	executeAvailabilityCommand(t, p, "/gif kitty")
+
+	assert.Equal(t, "GIFs are disabled during the quiet hours, from 22:00 to 07:00 (Europe/Paris).", *message)
+}
+
+func TestExecuteCommandShouldUseTimezoneOfTheTeamForQuietHours(t *testing.T) {
+	paris, _ := time.LoadLocation("Europe/Paris")
+	_, p, _ := initAvailabilityTest(t, time.Date(2026, 10, 17, 23, 30, 0, 0, paris))
+	p.gifProvider = newMockGifProvider()
+	p.configuration.DisablePostingWithoutPreview = false
+	p.configuration.QuietHoursStart = "22:00"
+	p.configuration.QuietHoursEnd = "07:00"
+	p.configuration.QuietHoursTimezone = "Europe/Paris"
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeTeam, testTeamID), settingsOverrides{settingTimezone: "America/New_York"})
+
+	response := executeAvailabilityCommand(t, p, "/gif kitty")
+
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+}
+
+func TestHandleHTTPRequestShouldRefuseActionsWhereGifsAreDisabled(t *testing.T) {
+	api, p, _ := initAvailabilityTest(t, time.Now())
+	api.On("HasPermissionToChannel", testUserID, testChannelID, mock.AnythingOfType("*model.Permission")).Return(true)
+	p.configuration.BlockedChannels = "incidents"
+	setupTestPreviewSession(p)
+	notifications := captureNotifications(t)
+
+	for _, URL := range []string{URLShuffle, URLPrevious, URLSend, URLCancel} {
+		*notifications = nil
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", URL, generatePostActionIntegrationRequestBody())
+		r.Header.Add("Mattermost-User-Id", testUserID)
+
+		p.handleHTTPRequest(w, r)
+
+		assert.Equal(t, 200, w.Result().StatusCode)
+		if URL == URLCancel {
+			assert.Empty(t, *notifications)
+		} else {
+			assert.Equal(t, []string{"GIFs are disabled in this channel."}, *notifications, URL)
+		}
+	}
+}
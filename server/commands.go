@@ -7,6 +7,7 @@ import (
 
 	manifest "github.com/moussetc/mattermost-plugin-giphy"
 	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 
 	"github.com/mattermost/mattermost/server/public/model"
 
@@ -21,6 +22,14 @@ const (
 	triggerGifs = "gifs"
 )
 
+// mediaTypeFlagPrefix starts the option selecting the media type of the search, like --sticker
+const mediaTypeFlagPrefix = "--"
+
+// altTextOption ends the command with the description of the GIF for the screen readers, like --alt "A cat waving"
+const altTextOption = "--alt"
+
+var altTextOptionRegexp = regexp.MustCompile(`\s+` + altTextOption + `\s+"([^"]*)"\s*$`)
+
 func (p *Plugin) RegisterCommands() error {
 	unregisterErr := p.API.UnregisterCommand("", triggerGif)
 	if unregisterErr != nil {
@@ -40,6 +49,7 @@ func (p *Plugin) RegisterCommands() error {
 			AutoComplete:     true,
 			AutoCompleteDesc: "Post a GIF matching your search",
 			AutoCompleteHint: getHintMessage(config.CommandTriggerGif),
+			AutocompleteData: getAutocompleteData(config.CommandTriggerGif, "Post a GIF matching your search"),
 		})
 		if err != nil {
 			return errors.Wrap(err, "Unable to define the following command: "+config.CommandTriggerGif)
@@ -53,6 +63,7 @@ func (p *Plugin) RegisterCommands() error {
 			AutoComplete:     true,
 			AutoCompleteDesc: "Let you preview and shuffle a GIF before posting for real",
 			AutoCompleteHint: getHintMessage(config.CommandTriggerGifWithPreview),
+			AutocompleteData: getAutocompleteData(config.CommandTriggerGifWithPreview, "Let you preview and shuffle a GIF before posting for real"),
 		})
 		if err != nil {
 			return errors.Wrap(err, "Unable to define the following command: "+config.CommandTriggerGifWithPreview)
@@ -74,50 +85,237 @@ func parseCommandLine(commandLine, trigger string) (keywords, caption string, er
 	return strings.Trim(strings.TrimSpace(results["keywords"]), "\""), strings.Trim(strings.TrimSpace(results["caption"]), "\""), nil
 }
 
+// parseSearchCommandLine returns the keywords, caption, description and media type of a search command
+func parseSearchCommandLine(commandLine, trigger string) (keywords, caption, altText string, mediaType provider.MediaType, err error) {
+	commandLine, mediaType, err = parseMediaTypeFlag(commandLine, trigger)
+	if err != nil {
+		return "", "", "", "", err
+	}
+	commandLine, altText = parseAltTextOption(commandLine)
+	keywords, caption, err = parseCommandLine(commandLine, trigger)
+	return keywords, caption, altText, mediaType, err
+}
+
+// parseAltTextOption returns the description typed with the --alt option at the end of the command,
+// and the command line without this option
+func parseAltTextOption(commandLine string) (string, string) {
+	match := altTextOptionRegexp.FindStringSubmatchIndex(commandLine)
+	if match == nil {
+		return commandLine, ""
+	}
+	return commandLine[:match[0]], strings.TrimSpace(commandLine[match[2]:match[3]])
+}
+
+// parseMediaTypeFlag returns the media type selected by an option like --sticker at the start of the command,
+// and the command line without this option
+func parseMediaTypeFlag(commandLine, trigger string) (string, provider.MediaType, error) {
+	arguments := strings.TrimSpace(strings.TrimPrefix(commandLine, "/"+trigger))
+	if !strings.HasPrefix(arguments, mediaTypeFlagPrefix) {
+		return commandLine, provider.MediaTypeGif, nil
+	}
+	flag, rest, _ := strings.Cut(arguments, " ")
+	mediaType := provider.MediaType(strings.TrimPrefix(flag, mediaTypeFlagPrefix))
+	switch mediaType {
+	case provider.MediaTypeGif, provider.MediaTypeSticker, provider.MediaTypeClip:
+		return "/" + trigger + " " + strings.TrimSpace(rest), mediaType, nil
+	default:
+		return "", "", fmt.Errorf("unknown option %s, try one of the following options: %s%s, %s%s", flag, mediaTypeFlagPrefix, provider.MediaTypeSticker, mediaTypeFlagPrefix, provider.MediaTypeClip)
+	}
+}
+
 // executeCommandGif returns a public post containing a matching GIF
-func (p *Plugin) executeCommandGif(keywords, caption string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+func (p *Plugin) executeCommandGif(keywords, caption, altText string, mediaType provider.MediaType, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if message := p.checkBlockedKeywords(keywords, caption, altText, args); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+	if name, isAlias := parseAliasName(keywords); isAlias {
+		return p.executeCommandAliasPost(name, caption, altText, false, args)
+	}
+	return p.postGif(keywords, caption, altText, mediaType, false, args)
+}
+
+// executeCommandGifWithPreview returns an ephemeral post with one GIF that can either be posted, shuffled or canceled
+func (p *Plugin) executeCommandGifWithPreview(keywords, caption, altText string, mediaType provider.MediaType, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if message := p.checkBlockedKeywords(keywords, caption, altText, args); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+	// The GIF of an alias is previewed alone, without searching
+	if name, isAlias := parseAliasName(keywords); isAlias {
+		return p.executeCommandAliasPost(name, caption, altText, true, args)
+	}
+	return p.previewGif(keywords, caption, altText, mediaType, false, args)
+}
+
+// executeCommandTrending posts or previews one of the GIFs currently popular on the provider
+func (p *Plugin) executeCommandTrending(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	arguments, altText := parseAltTextOption(" " + arguments)
+	caption := strings.Trim(strings.TrimSpace(arguments), "\"")
+	if message := p.checkBlockedKeywords("", caption, altText, args); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+	if p.isCommandWithPreview(args) {
+		return p.previewGif(commandTrending, caption, altText, provider.MediaTypeGif, true, args)
+	}
+	return p.postGif(commandTrending, caption, altText, provider.MediaTypeGif, true, args)
+}
+
+// isCommandWithPreview returns true if the command was typed with the trigger of the preview command,
+// or if the preview is required in the channel or by the preferences of the user
+func (p *Plugin) isCommandWithPreview(args *model.CommandArgs) bool {
+	trigger := p.getConfiguration().CommandTriggerGifWithPreview
+	if trigger != "" && (args.Command == "/"+trigger || strings.HasPrefix(args.Command, "/"+trigger+" ")) {
+		return true
+	}
+	return p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId).DisablePostingWithoutPreview
+}
+
+// searchGifs returns a page of media of the given type matching the keywords, or of the trending GIFs,
+// without the GIFs blocked by the administrators
+func (p *Plugin) searchGifs(config *pluginConf.Configuration, keywords string, mediaType provider.MediaType, trending bool, cursor *string) ([]provider.Gif, *model.AppError) {
+	gifProvider := p.getGifProvider(config)
+	var gifs []provider.Gif
+	var err *model.AppError
+	if trending {
+		gifs, err = gifProvider.GetTrendingGifs(cursor)
+	} else {
+		gifs, err = gifProvider.GetGifs(keywords, mediaType, cursor, config.RandomSearch)
+	}
+	if err != nil {
+		return gifs, err
+	}
+	return p.removeBlockedGifs(gifs), nil
+}
+
+// checkMediaTypeAllowed returns a message explaining that the media type can't be searched, or an empty string if it is allowed
+// and supported by the GIF provider
+func (p *Plugin) checkMediaTypeAllowed(config *pluginConf.Configuration, mediaType provider.MediaType) string {
+	if !config.IsMediaTypeAllowed(string(mediaType)) {
+		return "Searching for the media type '" + string(mediaType) + "' is not allowed on this server."
+	}
+	if !provider.SupportsMediaType(p.getGifProvider(config), mediaType) {
+		return "Searching for the media type '" + string(mediaType) + "' is not supported by the GIF provider of this server."
+	}
+	return ""
+}
+
+// getOtherMediaTypes returns the types of media other than GIFs that can be searched: the ones allowed on the server
+// and supported by the GIF provider
+func (p *Plugin) getOtherMediaTypes(config *pluginConf.Configuration) []provider.MediaType {
+	mediaTypes := []provider.MediaType{}
+	for _, mediaType := range []provider.MediaType{provider.MediaTypeSticker, provider.MediaTypeClip} {
+		if p.checkMediaTypeAllowed(config, mediaType) == "" {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	return mediaTypes
+}
+
+func (p *Plugin) postGif(keywords, caption, altText string, mediaType provider.MediaType, trending bool, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	config := p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId)
+	if message := p.checkMediaTypeAllowed(config, mediaType); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+	if message := p.checkChannelRateLimit(args.ChannelId); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+
 	cursor := ""
-	gifURLs, errGif := p.gifProvider.GetGifURL(keywords, &cursor, p.configuration.RandomSearch)
+	gifs, errGif := p.searchGifs(config, keywords, mediaType, trending, &cursor)
 	if errGif != nil {
 		p.API.LogWarn("Error while trying to get GIF URL", "error", errGif.Error())
 		return nil, errGif
 	}
-	if len(gifURLs) < 1 {
+	if len(gifs) < 1 {
 		return p.handleNoGifFound(keywords, args)
 	}
 
-	text := generateGifCaption(p.getConfiguration().DisplayMode, keywords, caption, gifURLs[0], p.gifProvider.GetAttributionMessage())
-	return &model.CommandResponse{ResponseType: model.CommandResponseTypeInChannel, Text: text}, nil
+	response, err := p.respondWithGif(config, args, keywords, caption, describeGif(gifs[0], altText), provider.GetAttributionMessageForGif(p.getGifProvider(config), gifs[0]))
+	if err == nil {
+		p.registerGifShare(config, gifs[0], getShareQuery(keywords, trending))
+	}
+	return response, err
 }
 
-// executeCommandGifWithPreview returns an ephemeral post with one GIF that can either be posted, shuffled or canceled
-func (p *Plugin) executeCommandGifWithPreview(keywords, caption string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+func (p *Plugin) previewGif(keywords, caption, altText string, mediaType provider.MediaType, trending bool, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	config := p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId)
+	if message := p.checkMediaTypeAllowed(config, mediaType); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+
 	cursor := ""
 	// Load a first page of GIFs
-	gifURLs, errGif := p.gifProvider.GetGifURL(keywords, &cursor, p.configuration.RandomSearch)
+	gifs, errGif := p.searchGifs(config, keywords, mediaType, trending, &cursor)
 	if errGif != nil {
 		p.API.LogWarn("Error while trying to get GIF URL", "error", errGif.Error())
 		return nil, errGif
 	}
-	if len(gifURLs) < 1 {
+	if len(gifs) < 1 {
 		return p.handleNoGifFound(keywords, args)
 	}
 
-	post := p.generateGifPost(p.botID, keywords, caption, gifURLs[0], args.ChannelId, args.RootId, p.gifProvider.GetAttributionMessage())
-	// Only embedded display mode works inside an ephemeral post
-	post.Message = generateGifCaption(pluginConf.DisplayModeEmbedded, keywords, caption, gifURLs[0], p.gifProvider.GetAttributionMessage())
-	post.SetProps(map[string]interface{}{
-		"attachments": generatePreviewPostAttachments(keywords, caption, cursor, args.RootId, gifURLs, 0),
-	})
+	return p.sendPreview(config, previewState{
+		UserID:       args.UserId,
+		Keywords:     keywords,
+		Caption:      caption,
+		AltText:      altText,
+		Gifs:         gifs,
+		SearchCursor: cursor,
+		RootID:       args.RootId,
+		MediaType:    string(mediaType),
+		Trending:     trending,
+	}, args)
+}
+
+// postSavedGif posts a GIF that is not searched, like a favorite or the GIF of an alias, the same way as the GIFs
+// of the searches: unless it was blocked by the administrators, and after a preview when preview is true or the preview is required
+func (p *Plugin) postSavedGif(keywords, caption string, gif provider.Gif, preview bool, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if len(p.removeBlockedGifs([]provider.Gif{gif})) == 0 {
+		return p.sendEphemeralBotMessage(args, "This GIF was blocked by the system administrators.")
+	}
+
+	config := p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId)
+	if preview || config.DisablePostingWithoutPreview {
+		return p.sendPreview(config, previewState{
+			UserID:    args.UserId,
+			Keywords:  keywords,
+			Caption:   caption,
+			Gifs:      []provider.Gif{gif},
+			RootID:    args.RootId,
+			MediaType: string(provider.MediaTypeGif),
+			Saved:     true,
+		}, args)
+	}
+	if message := p.checkChannelRateLimit(args.ChannelId); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+	return p.respondWithGif(config, args, keywords, caption, gif, "")
+}
+
+// sendPreview saves the preview session and sends the ephemeral preview post of its GIFs to the user
+func (p *Plugin) sendPreview(config *pluginConf.Configuration, state previewState, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	post := &model.Post{
+		UserId:    p.botID,
+		ChannelId: args.ChannelId,
+		RootId:    args.RootId,
+	}
+	if err := p.createPreviewSession(&state); err != nil {
+		return nil, p.errorGenerator.FromError("Unable to save the GIF preview", err)
+	}
+	p.setPreviewContent(config, post, state)
 	p.API.SendEphemeralPost(args.UserId, post)
 
 	return &model.CommandResponse{}, nil
 }
 
 func (p *Plugin) handleNoGifFound(keywords string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
-	// Create ephemeral post directly rather than with CommandResponse, so the bot can be the author
+	return p.sendEphemeralBotMessage(args, "No GIFs found for '"+keywords+"'")
+}
+
+// sendEphemeralBotMessage informs the user of the command with an ephemeral message.
+// The ephemeral post is created directly rather than with CommandResponse, so the bot can be the author.
+func (p *Plugin) sendEphemeralBotMessage(args *model.CommandArgs, message string) (*model.CommandResponse, *model.AppError) {
 	post := &model.Post{
-		Message:   "No GIFs found for '" + keywords + "'",
+		Message:   message,
 		UserId:    p.botID,
 		ChannelId: args.ChannelId,
 		RootId:    args.RootId,
@@ -132,10 +330,26 @@ func getHintMessage(trigger string) string {
 	return "[happy kitty] or /" + trigger + " \"[happy kitty]\" \"[This is a custom caption]\""
 }
 
-func generateGifCaption(displayMode, keywords, caption, gifURL, attributionMessage string) string {
+// generateGifCaption returns the message of the post of the GIF. The keywords link to the page of the GIF on the
+// website of the provider when it is known, and the description of the GIF is the alternative text of the image.
+// The description is also written in the message when includeDescription is true, as the other display modes
+// have no alternative text.
+func generateGifCaption(displayMode, keywords, caption string, gif provider.Gif, attributionMessage string, includeDescription bool) string {
+	gifURL := gif.URL
 	captionOrKeywords := caption
 	if caption == "" {
-		captionOrKeywords = fmt.Sprintf("**/gif [%s](%s)**", keywords, gifURL)
+		link := gif.PageURL
+		if link == "" {
+			link = gifURL
+		}
+		captionOrKeywords = fmt.Sprintf("**/gif [%s](%s)**", keywords, link)
+	}
+	description := getGifDescription(gif)
+	if description == "" {
+		description = "GIF for '" + keywords + "'"
+	}
+	if includeDescription {
+		captionOrKeywords += " \nGIF description: " + description
 	}
 	formattedAttributionMessage := ""
 	if attributionMessage != "" {
@@ -144,34 +358,58 @@ func generateGifCaption(displayMode, keywords, caption, gifURL, attributionMessa
 	if displayMode == pluginConf.DisplayModeFullURL {
 		return fmt.Sprintf("%s \n%s%s", captionOrKeywords, gifURL, formattedAttributionMessage)
 	}
+	if displayMode == pluginConf.DisplayModeAttachment {
+		// The GIF is displayed by the file attached to the post
+		return fmt.Sprintf("%s \n%s", captionOrKeywords, formattedAttributionMessage)
+	}
 
-	return fmt.Sprintf("%s \n%s![GIF for '%s'](%s)", captionOrKeywords, formattedAttributionMessage, keywords, gifURL)
+	return fmt.Sprintf("%s \n%s%s", captionOrKeywords, formattedAttributionMessage, generateGifImage(gif, description))
 }
 
-func (p *Plugin) generateGifPost(userID, keywords, caption, gifURL, channelID, rootID, attributionMessage string) *model.Post {
-	return &model.Post{
-		Message:   generateGifCaption(p.getConfiguration().DisplayMode, keywords, caption, gifURL, attributionMessage),
-		UserId:    userID,
-		ChannelId: channelID,
-		RootId:    rootID,
+// generateGifImage returns the markdown image of the GIF. The videos, like the clips, can't be displayed by a markdown
+// image, so their still image links to the video instead, or only a link if the still image is unknown.
+func generateGifImage(gif provider.Gif, description string) string {
+	altText := altTextReplacer.Replace(description)
+	if !gif.IsVideo() {
+		return fmt.Sprintf("![%s](%s)", altText, gif.URL)
+	}
+	if gif.StillURL == "" {
+		return fmt.Sprintf("[%s](%s)", altText, gif.URL)
 	}
+	return fmt.Sprintf("[![%s](%s)](%s)", altText, gif.StillURL, gif.URL)
 }
 
-func generatePreviewPostAttachments(keywords, caption, searchCursor, rootID string, gifURLs []string, currentGifIndex int) []*model.SlackAttachment {
-	actionContext := map[string]interface{}{
-		contextRootID:       rootID,
-		contextKeywords:     keywords,
-		contextCaption:      caption,
-		contextAPICursor:    searchCursor,
-		contextGifURLs:      gifURLs,
-		contextCurrentIndex: currentGifIndex,
+// getGifDescription returns the text describing the GIF on a single line: its description, or its title,
+// or an empty string if the GIF isn't described
+func getGifDescription(gif provider.Gif) string {
+	for _, description := range []string{gif.Description, gif.Title} {
+		if description = strings.Join(strings.Fields(description), " "); description != "" {
+			return description
+		}
 	}
+	return ""
+}
+
+// altTextReplacer escapes the characters that would end the alternative text of a markdown image
+var altTextReplacer = strings.NewReplacer("[", "\\[", "]", "\\]")
+
+// describeGif returns the GIF with the description typed by the user instead of the one of the provider, if any
+func describeGif(gif provider.Gif, altText string) provider.Gif {
+	if altText != "" {
+		gif.Description = altText
+	}
+	return gif
+}
+
+func generatePreviewPostAttachments(state previewState, secret []byte) []*model.SlackAttachment {
+	actionContext := state.toContext(secret)
 
 	actions := []*model.PostAction{}
 	actions = append(actions, generateButton("Cancel", URLCancel, "default", actionContext))
-	if currentGifIndex > 0 {
+	if state.CurrentGifIndex > 0 {
 		actions = append(actions, generateButton("Previous", URLPrevious, "default", actionContext))
 	}
+	actions = append(actions, generateButton("Favorite", URLFavorite, "default", actionContext))
 	actions = append(actions, generateButton("Shuffle", URLShuffle, "primary", actionContext))
 	actions = append(actions, generateButton("Send", URLSend, "good", actionContext))
 
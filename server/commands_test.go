@@ -5,6 +5,8 @@ import (
 	"strings"
 	"testing"
 
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/mattermost/mattermost/server/public/model"
@@ -50,7 +52,7 @@ func TestExecuteCommandGifShouldReturnInChannelResponseWhenSearchSucceeds(t *tes
 	_, p := initMockAPI()
 	p.gifProvider = newMockGifProvider()
 
-	response, err := p.executeCommandGif(testKeywords, testCaption, testArgs)
+	response, err := p.executeCommandGif(testKeywords, testCaption, "", provider.MediaTypeGif, testArgs)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, response)
@@ -64,7 +66,7 @@ func TestExecuteCommandGifShouldSendEphemeralPostWhenSearchReturnsNoResult(t *te
 	p.gifProvider = &emptyGifProvider{}
 	api.On("SendEphemeralPost", mock.Anything, mock.Anything).Return(nil)
 
-	response, err := p.executeCommandGif(testKeywords, testCaption, testArgs)
+	response, err := p.executeCommandGif(testKeywords, testCaption, "", provider.MediaTypeGif, testArgs)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, response)
@@ -88,7 +90,7 @@ func TestExecuteCommandGifShouldLogAndFailWhenSearchFails(t *testing.T) {
 	p.gifProvider = &mockGifProviderFail{errorMessage}
 	api.On("LogWarn", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
 
-	response, err := p.executeCommandGif("mayhem", "guy", testArgs)
+	response, err := p.executeCommandGif("mayhem", "guy", "", provider.MediaTypeGif, testArgs)
 	assert.NotNil(t, err)
 	assert.Empty(t, response)
 	assert.Contains(t, err.DetailedError, errorMessage)
@@ -104,7 +106,7 @@ func TestExecuteCommandGifWithPreviewShouldPostAnEphemeralGifPostWhenSearchSucce
 		recordCreationPost = args.Get(1).(*model.Post)
 	})
 
-	response, err := p.executeCommandGifWithPreview(testKeywords, testCaption, testArgs)
+	response, err := p.executeCommandGifWithPreview(testKeywords, testCaption, "", provider.MediaTypeGif, testArgs)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, response)
@@ -121,7 +123,7 @@ func TestExecuteCommandGifWithPreviewShouldReturnEphemeralResponseWhenSearchRetu
 	p.gifProvider = &emptyGifProvider{}
 	api.On("SendEphemeralPost", mock.Anything, mock.Anything).Return(nil)
 
-	response, err := p.executeCommandGifWithPreview(testKeywords, testCaption, testArgs)
+	response, err := p.executeCommandGifWithPreview(testKeywords, testCaption, "", provider.MediaTypeGif, testArgs)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, response)
@@ -142,7 +144,7 @@ func TestExecuteCommandGifWithPreviewShouldLogAndFailWhenSearchFails(t *testing.
 	p.gifProvider = &mockGifProviderFail{"mockError"}
 	api.On("LogWarn", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
 
-	response, err := p.executeCommandGifWithPreview("hello", "", nil)
+	response, err := p.executeCommandGifWithPreview("hello", "", "", provider.MediaTypeGif, &model.CommandArgs{})
 
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "mockError")
@@ -151,8 +153,8 @@ func TestExecuteCommandGifWithPreviewShouldLogAndFailWhenSearchFails(t *testing.
 }
 
 func TestGeneratePreviewPostAttachments(t *testing.T) {
-	gifURLs := []string{testGifURLPrevious, testGifURL}
-	attachments := generatePreviewPostAttachments(testKeywords, testCaption, testCursor, testRootID, gifURLs, 0)
+	gifs := newTestGifs(testGifURLPrevious, testGifURL)
+	attachments := generatePreviewPostAttachments(previewState{SessionID: testSessionID, Keywords: testKeywords, Caption: testCaption, SearchCursor: testCursor, RootID: testRootID, MediaType: string(provider.MediaTypeGif), Gifs: gifs}, testContextSecret)
 
 	assert.NotNil(t, attachments)
 	assert.Len(t, attachments, 1)
@@ -160,18 +162,61 @@ func TestGeneratePreviewPostAttachments(t *testing.T) {
 	assert.NotNil(t, attachment)
 	actions := attachment.Actions
 	assert.NotNil(t, actions)
-	assert.Len(t, actions, 3)
-	for i := 0; i < 3; i++ {
+	assert.Len(t, actions, 4)
+	for i := 0; i < 4; i++ {
 		assert.NotNil(t, actions[i].Integration)
 		context := actions[i].Integration.Context
 		assert.NotNil(t, context)
-		assert.Equal(t, testKeywords, context[contextKeywords])
-		assert.Equal(t, gifURLs, context[contextGifURLs])
-		assert.Equal(t, testCursor, context[contextAPICursor])
-		assert.Equal(t, testRootID, context[contextRootID])
+		assert.Equal(t, testSessionID, context[contextSessionID])
+		assert.Equal(t, 0, context[contextCurrentIndex])
+		assert.Equal(t, signContext(testContextSecret, testSessionID, 0), context[contextSignature])
 	}
 }
 
+func TestGenerateGifCaptionShouldDescribeTheGifAndLinkToItsPage(t *testing.T) {
+	gif := provider.Gif{ID: "42", Title: "Grumpy [cat]", PageURL: "https://giphy.com/gifs/42", URL: testGifURL}
+	caption := generateGifCaption(pluginConf.DisplayModeEmbedded, testKeywords, "", gif, "", false)
+	assert.Equal(t, "**/gif [kitty](https://giphy.com/gifs/42)** \n![Grumpy \\[cat\\]]("+testGifURL+")", caption)
+
+	gif.Description = "A cat\nfrowning"
+	caption = generateGifCaption(pluginConf.DisplayModeEmbedded, testKeywords, "", gif, "", false)
+	assert.Equal(t, "**/gif [kitty](https://giphy.com/gifs/42)** \n![A cat frowning]("+testGifURL+")", caption)
+
+	caption = generateGifCaption(pluginConf.DisplayModeEmbedded, testKeywords, "", provider.NewGifFromURL(testGifURL), "", false)
+	assert.Equal(t, "**/gif [kitty]("+testGifURL+")** \n![GIF for 'kitty']("+testGifURL+")", caption)
+}
+
+func TestGenerateGifCaptionShouldLinkToTheClips(t *testing.T) {
+	clip := provider.Gif{ID: "42", Description: "A cat", URL: "https://media.tenor.com/42/cat.mp4", StillURL: "https://media.tenor.com/42/cat.png"}
+	caption := generateGifCaption(pluginConf.DisplayModeEmbedded, testKeywords, testCaption, clip, "", false)
+	assert.Equal(t, testCaption+" \n[![A cat](https://media.tenor.com/42/cat.png)](https://media.tenor.com/42/cat.mp4)", caption)
+
+	clip.StillURL = ""
+	caption = generateGifCaption(pluginConf.DisplayModeEmbedded, testKeywords, testCaption, clip, "", false)
+	assert.Equal(t, testCaption+" \n[A cat](https://media.tenor.com/42/cat.mp4)", caption)
+}
+
+func TestGenerateGifCaptionShouldIncludeTheDescriptionWhenConfigured(t *testing.T) {
+	gif := provider.Gif{ID: "42", Description: "A cat frowning", URL: testGifURL}
+	for _, displayMode := range []string{pluginConf.DisplayModeEmbedded, pluginConf.DisplayModeFullURL, pluginConf.DisplayModeAttachment} {
+		caption := generateGifCaption(displayMode, testKeywords, testCaption, gif, "", true)
+		assert.True(t, strings.HasPrefix(caption, testCaption+" \nGIF description: A cat frowning \n"), displayMode)
+
+		caption = generateGifCaption(displayMode, testKeywords, testCaption, gif, "", false)
+		assert.NotContains(t, caption, "GIF description", displayMode)
+	}
+}
+
+func TestExecuteCommandGifShouldUseTheDescriptionTypedByTheUser(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("CreatePost", mock.Anything).Return(nil, nil).Maybe()
+	p.gifProvider = newMockGifProvider()
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif kitty \"Hello\" --alt \"A [tiny] cat\"", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Contains(t, response.Text, "![A \\[tiny\\] cat](fakeURL)")
+}
+
 func TestParseCommandeLine(t *testing.T) {
 	testCases := []struct {
 		command          string
@@ -206,3 +251,134 @@ func TestParseCommandeLine(t *testing.T) {
 		assert.Equal(t, testCase.expectedCaption, caption, "Testing: "+testCase.command)
 	}
 }
+
+// trendingGifProvider provides a different GIF for the trending GIFs than for the searches
+type trendingGifProvider struct {
+	mockGifProvider
+	trendingCursor string
+}
+
+func (m *trendingGifProvider) GetTrendingGifs(cursor *string) ([]provider.Gif, *model.AppError) {
+	m.trendingCursor = *cursor
+	*cursor = "next"
+	return newTestGifs("trendingURL"), nil
+}
+
+func TestExecuteCommandTrendingShouldPostTrendingGif(t *testing.T) {
+	_, p := initMockAPI()
+	p.gifProvider = &trendingGifProvider{mockGifProvider: *newMockGifProvider()}
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif trending \"So hot right now\"", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, "trendingURL")
+	assert.Contains(t, response.Text, "So hot right now")
+}
+
+func TestExecuteCommandTrendingShouldPreviewTrendingGifWithPreviewTrigger(t *testing.T) {
+	api, p := initMockAPI()
+	p.gifProvider = &trendingGifProvider{mockGifProvider: *newMockGifProvider()}
+	var previewPost *model.Post
+	api.On("SendEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		previewPost = args.Get(1).(*model.Post)
+	}).Return(nil)
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gifs trending", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.NotNil(t, previewPost)
+	assert.Contains(t, previewPost.Message, "trendingURL")
+	session, loadErr := p.loadPreviewSession(previewPost.Attachments()[0].Actions[0].Integration.Context[contextSessionID].(string))
+	assert.Nil(t, loadErr)
+	assert.True(t, session.Trending)
+	assert.Equal(t, "next", session.SearchCursor)
+}
+
+func TestParseSearchCommandLineShouldReadMediaTypeFlag(t *testing.T) {
+	testCases := []struct {
+		command           string
+		expectedKeywords  string
+		expectedCaption   string
+		expectedAltText   string
+		expectedMediaType provider.MediaType
+		expectedError     bool
+	}{
+		{command: "/gif party", expectedKeywords: "party", expectedMediaType: provider.MediaTypeGif},
+		{command: "/gif --sticker party", expectedKeywords: "party", expectedMediaType: provider.MediaTypeSticker},
+		{command: "/gif --clip \"happy dance\" \"Yay\"", expectedKeywords: "happy dance", expectedCaption: "Yay", expectedMediaType: provider.MediaTypeClip},
+		{command: "/gif --gif party", expectedKeywords: "party", expectedMediaType: provider.MediaTypeGif},
+		{command: "/gif --video party", expectedError: true},
+		{command: "/gif --sticker", expectedError: true},
+		{command: "/gif --sticker party --alt \"A dancing cat\"", expectedKeywords: "party", expectedAltText: "A dancing cat", expectedMediaType: provider.MediaTypeSticker},
+		{command: "/gif \"happy dance\" \"Yay\" --alt \" Two cats dancing \"", expectedKeywords: "happy dance", expectedCaption: "Yay", expectedAltText: "Two cats dancing", expectedMediaType: provider.MediaTypeGif},
+	}
+	for _, testCase := range testCases {
+		keywords, caption, altText, mediaType, err := parseSearchCommandLine(testCase.command, triggerGif)
+		if testCase.expectedError {
+			assert.NotNil(t, err, testCase.command)
+			continue
+		}
+		assert.Nil(t, err, testCase.command)
+		assert.Equal(t, testCase.expectedKeywords, keywords, testCase.command)
+		assert.Equal(t, testCase.expectedCaption, caption, testCase.command)
+		assert.Equal(t, testCase.expectedAltText, altText, testCase.command)
+		assert.Equal(t, testCase.expectedMediaType, mediaType, testCase.command)
+	}
+}
+
+// mediaTypeGifProvider records the media type of the last search
+type mediaTypeGifProvider struct {
+	mockGifProvider
+	lastMediaType provider.MediaType
+}
+
+func (m *mediaTypeGifProvider) SupportsMediaType(_ provider.MediaType) bool {
+	return true
+}
+
+func (m *mediaTypeGifProvider) GetGifs(request string, mediaType provider.MediaType, cursor *string, random bool) ([]provider.Gif, *model.AppError) {
+	m.lastMediaType = mediaType
+	return m.mockGifProvider.GetGifs(request, mediaType, cursor, random)
+}
+
+func TestExecuteCommandShouldSearchAllowedMediaType(t *testing.T) {
+	api, p := initMockAPI()
+	p.configuration.AllowedMediaTypes = "gif,sticker"
+	gifProvider := &mediaTypeGifProvider{mockGifProvider: *newMockGifProvider()}
+	p.gifProvider = gifProvider
+	var previewPost *model.Post
+	api.On("SendEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		previewPost = args.Get(1).(*model.Post)
+	}).Return(nil)
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gifs --sticker party", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Equal(t, provider.MediaTypeSticker, gifProvider.lastMediaType)
+	assert.NotNil(t, previewPost)
+	session, loadErr := p.loadPreviewSession(previewPost.Attachments()[0].Actions[0].Integration.Context[contextSessionID].(string))
+	assert.Nil(t, loadErr)
+	assert.Equal(t, "sticker", session.MediaType)
+}
+
+func TestExecuteCommandShouldRefuseMediaTypeNotAllowed(t *testing.T) {
+	api, p := initMockAPI()
+	p.gifProvider = &mockGifProviderFail{"the provider should not be called"}
+	message := captureEphemeral(api)
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif --clip party", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, *message, "not allowed")
+}
+
+func TestExecuteCommandShouldRefuseMediaTypeNotSupportedByTheProvider(t *testing.T) {
+	api, p := initMockAPI()
+	p.configuration.AllowedMediaTypes = "gif,sticker,clip"
+	p.gifProvider = newMockGifProvider()
+	message := captureEphemeral(api)
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif --sticker party", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Equal(t, "Searching for the media type 'sticker' is not supported by the GIF provider of this server.", *message)
+}
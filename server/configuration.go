@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"time"
 
 	manifest "github.com/moussetc/mattermost-plugin-giphy"
 	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
 	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 
 	"github.com/pkg/errors"
 
 	"github.com/mattermost/mattermost/server/public/model"
-	"github.com/mattermost/mattermost/server/public/pluginapi"
+	mmPluginapi "github.com/mattermost/mattermost/server/public/pluginapi"
 )
 
 // getConfiguration retrieves the active configuration under lock, making it safe to use
@@ -41,6 +43,11 @@ func (p *Plugin) setConfiguration(configuration *pluginConf.Configuration) {
 	p.configuration = configuration
 }
 
+const (
+	suggestionCacheMaxSize = 1000
+	suggestionCacheTTL     = time.Hour
+)
+
 // OnConfigurationChange is invoked when configuration changes may have been made.
 func (p *Plugin) OnConfigurationChange() error {
 	var configuration = new(pluginConf.Configuration)
@@ -59,12 +66,25 @@ func (p *Plugin) OnConfigurationChange() error {
 	}
 	p.rootURL = fmt.Sprintf("%s/plugins/%s", rootURL, manifest.Manifest.Id)
 
-	gifProvider, err := provider.GifProviderGenerator(*configuration, p.errorGenerator, p.rootURL)
+	if configuration.CacheTTLMinutes > 0 {
+		var kv pluginapi.KVService
+		if configuration.CachePersistInKVStore {
+			if p.pluginClient == nil {
+				p.pluginClient = pluginapi.NewClient(p.API, p.Driver)
+			}
+			kv = p.pluginClient.KV
+		}
+		p.gifCache = provider.NewGifCache(configuration.CacheMaxSize, time.Duration(configuration.CacheTTLMinutes)*time.Minute, kv)
+	} else {
+		p.gifCache = nil
+	}
+
+	gifProvider, err := p.newGifProvider(configuration)
 	if err != nil {
 		return err
 	}
-
 	p.gifProvider = gifProvider
+	p.resetOverriddenGifProviders()
 	if configuration.DisablePostingWithoutPreview {
 		// Force preview
 		configuration.CommandTriggerGif = ""
@@ -79,13 +99,26 @@ func (p *Plugin) OnConfigurationChange() error {
 	return p.RegisterCommands()
 }
 
+// newGifProvider returns the GIF provider of the configuration, with the search cache if it is enabled
+func (p *Plugin) newGifProvider(configuration *pluginConf.Configuration) (provider.GifProvider, *model.AppError) {
+	gifProvider, err := provider.GifProviderGenerator(*configuration, p.errorGenerator, p.rootURL, p.newResultFilter(configuration))
+	if err != nil {
+		return nil, err
+	}
+	if p.gifCache != nil {
+		return provider.NewCachedGifProvider(gifProvider, p.gifCache, configuration.GetCacheKeyPrefix()), nil
+	}
+	// The suggestions are requested at each keystroke of the autocompletion, so they are always cached
+	return provider.NewSuggestionCachedGifProvider(gifProvider, provider.NewGifCache(suggestionCacheMaxSize, suggestionCacheTTL, nil), configuration.GetCacheKeyPrefix()), nil
+}
+
 func (p *Plugin) defineBot() error {
 	bot := model.Bot{
 		Username:    "gifcommandsplugin",
 		DisplayName: manifest.Manifest.Name,
 		Description: "Bot for the " + manifest.Manifest.Name + " plugin.",
 	}
-	botID, ensureBotError := p.pluginClient.Bot.EnsureBot(&bot, pluginapi.ProfileImagePath(filepath.Join("assets", "icon.png")))
+	botID, ensureBotError := p.pluginClient.Bot.EnsureBot(&bot, mmPluginapi.ProfileImagePath(filepath.Join("assets", "icon.png")))
 	if ensureBotError != nil {
 		return errors.Wrap(ensureBotError, "failed to ensure GIF bot")
 	}
@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"testing"
+	"time"
 
 	manifest "github.com/moussetc/mattermost-plugin-giphy"
 	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
@@ -71,6 +72,53 @@ func TestOnConfigurationChangeEmptyDisplayMode(t *testing.T) {
 	assert.Contains(t, err.Error(), "the Display Mode must be configured")
 }
 
+func TestOnConfigurationChangeFallbackProviderWithoutAPIKey(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.FallbackProviders = "tenor"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "fallback provider tenor")
+}
+
+func TestOnConfigurationChangeFallbackProviderWithAPIKey(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.FallbackProviders = "tenor"
+	configuration.TenorAPIKey = "tenorAPIKey"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, p.gifProvider)
+}
+
+func TestOnConfigurationChangeWithCache(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.CacheTTLMinutes = 10
+	configuration.CacheMaxSize = 100
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.Nil(t, err)
+	assert.NotNil(t, p.gifCache)
+	assert.Equal(t, 100, p.gifCache.GetStats().MaxSize)
+}
+
+func TestOnConfigurationChangeWithCacheWithoutMaxSize(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.CacheTTLMinutes = 10
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "maximum size")
+}
+
 func TestOnConfigurationChangeGifProviderError(t *testing.T) {
 	api := &plugintest.API{}
 	pluginConfig := generateMockPluginConfig()
@@ -103,3 +151,98 @@ func TestGetSetConfiguration(t *testing.T) {
 	}()
 	p.setConfiguration(modifiedConfig)
 }
+
+func TestOnConfigurationChangeWithUnknownMediaType(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.AllowedMediaTypes = "gif, video"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown media type video")
+}
+
+func TestOnConfigurationChangeWithInvalidGridSize(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.PreviewMode = pluginConf.PreviewModeGrid
+	configuration.PreviewGridSize = 1
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "grid preview")
+}
+
+func TestOnConfigurationChangeWithProxyMediaWithoutMaxSize(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.ProxyMedia = true
+	configuration.ProxyMediaMaxSizeMB = 0
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "maximum size")
+}
+
+func TestOnConfigurationChangeWithAttachmentDisplayWithoutMaxSize(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.DisplayMode = pluginConf.DisplayModeAttachment
+	configuration.AttachmentMaxSizeMB = 0
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "file attachments")
+}
+
+func TestOnConfigurationChangeWithInvalidQuietHours(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.QuietHoursStart = "22h"
+	configuration.QuietHoursEnd = "07:00"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "quiet hours")
+}
+
+func TestOnConfigurationChangeWithUnknownQuietHoursTimezone(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.QuietHoursStart = "22:00"
+	configuration.QuietHoursEnd = "07:00"
+	configuration.QuietHoursTimezone = "Mars/Olympus_Mons"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "time zone")
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	quietHours := &pluginConf.QuietHours{Start: 22 * 60, End: 7 * 60, Location: time.UTC}
+	assert.True(t, quietHours.Contains(time.Date(2026, 10, 17, 22, 0, 0, 0, time.UTC)))
+	assert.True(t, quietHours.Contains(time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)))
+	assert.False(t, quietHours.Contains(time.Date(2026, 10, 17, 7, 0, 0, 0, time.UTC)))
+	assert.False(t, quietHours.Contains(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)))
+
+	quietHours = &pluginConf.QuietHours{Start: 12 * 60, End: 14 * 60, Location: time.UTC}
+	assert.True(t, quietHours.Contains(time.Date(2026, 10, 17, 13, 59, 0, 0, time.UTC)))
+	assert.False(t, quietHours.Contains(time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)))
+}
+
+func TestOnConfigurationChangeWithInvalidBlockedKeyword(t *testing.T) {
+	configuration := generateMockPluginConfig()
+	configuration.BlockedKeywords = "damn\n/kitt(y|en/"
+	p := generateMocksForConfigurationTesting(&configuration)
+
+	err := p.OnConfigurationChange()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid blocked keyword /kitt(y|en/")
+}
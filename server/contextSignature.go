@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// Contains what's related to the signature of the action contexts: each button of a preview carries
+// an HMAC of its context, computed with a secret generated by the plugin, so that crafted requests are rejected.
+// The keywords, caption and GIF URLs are not in the context but in the preview session, so signing
+// the session ID and the GIF index is enough to protect them. The buttons of the reports sign their post and GIF URL.
+
+const (
+	contextSecretKey  = "context_secret"
+	contextSecretSize = 32
+)
+
+var errInvalidContextSignature = errors.New("the signature of the action request context is invalid")
+
+// ensureContextSecret loads the secret used to sign the action contexts, and generates it on the first activation
+func (p *Plugin) ensureContextSecret() error {
+	err := p.pluginClient.KV.SetAtomicWithRetries(contextSecretKey, func(oldValue []byte) (interface{}, error) {
+		// Keep the existing secret, as it may already be used by other servers of the cluster
+		if len(oldValue) > 0 {
+			return oldValue, nil
+		}
+		secret := make([]byte, contextSecretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return secret, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var secret []byte
+	if err := p.pluginClient.KV.Get(contextSecretKey, &secret); err != nil {
+		return err
+	}
+	p.contextSecret = secret
+	return nil
+}
+
+// signContext returns the signature of the values of an action context
+func signContext(secret []byte, sessionID string, currentGifIndex int) string {
+	return signValues(secret, sessionID, strconv.Itoa(currentGifIndex))
+}
+
+// signValues returns the signature of a list of values. Each value is prefixed with its length, as the values
+// like the URLs can contain any separator: ("a:b", "c") and ("a", "b:c") must not have the same signature.
+func signValues(secret []byte, values ...string) string {
+	mac := hmac.New(sha256.New, secret)
+	for _, value := range values {
+		mac.Write([]byte(strconv.Itoa(len(value)) + ":" + value))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifySignature returns errInvalidContextSignature if the values were not signed with the secret
+func verifySignature(secret []byte, signature string, values ...string) error {
+	if !hmac.Equal([]byte(signValues(secret, values...)), []byte(signature)) {
+		return errInvalidContextSignature
+	}
+	return nil
+}
+
+// verifyContextSignature returns errInvalidContextSignature if the context was not signed with the secret
+func verifyContextSignature(secret []byte, context previewContext) error {
+	return verifySignature(secret, context.Signature, context.SessionID, strconv.Itoa(context.CurrentGifIndex))
+}
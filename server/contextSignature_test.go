@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureContextSecretShouldGenerateSecretOnce(t *testing.T) {
+	_, p := initMockAPI()
+	p.contextSecret = nil
+
+	assert.Nil(t, p.ensureContextSecret())
+	secret := p.contextSecret
+	assert.Len(t, secret, contextSecretSize)
+
+	assert.Nil(t, p.ensureContextSecret())
+	assert.Equal(t, secret, p.contextSecret)
+}
+
+func TestVerifyContextSignature(t *testing.T) {
+	context := previewContext{SessionID: testSessionID, CurrentGifIndex: 3, Signature: signContext(testContextSecret, testSessionID, 3)}
+	assert.Nil(t, verifyContextSignature(testContextSecret, context))
+
+	context.CurrentGifIndex = 4
+	assert.Equal(t, errInvalidContextSignature, verifyContextSignature(testContextSecret, context))
+
+	context.CurrentGifIndex = 3
+	context.SessionID = "anotherSession"
+	assert.Equal(t, errInvalidContextSignature, verifyContextSignature(testContextSecret, context))
+
+	context.SessionID = testSessionID
+	context.Signature = ""
+	assert.Equal(t, errInvalidContextSignature, verifyContextSignature(testContextSecret, context))
+}
+
+func TestSignValuesShouldDependOnTheBoundariesOfTheValues(t *testing.T) {
+	signature := signValues(testContextSecret, "post42", "https://gif.fr/gif/42", "42", "giphy")
+
+	assert.Nil(t, verifySignature(testContextSecret, signature, "post42", "https://gif.fr/gif/42", "42", "giphy"))
+	assert.Equal(t, errInvalidContextSignature, verifySignature(testContextSecret, signature, "post42:https", "//gif.fr/gif/42", "42", "giphy"))
+	assert.Equal(t, errInvalidContextSignature, verifySignature(testContextSecret, signature, "post42", "https://gif.fr/gif/42:42", "giphy"))
+	assert.NotEqual(t, signValues(testContextSecret, "a:b", "c"), signValues(testContextSecret, "a", "b:c"))
+	assert.NotEqual(t, signValues(testContextSecret, "", "ab"), signValues(testContextSecret, "ab", ""))
+}
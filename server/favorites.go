@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the GIFs saved as favorites by each user
+
+const (
+	commandFavorite       = "fav"
+	commandFavoriteList   = "list"
+	commandFavoriteRemove = "remove"
+
+	favoritesKeyPrefix = "favorites_"
+	maxFavorites       = 100
+)
+
+type favorite struct {
+	Name     string `json:"name"`
+	Keywords string `json:"keywords"`
+	Caption  string `json:"caption"`
+	URL      string `json:"url"`
+	// Description is the text alternative of the GIF when it was saved
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	errFavoritesFull        = fmt.Errorf("you can't have more than %d favorites, remove some of them with /%s %s %s [name]", maxFavorites, triggerGif, commandFavorite, commandFavoriteRemove)
+	errFavoriteNameReserved = fmt.Errorf("the favorites can't be named '%s' or start with '%s', as these are commands of /%s %s", commandFavoriteList, commandFavoriteRemove, triggerGif, commandFavorite)
+)
+
+// executeCommandFavorite posts a favorite GIF of the user, or lists or removes the favorites
+func (p *Plugin) executeCommandFavorite(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	switch {
+	case arguments == "" || arguments == commandFavoriteList:
+		return p.executeCommandFavoriteList(args)
+	case strings.HasPrefix(arguments, commandFavoriteRemove+" "):
+		return p.executeCommandFavoriteRemove(strings.TrimSpace(strings.TrimPrefix(arguments, commandFavoriteRemove)), args)
+	default:
+		return p.executeCommandFavoritePost(arguments, args)
+	}
+}
+
+func (p *Plugin) executeCommandFavoritePost(name string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	favorites, err := p.getFavorites(args.UserId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load your favorite GIFs", err)
+	}
+	index := findFavorite(favorites, name)
+	if index < 0 {
+		return p.sendEphemeralBotMessage(args, "You have no favorite GIF named '"+name+"', use the Favorite button of a GIF preview to save one.")
+	}
+
+	favorite := favorites[index]
+	return p.postSavedGif(favorite.Keywords, favorite.Caption, describeGif(provider.NewGifFromURL(favorite.URL), favorite.Description), false, args)
+}
+
+func (p *Plugin) executeCommandFavoriteList(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	favorites, err := p.getFavorites(args.UserId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load your favorite GIFs", err)
+	}
+	if len(favorites) == 0 {
+		return p.sendEphemeralBotMessage(args, "You have no favorite GIF yet: use the Favorite button of a GIF preview to save one.")
+	}
+
+	lines := []string{"Your favorite GIFs, to post with `/" + triggerGif + " " + commandFavorite + " [name]`:"}
+	for _, favorite := range favorites {
+		line := fmt.Sprintf("- **%s**: [%s](%s)", favorite.Name, favorite.Keywords, favorite.URL)
+		if favorite.Caption != "" {
+			line += " \"" + favorite.Caption + "\""
+		}
+		lines = append(lines, line)
+	}
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+func (p *Plugin) executeCommandFavoriteRemove(name string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	removed := false
+	err := p.updateFavorites(args.UserId, func(favorites []favorite) ([]favorite, error) {
+		index := findFavorite(favorites, name)
+		removed = index >= 0
+		if !removed {
+			return favorites, nil
+		}
+		return append(favorites[:index], favorites[index+1:]...), nil
+	})
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to remove the favorite GIF", err)
+	}
+	if !removed {
+		return p.sendEphemeralBotMessage(args, "You have no favorite GIF named '"+name+"'.")
+	}
+	return p.sendEphemeralBotMessage(args, "The GIF '"+name+"' was removed from your favorites.")
+}
+
+// Save the GIF of the preview in the favorites of the user, named after the search keywords
+func (h *defaultHTTPHandler) handleFavorite(p *Plugin, w http.ResponseWriter, request *integrationRequest) {
+	if request.CurrentGifIndex < 0 || request.CurrentGifIndex >= len(request.Gifs) {
+		notifyUserOfError(p.API, p.botID, "Unable to save the favorite : index "+strconv.Itoa(request.CurrentGifIndex)+" is out of bounds [0,"+strconv.Itoa(len(request.Gifs))+"]", nil, &request.PostActionIntegrationRequest)
+		writeResponse(http.StatusBadRequest, w)
+		return
+	}
+
+	gif := request.getCurrentGif()
+	saved := favorite{Keywords: request.Keywords, Caption: request.Caption, URL: gif.URL, Description: getGifDescription(gif)}
+	err := p.updateFavorites(request.UserId, func(favorites []favorite) ([]favorite, error) {
+		for _, existing := range favorites {
+			if existing.URL == saved.URL {
+				saved.Name = existing.Name
+				return favorites, nil
+			}
+		}
+		if len(favorites) >= maxFavorites {
+			return nil, errFavoritesFull
+		}
+		saved.Name = generateFavoriteName(favorites, saved.Keywords)
+		if isReservedFavoriteName(saved.Name) {
+			return nil, errFavoriteNameReserved
+		}
+		return append(favorites, saved), nil
+	})
+	if errors.Is(err, errFavoritesFull) || errors.Is(err, errFavoriteNameReserved) {
+		notifyUserOfError(p.API, p.botID, "Unable to save the favorite: "+err.Error(), nil, &request.PostActionIntegrationRequest)
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	if err != nil {
+		notifyUserOfError(p.API, p.botID, "Unable to save the favorite", p.errorGenerator.FromError("Unable to save the favorite", err), &request.PostActionIntegrationRequest)
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+
+	notifyUserOfError(p.API, p.botID, "GIF saved in your favorites, post it again with /"+triggerGif+" "+commandFavorite+" "+saved.Name, nil, &request.PostActionIntegrationRequest)
+	writeResponse(http.StatusOK, w)
+}
+
+func (p *Plugin) getFavorites(userID string) ([]favorite, error) {
+	favorites := []favorite{}
+	if err := p.pluginClient.KV.Get(favoritesKeyPrefix+userID, &favorites); err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
+
+// updateFavorites changes the favorites of the user atomically, as they can be updated from several servers
+func (p *Plugin) updateFavorites(userID string, update func(favorites []favorite) ([]favorite, error)) error {
+	return p.pluginClient.KV.SetAtomicWithRetries(favoritesKeyPrefix+userID, func(oldValue []byte) (interface{}, error) {
+		favorites := []favorite{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &favorites); err != nil {
+				return nil, err
+			}
+		}
+		return update(favorites)
+	})
+}
+
+// findFavorite returns the index of the favorite with the name (ignoring case), or -1 if there is none
+func findFavorite(favorites []favorite, name string) int {
+	for i, favorite := range favorites {
+		if strings.EqualFold(favorite.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isReservedFavoriteName returns true if a favorite with the name couldn't be posted, as /gif fav [name] would run another command
+func isReservedFavoriteName(name string) bool {
+	name = strings.ToLower(name)
+	return name == "" || name == commandFavoriteList || strings.HasPrefix(name, commandFavoriteRemove+" ")
+}
+
+// generateFavoriteName returns the keywords, followed by a number if another favorite already has this name
+func generateFavoriteName(favorites []favorite, keywords string) string {
+	name := keywords
+	for i := 2; findFavorite(favorites, name) >= 0; i++ {
+		name = keywords + " " + strconv.Itoa(i)
+	}
+	return name
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
+	mock_pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi/mock_pluginapi"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+)
+
+// mockFavoritesKVStore stores the favorites of the test user in memory
+func mockFavoritesKVStore(t *testing.T, p *Plugin, favorites []favorite) *[]favorite {
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+	kv := mock_pluginapi.NewMockKVService(mockCtrl)
+	p.pluginClient = &pluginapi.Client{KV: kv}
+	expectNoSettingsOverrides(kv)
+
+	stored := &favorites
+	kv.EXPECT().Get(favoritesKeyPrefix+testUserID, gomock.Any()).AnyTimes().DoAndReturn(func(_ string, o interface{}) error {
+		*o.(*[]favorite) = append([]favorite{}, *stored...)
+		return nil
+	})
+	kv.EXPECT().SetAtomicWithRetries(favoritesKeyPrefix+testUserID, gomock.Any()).AnyTimes().DoAndReturn(func(_ string, valueFunc func([]byte) (interface{}, error)) error {
+		oldValue, _ := json.Marshal(*stored)
+		newValue, err := valueFunc(oldValue)
+		if err != nil {
+			return err
+		}
+		*stored = newValue.([]favorite)
+		return nil
+	})
+	return stored
+}
+
+func initFavoritesTest(t *testing.T, favorites []favorite) (*plugintest.API, *Plugin, *[]favorite, *string) {
+	api, p, message := initTestPlugin()
+	stored := mockFavoritesKVStore(t, p, favorites)
+	return api, p, stored, message
+}
+
+var testFavorite = favorite{Name: testKeywords, Keywords: testKeywords, Caption: testCaption, URL: testGifURL}
+
+func TestExecuteCommandFavoriteShouldPostFavoriteGif(t *testing.T) {
+	_, p, _, _ := initFavoritesTest(t, []favorite{testFavorite})
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gifs fav KITTY", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, testGifURL)
+	assert.Contains(t, response.Text, testCaption)
+}
+
+func TestExecuteCommandFavoriteShouldRefuseBlockedGif(t *testing.T) {
+	_, p, message := initTestPlugin()
+	_, _ = p.pluginClient.KV.Set(favoritesKeyPrefix+testUserID, []favorite{testFavorite})
+	assert.Nil(t, p.blockGif(provider.NewGifFromURL(testGifURL), "admin"))
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav " + testKeywords, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Equal(t, "This GIF was blocked by the system administrators.", *message)
+}
+
+func TestExecuteCommandFavoriteShouldPreviewWhenThePreviewIsRequired(t *testing.T) {
+	_, p, message := initTestPlugin()
+	_, _ = p.pluginClient.KV.Set(favoritesKeyPrefix+testUserID, []favorite{testFavorite})
+	p.configuration.DisablePostingWithoutPreview = true
+	p.gifProvider = newMockGifProvider()
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav " + testKeywords, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, *message, testGifURL)
+}
+
+func TestHandleFavoriteShouldSaveTheDescriptionOfTheGif(t *testing.T) {
+	_, p, stored, _ := initFavoritesTest(t, []favorite{})
+	request := generateTestIntegrationRequest(1)
+	request.AltText = "A cat waving"
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleFavorite(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, "A cat waving", (*stored)[0].Description)
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav " + testKeywords, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Contains(t, response.Text, "![A cat waving]("+testGifURL+")")
+}
+
+func TestExecuteCommandFavoriteShouldNotifyUserOfUnknownFavorite(t *testing.T) {
+	_, p, _, message := initFavoritesTest(t, []favorite{testFavorite})
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav doggo", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, *message, "no favorite GIF named 'doggo'")
+}
+
+func TestExecuteCommandFavoriteShouldListFavorites(t *testing.T) {
+	_, p, _, message := initFavoritesTest(t, []favorite{testFavorite})
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav list", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Contains(t, *message, "**"+testKeywords+"**")
+	assert.Contains(t, *message, testGifURL)
+}
+
+func TestExecuteCommandFavoriteShouldRemoveFavorite(t *testing.T) {
+	_, p, stored, message := initFavoritesTest(t, []favorite{testFavorite})
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif fav remove " + testKeywords, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Empty(t, *stored)
+	assert.Contains(t, *message, "removed")
+}
+
+func TestHandleFavoriteShouldSaveCurrentGifOnce(t *testing.T) {
+	_, p, stored, _ := initFavoritesTest(t, []favorite{{Name: testKeywords, Keywords: testKeywords, URL: testGifURLPrevious}})
+	notifications := captureNotifications(t)
+	h := &defaultHTTPHandler{}
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.handleFavorite(p, w, generateTestIntegrationRequest(1))
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	}
+
+	assert.Len(t, *stored, 2)
+	assert.Equal(t, favorite{Name: testKeywords + " 2", Keywords: testKeywords, Caption: testCaption, URL: testGifURL}, (*stored)[1])
+	for _, notification := range *notifications {
+		assert.True(t, strings.HasSuffix(notification, commandFavorite+" "+testKeywords+" 2"))
+	}
+}
+
+func TestHandleFavoriteShouldRefuseWhenFavoritesAreFull(t *testing.T) {
+	favorites := []favorite{}
+	for i := 0; i < maxFavorites; i++ {
+		favorites = append(favorites, favorite{Name: "gif" + string(rune('a'+i%26)), URL: "url"})
+	}
+	_, p, stored, _ := initFavoritesTest(t, favorites)
+	notifications := captureNotifications(t)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleFavorite(p, w, generateTestIntegrationRequest(1))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Len(t, *stored, maxFavorites)
+	assert.Len(t, *notifications, 1)
+	assert.Contains(t, (*notifications)[0], "more than")
+}
+
+func TestHandleFavoriteShouldRefuseReservedNames(t *testing.T) {
+	for _, keywords := range []string{"list", "Remove kitty"} {
+		_, p, stored, _ := initFavoritesTest(t, []favorite{})
+		notifications := captureNotifications(t)
+		request := generateTestIntegrationRequest(1)
+		request.Keywords = keywords
+
+		w := httptest.NewRecorder()
+		(&defaultHTTPHandler{}).handleFavorite(p, w, request)
+		assert.Equal(t, http.StatusOK, w.Result().StatusCode, keywords)
+		assert.Empty(t, *stored, keywords)
+		assert.Len(t, *notifications, 1, keywords)
+		assert.Contains(t, (*notifications)[0], "can't be named", keywords)
+	}
+}
+
+func TestIsReservedFavoriteName(t *testing.T) {
+	assert.True(t, isReservedFavoriteName("list"))
+	assert.True(t, isReservedFavoriteName("LIST"))
+	assert.True(t, isReservedFavoriteName("remove kitty"))
+	assert.True(t, isReservedFavoriteName(""))
+	assert.False(t, isReservedFavoriteName("remove"))
+	assert.False(t, isReservedFavoriteName("listless cat"))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the GIFs recently posted by each user, to post them again
+
+const (
+	commandHistory = "history"
+
+	historyKeyPrefix = "history_"
+	maxHistory       = 20
+)
+
+// historyEntry is a GIF posted by the user
+type historyEntry struct {
+	Keywords string `json:"keywords"`
+	Caption  string `json:"caption"`
+	URL      string `json:"url"`
+	// Description is the text alternative of the GIF when it was posted
+	Description string `json:"description,omitempty"`
+}
+
+// executeCommandHistory lists the GIFs recently posted by the user, or posts one of them again
+func (p *Plugin) executeCommandHistory(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	history, err := p.getHistory(args.UserId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load the GIFs you posted", err)
+	}
+	if arguments == "" {
+		return p.executeCommandHistoryList(history, args)
+	}
+
+	number, convErr := strconv.Atoi(arguments)
+	if convErr != nil || number < 1 || number > len(history) {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("There is no GIF number %s in your history, see the GIFs you posted with `/%s %s`.", arguments, triggerGif, commandHistory))
+	}
+	entry := history[number-1]
+	return p.postSavedGif(entry.Keywords, entry.Caption, describeGif(provider.NewGifFromURL(entry.URL), entry.Description), false, args)
+}
+
+func (p *Plugin) executeCommandHistoryList(history []historyEntry, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if len(history) == 0 {
+		return p.sendEphemeralBotMessage(args, "You haven't posted any GIF yet.")
+	}
+
+	lines := []string{"The GIFs you posted recently, to post again with `/" + triggerGif + " " + commandHistory + " [number]`:"}
+	for i, entry := range history {
+		line := fmt.Sprintf("%d. [%s](%s)", i+1, entry.Keywords, entry.URL)
+		if entry.Caption != "" {
+			line += " \"" + entry.Caption + "\""
+		}
+		lines = append(lines, line)
+	}
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+// recordHistory adds the GIF at the top of the history of the user, or moves it there if it was already posted.
+// The history is not essential to post a GIF, so the errors are only logged.
+func (p *Plugin) recordHistory(userID, keywords, caption string, gif provider.Gif) {
+	posted := historyEntry{Keywords: keywords, Caption: caption, URL: gif.URL, Description: getGifDescription(gif)}
+	err := p.pluginClient.KV.SetAtomicWithRetries(historyKeyPrefix+userID, func(oldValue []byte) (interface{}, error) {
+		history := []historyEntry{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &history); err != nil {
+				return nil, err
+			}
+		}
+		updated := []historyEntry{posted}
+		for _, entry := range history {
+			if entry.URL != posted.URL && len(updated) < maxHistory {
+				updated = append(updated, entry)
+			}
+		}
+		return updated, nil
+	})
+	if err != nil {
+		p.API.LogWarn("Unable to record the GIF in the history of the user", "userId", userID, "error", err.Error())
+	}
+}
+
+func (p *Plugin) getHistory(userID string) ([]historyEntry, error) {
+	history := []historyEntry{}
+	if err := p.pluginClient.KV.Get(historyKeyPrefix+userID, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func executeHistoryCommand(t *testing.T, p *Plugin, command string) *model.CommandResponse {
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: command, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	return response
+}
+
+func TestExecuteCommandHistoryShouldListThePostedGifs(t *testing.T) {
+	_, p, message := initTestPlugin()
+	p.gifProvider = newMockGifProvider()
+
+	executeHistoryCommand(t, p, "/gif history")
+	assert.Equal(t, "You haven't posted any GIF yet.", *message)
+
+	executeHistoryCommand(t, p, "/gif "+testKeywords+" \""+testCaption+"\"")
+	executeHistoryCommand(t, p, "/gif history")
+	assert.Contains(t, *message, "1. ["+testKeywords+"]("+newMockGifProvider().mockURL+") \""+testCaption+"\"")
+}
+
+func TestExecuteCommandHistoryShouldPostAGifAgain(t *testing.T) {
+	_, p, _ := initTestPlugin()
+	p.gifProvider = &mockGifProviderFail{"the provider should not be called"}
+	_, _ = p.pluginClient.KV.Set(historyKeyPrefix+testUserID, []historyEntry{
+		{Keywords: "dog", URL: testGifURLNext},
+		{Keywords: testKeywords, Caption: testCaption, URL: testGifURL, Description: "A cat waving"},
+	})
+
+	response := executeHistoryCommand(t, p, "/gif history 2")
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, testCaption)
+	assert.Contains(t, response.Text, "![A cat waving]("+testGifURL+")")
+
+	history, err := p.getHistory(testUserID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{testGifURL, testGifURLNext}, []string{history[0].URL, history[1].URL})
+}
+
+func TestExecuteCommandHistoryShouldRefuseUnknownNumber(t *testing.T) {
+	_, p, message := initTestPlugin()
+	_, _ = p.pluginClient.KV.Set(historyKeyPrefix+testUserID, []historyEntry{{Keywords: testKeywords, URL: testGifURL}})
+
+	for _, number := range []string{"0", "2", "first"} {
+		response := executeHistoryCommand(t, p, "/gif history "+number)
+		assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType, number)
+		assert.Contains(t, *message, "There is no GIF number "+number, number)
+	}
+}
+
+func TestHandleSendShouldRecordTheGifInTheHistory(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("DeleteEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: testPostID}, nil)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleSend(p, w, generateTestIntegrationRequest(1))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+
+	history, err := p.getHistory(testUserID)
+	assert.Nil(t, err)
+	assert.Equal(t, []historyEntry{{Keywords: testKeywords, Caption: testCaption, URL: testGifURL}}, history)
+}
+
+func TestRecordHistoryShouldKeepTheLastGifsOnce(t *testing.T) {
+	_, p := initMockAPI()
+	for i := 0; i < maxHistory+5; i++ {
+		p.recordHistory(testUserID, "gif "+strconv.Itoa(i), "", provider.NewGifFromURL("https://test.org/"+strconv.Itoa(i)+".gif"))
+	}
+	p.recordHistory(testUserID, "gif 10", "", provider.NewGifFromURL("https://test.org/10.gif"))
+
+	history, err := p.getHistory(testUserID)
+	assert.Nil(t, err)
+	assert.Len(t, history, maxHistory)
+	assert.Equal(t, "https://test.org/10.gif", history[0].URL)
+	assert.Equal(t, "https://test.org/24.gif", history[1].URL)
+	assert.Equal(t, "https://test.org/5.gif", history[maxHistory-1].URL)
+}
+
+func TestHandleAutocompleteShouldSuggestTheHistoryNumbers(t *testing.T) {
+	_, p := initMockAPI()
+	_, _ = p.pluginClient.KV.Set(historyKeyPrefix+testUserID, []historyEntry{{Keywords: "dog", URL: testGifURLNext}, {Keywords: testKeywords, URL: testGifURL}})
+
+	items := requestAutocomplete(p, "/gif history ", "")
+	assert.Equal(t, []string{"1", "2"}, getAutocompleteItemNames(items))
+	assert.Equal(t, testKeywords, items[1].HelpText)
+}
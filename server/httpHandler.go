@@ -5,9 +5,12 @@ import (
 	"errors"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
-	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
@@ -21,24 +24,30 @@ const (
 	URLCancel   = "/cancel"
 	URLPrevious = "/previous"
 	URLSend     = "/send"
+	URLFavorite = "/favorite"
+
+	URLCacheStats = "/cache/stats"
 )
 
 type integrationRequest struct {
-	Keywords        string   `mapstructure:"keywords"`
-	Caption         string   `mapstructure:"caption"`
-	GifURLs         []string `mapstructure:"gifURLs"`
-	CurrentGifIndex int      `mapstructure:"currentGifIndex"`
-	SearchCursor    string   `mapstructure:"searchCursor"`
-	RootID          string   `mapstructure:"rootID"`
+	previewState
 	model.PostActionIntegrationRequest
 }
 
+// previewContext is the action context of the buttons of a preview
+type previewContext struct {
+	SessionID       string `mapstructure:"sessionId"`
+	CurrentGifIndex int    `mapstructure:"currentGifIndex"`
+	Signature       string `mapstructure:"signature"`
+}
+
 type (
 	pluginHTTPHandler interface {
 		handleCancel(p *Plugin, w http.ResponseWriter, request *integrationRequest)
 		handleShuffle(p *Plugin, w http.ResponseWriter, request *integrationRequest)
 		handlePrevious(p *Plugin, w http.ResponseWriter, request *integrationRequest)
 		handleSend(p *Plugin, w http.ResponseWriter, request *integrationRequest)
+		handleFavorite(p *Plugin, w http.ResponseWriter, request *integrationRequest)
 	}
 	defaultHTTPHandler struct{}
 )
@@ -46,6 +55,10 @@ type (
 var notifyUserOfError = defaultNotifyUserOfError
 
 func (p *Plugin) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		p.handleHTTPGetRequest(w, r)
+		return
+	}
 	if r.Method != "POST" {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
@@ -58,7 +71,17 @@ func (p *Plugin) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	request, err := parseRequest(r)
+	// The reports don't belong to a preview
+	if strings.HasPrefix(r.URL.Path, URLReport) {
+		p.handleReportRequest(w, r, userID)
+		return
+	}
+
+	request, err := parseRequest(r, p.contextSecret)
+	if errors.Is(err, errInvalidContextSignature) {
+		p.rejectTamperedRequest(w, r, userID, err)
+		return
+	}
 	if err != nil {
 		p.API.LogWarn("Could not parse PostActionIntegrationRequest", "error", err.Error())
 		w.WriteHeader(http.StatusBadRequest)
@@ -78,6 +101,33 @@ func (p *Plugin) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	state, err := p.loadPreviewSession(request.SessionID)
+	if errors.Is(err, errPreviewSessionNotFound) {
+		notifyUserOfError(p.API, p.botID, "This GIF preview has expired, please search again.", nil, &request.PostActionIntegrationRequest)
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	if err != nil {
+		p.API.LogWarn("Could not load the preview session", "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if state.UserID != request.UserId {
+		http.Error(w, "The preview belongs to another user", http.StatusForbidden)
+		return
+	}
+	state.CurrentGifIndex = request.CurrentGifIndex
+	request.previewState = state
+
+	// The preview can still be canceled or saved as a favorite, but no GIF can be searched or posted
+	if r.URL.Path != URLCancel && r.URL.Path != URLFavorite {
+		if message := p.checkGifsAllowed(request.TeamId, request.ChannelId); message != "" {
+			notifyUserOfError(p.API, p.botID, message, nil, &request.PostActionIntegrationRequest)
+			writeResponse(http.StatusOK, w)
+			return
+		}
+	}
+
 	switch r.URL.Path {
 	case URLShuffle:
 		p.httpHandler.handleShuffle(p, w, request)
@@ -87,12 +137,89 @@ func (p *Plugin) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
 		p.httpHandler.handleSend(p, w, request)
 	case URLCancel:
 		p.httpHandler.handleCancel(p, w, request)
+	case URLFavorite:
+		p.httpHandler.handleFavorite(p, w, request)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleHTTPGetRequest serves the read-only routes of the plugin
+func (p *Plugin) handleHTTPGetRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Mattermost-User-Id") == "" {
+		http.Error(w, "Authentication failed: user not set in header", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, provider.URLLocalLibrary):
+		p.handleLocalLibraryGif(w, r)
+	case strings.HasPrefix(r.URL.Path, URLMedia):
+		p.handleMedia(w, r)
+	case r.URL.Path == URLCacheStats:
+		p.handleCacheStats(w, r)
+	case r.URL.Path == URLAudit:
+		p.handleAudit(w, r)
+	case r.URL.Path == URLAutocomplete:
+		p.handleAutocomplete(w, r)
 	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Serve a GIF file from the local GIF library directory
+func (p *Plugin) handleLocalLibraryGif(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, provider.URLLocalLibrary)
+	file, info, contentType, err := openLocalLibraryGif(p.getConfiguration().LocalLibraryDirectory, name)
+	if err != nil {
 		http.NotFound(w, r)
+		return
 	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, name, info.ModTime(), file)
 }
 
-func parseRequest(r *http.Request) (*integrationRequest, error) {
+// openLocalLibraryGif opens the GIF file of the local library directory, with its information and its content type.
+// The name must be the name of a GIF file of the directory itself, not a path.
+func openLocalLibraryGif(directory, name string) (*os.File, os.FileInfo, string, error) {
+	contentType := provider.LocalLibraryExtensions[strings.ToLower(filepath.Ext(name))]
+	if directory == "" || name == "" || name != filepath.Base(name) || contentType == "" {
+		return nil, nil, "", os.ErrNotExist
+	}
+
+	file, err := os.Open(filepath.Join(directory, name))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil, "", os.ErrNotExist
+	}
+	return file, info, contentType, nil
+}
+
+// Return the hit and miss counters of the search cache, only to system administrators
+func (p *Plugin) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if !p.API.HasPermissionTo(r.Header.Get("Mattermost-User-Id"), model.PermissionManageSystem) {
+		http.Error(w, "Only system administrators can see the cache statistics", http.StatusForbidden)
+		return
+	}
+
+	stats := provider.GifCacheStats{}
+	if p.gifCache != nil {
+		stats = p.gifCache.GetStats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		p.API.LogWarn("Could not write the cache statistics", "error", err.Error())
+	}
+}
+
+// parseRequest reads the action request, and checks that its context was signed by the plugin
+func parseRequest(r *http.Request, secret []byte) (*integrationRequest, error) {
 	// Read data added by default for a button action
 	body, readErr := io.ReadAll(r.Body)
 	if readErr != nil {
@@ -104,16 +231,27 @@ func parseRequest(r *http.Request) (*integrationRequest, error) {
 		return nil, jsonErr
 	}
 
-	context := integrationRequest{}
-	context.PostActionIntegrationRequest = request
-	err := mapstructure.Decode(request.Context, &context)
-	if context.Keywords == "" {
-		return nil, errors.New("missing " + contextKeywords + " from action request context")
+	var context previewContext
+	if err := mapstructure.Decode(request.Context, &context); err != nil {
+		return nil, err
 	}
-	if len(context.GifURLs) == 0 {
-		return nil, errors.New("missing " + contextGifURLs + " from action request context")
+	if context.SessionID == "" {
+		return nil, errors.New("missing " + contextSessionID + " from action request context")
 	}
-	return &context, err
+	if err := verifyContextSignature(secret, context); err != nil {
+		return nil, err
+	}
+	integration := integrationRequest{PostActionIntegrationRequest: request}
+	integration.SessionID = context.SessionID
+	integration.CurrentGifIndex = context.CurrentGifIndex
+	return &integration, nil
+}
+
+// rejectTamperedRequest refuses an action request whose context was not signed by the plugin, and records it for the administrators
+func (p *Plugin) rejectTamperedRequest(w http.ResponseWriter, r *http.Request, userID string, err error) {
+	p.API.LogError("Audit: rejected a tampered action request", "userId", userID, "url", r.URL.Path, "error", err.Error())
+	p.recordAuditEntry(auditEntry{Action: auditActionRejectedRequest, UserID: userID, Details: r.URL.Path + ": " + err.Error()})
+	http.Error(w, "The action request was not issued by the plugin: "+err.Error(), http.StatusForbidden)
 }
 
 func writeResponse(httpStatus int, w http.ResponseWriter) {
@@ -132,107 +270,143 @@ func writeResponse(httpStatus int, w http.ResponseWriter) {
 // Delete the ephemeral preview post
 func (h *defaultHTTPHandler) handleCancel(p *Plugin, w http.ResponseWriter, request *integrationRequest) {
 	p.API.DeleteEphemeralPost(request.UserId, request.PostId)
+	p.deletePreviewSession(request.SessionID)
 	writeResponse(http.StatusOK, w)
 }
 
-// Replace the GIF in the ephemeral shuffle post by a new one
+// Replace the GIF (or the page of GIFs of the grid) in the ephemeral shuffle post by a new one
 func (h *defaultHTTPHandler) handleShuffle(p *Plugin, w http.ResponseWriter, request *integrationRequest) {
-	if request.CurrentGifIndex+1 < len(request.GifURLs) {
-		h.sendPreviewPost(p, w, request, request.GifURLs, request.CurrentGifIndex+1)
+	if nextIndex := request.CurrentGifIndex + p.getPreviewPageSize(); nextIndex < len(request.Gifs) {
+		h.sendPreviewPost(p, w, request, request.Gifs, nextIndex)
 		return
 	}
 
-	random := p.configuration.RandomSearch
+	// The trending GIFs can only be browsed page by page
+	config := p.getUserConfiguration(request.UserId, request.TeamId, request.ChannelId)
+	random := config.RandomSearch && !request.Trending && !request.Saved
 	if !random && request.SearchCursor == "" {
 		notifyUserOfError(p.API, p.botID, "No more GIFs found for '"+request.Keywords+"'", nil, &request.PostActionIntegrationRequest)
 		return
 	}
 
-	newGifURLs, err := p.gifProvider.GetGifURL(request.Keywords, &request.SearchCursor, random)
+	if message := p.checkUserRateLimit(request.UserId); message != "" {
+		notifyUserOfError(p.API, p.botID, message, nil, &request.PostActionIntegrationRequest)
+		return
+	}
+
+	newGifs, err := p.searchGifs(config, request.Keywords, provider.MediaType(request.MediaType), request.Trending, &request.SearchCursor)
 	if err != nil {
 		notifyUserOfError(p.API, p.botID, "Unable to fetch a new Gif for shuffling", err, &request.PostActionIntegrationRequest)
 		writeResponse(http.StatusServiceUnavailable, w)
 		return
 	}
 
-	if len(newGifURLs) < 1 {
+	if len(newGifs) < 1 {
 		notifyUserOfError(p.API, p.botID, "No GIFs found for '"+request.Keywords+"'", nil, &request.PostActionIntegrationRequest)
 		return
 	}
 
-	currentIndex := len(request.GifURLs)
-	// only add URLs that were not already seen (as we make successive API calls, the same URL can popup twice)
-	for _, newURL := range newGifURLs {
-		alreadyExist := false
-		for _, usedURL := range request.GifURLs {
-			if newURL == usedURL {
-				alreadyExist = true
-				break
-			}
+	currentIndex := len(request.Gifs)
+	// only add GIFs that were not already seen (as we make successive API calls, the same GIF can popup twice,
+	// possibly with another URL). The GIFs are compared by provider and ID, as two providers can use the same IDs.
+	seenGifs := map[string]bool{}
+	for _, usedGif := range request.Gifs {
+		seenGifs[provider.GetGifKey(usedGif)] = true
+	}
+	for _, newGif := range newGifs {
+		if key := provider.GetGifKey(newGif); !seenGifs[key] {
+			seenGifs[key] = true
+			request.Gifs = append(request.Gifs, newGif)
 		}
-		if !alreadyExist {
-			request.GifURLs = append(request.GifURLs, newURL)
+	}
+	if len(request.Gifs) == currentIndex {
+		// Keep the new cursor, so that the next shuffle continues with the following results
+		if err := p.savePreviewSession(request.previewState); err != nil {
+			p.API.LogWarn("Unable to save the GIF preview", "error", err.Error())
 		}
+		notifyUserOfError(p.API, p.botID, "No new GIFs found for '"+request.Keywords+"'", nil, &request.PostActionIntegrationRequest)
+		return
 	}
 
-	h.sendPreviewPost(p, w, request, request.GifURLs, currentIndex)
+	h.sendPreviewPost(p, w, request, request.Gifs, currentIndex)
 }
 
-// Replace the GIF in the ephemeral shuffle post by one that was already shuffled
+// Replace the GIF (or the page of GIFs of the grid) in the ephemeral shuffle post by one that was already shuffled
 func (h *defaultHTTPHandler) handlePrevious(p *Plugin, w http.ResponseWriter, request *integrationRequest) {
-	previousIndex := request.CurrentGifIndex - 1
-	if previousIndex < 0 {
+	if request.CurrentGifIndex <= 0 {
 		notifyUserOfError(p.API, p.botID, "There is no previous URL", nil, &request.PostActionIntegrationRequest)
 		writeResponse(http.StatusBadRequest, w)
 		return
 	}
+	previousIndex := request.CurrentGifIndex - p.getPreviewPageSize()
+	if previousIndex < 0 {
+		previousIndex = 0
+	}
 
-	h.sendPreviewPost(p, w, request, request.GifURLs, previousIndex)
+	h.sendPreviewPost(p, w, request, request.Gifs, previousIndex)
 }
 
 // Create and send an ephemeral for a gif preview message
-func (h *defaultHTTPHandler) sendPreviewPost(p *Plugin, w http.ResponseWriter, request *integrationRequest, gifURLs []string, currentGifIndex int) {
+func (h *defaultHTTPHandler) sendPreviewPost(p *Plugin, w http.ResponseWriter, request *integrationRequest, gifs []provider.Gif, currentGifIndex int) {
 	time := model.GetMillis()
 	post := &model.Post{
 		Id:        request.PostId,
 		ChannelId: request.ChannelId,
 		UserId:    p.botID,
 		RootId:    request.RootID,
-		// Only embedded display mode works inside an ephemeral post
-		Message:  generateGifCaption(pluginConf.DisplayModeEmbedded, request.Keywords, request.Caption, gifURLs[currentGifIndex], p.gifProvider.GetAttributionMessage()),
-		CreateAt: time,
-		UpdateAt: time,
+		CreateAt:  time,
+		UpdateAt:  time,
 	}
-	post.SetProps(map[string]interface{}{
-		"attachments": generatePreviewPostAttachments(request.Keywords, request.Caption, request.SearchCursor, request.RootID, gifURLs, currentGifIndex),
-	})
+	state := request.previewState
+	state.Gifs = gifs
+	state.CurrentGifIndex = currentGifIndex
+	// The new GIFs and cursor of a shuffle must be kept for the next actions
+	if err := p.savePreviewSession(state); err != nil {
+		notifyUserOfError(p.API, p.botID, "Unable to save the GIF preview", p.errorGenerator.FromError("Unable to save the GIF preview", err), &request.PostActionIntegrationRequest)
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+	p.setPreviewContent(p.getUserConfiguration(request.UserId, request.TeamId, request.ChannelId), post, state)
 	p.API.UpdateEphemeralPost(request.UserId, post)
 	writeResponse(http.StatusOK, w)
 }
 
 // Post the actual GIF and delete the obsolete ephemeral post
 func (h *defaultHTTPHandler) handleSend(p *Plugin, w http.ResponseWriter, request *integrationRequest) {
+	// Keep the preview if the GIF can't be posted yet, so it can be sent later
+	if message := p.checkChannelRateLimit(request.ChannelId); message != "" {
+		notifyUserOfError(p.API, p.botID, message, nil, &request.PostActionIntegrationRequest)
+		return
+	}
+
 	p.API.DeleteEphemeralPost(request.UserId, request.PostId)
-	if request.CurrentGifIndex < 0 || request.CurrentGifIndex >= len(request.GifURLs) {
-		notifyUserOfError(p.API, p.botID, "Unable to create post : index "+strconv.Itoa(request.CurrentGifIndex)+"is out of bounds [0,"+strconv.Itoa(len(request.GifURLs))+"]", nil, &request.PostActionIntegrationRequest)
+	p.deletePreviewSession(request.SessionID)
+	if request.CurrentGifIndex < 0 || request.CurrentGifIndex >= len(request.Gifs) {
+		notifyUserOfError(p.API, p.botID, "Unable to create post : index "+strconv.Itoa(request.CurrentGifIndex)+"is out of bounds [0,"+strconv.Itoa(len(request.Gifs))+"]", nil, &request.PostActionIntegrationRequest)
 		writeResponse(http.StatusInternalServerError, w)
 		return
 	}
 	time := model.GetMillis()
 	post := &model.Post{
-		Message:   generateGifCaption(p.getConfiguration().DisplayMode, request.Keywords, request.Caption, request.GifURLs[request.CurrentGifIndex], ""),
 		UserId:    request.UserId,
 		ChannelId: request.ChannelId,
 		RootId:    request.RootID,
 		CreateAt:  time,
 		UpdateAt:  time,
 	}
-	_, err := p.API.CreatePost(post)
+	config := p.getUserConfiguration(request.UserId, request.TeamId, request.ChannelId)
+	gif := request.getCurrentGif()
+	p.setGifPostContent(config, post, request.Keywords, request.Caption, gif, "")
+	createdPost, err := p.API.CreatePost(post)
 	if err != nil {
 		notifyUserOfError(p.API, p.botID, "Unable to create post : ", err, &request.PostActionIntegrationRequest)
 		writeResponse(http.StatusInternalServerError, w)
 		return
 	}
+	p.recordAuditEntry(auditEntry{Action: auditActionPost, UserID: request.UserId, ChannelID: request.ChannelId, Keywords: request.Keywords,
+		Caption: request.Caption, Provider: gif.Provider, GifID: gif.ID, GifURL: gif.URL, PostID: createdPost.Id})
+	p.recordHistory(request.UserId, request.Keywords, request.Caption, gif)
+	p.registerGifShare(config, gif, getShareQuery(request.Keywords, request.Trending))
 
 	writeResponse(http.StatusOK, w)
 }
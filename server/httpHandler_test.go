@@ -7,9 +7,14 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
 
 	"github.com/stretchr/testify/assert"
@@ -31,19 +36,19 @@ const (
 	testGifURLNext     = "https://gif.fr/gif/43"
 	testCursor         = "43abc"
 	testRootID         = "4242abc"
+	testSessionID      = "sessionabc42"
 )
 
+var testContextSecret = []byte("gif-secret")
+
 var testPostActionIntegrationRequest = model.PostActionIntegrationRequest{
 	ChannelId: testChannelID,
 	UserId:    testUserID,
 	PostId:    testPostID,
 	Context: map[string]interface{}{
-		contextGifURLs:      []string{testGifURLPrevious, testGifURL, testGifURLNext},
+		contextSessionID:    testSessionID,
 		contextCurrentIndex: 1,
-		contextCaption:      testCaption,
-		contextKeywords:     testKeywords,
-		contextAPICursor:    testCursor,
-		contextRootID:       testRootID,
+		contextSignature:    signContext(testContextSecret, testSessionID, 1),
 	},
 }
 
@@ -52,18 +57,38 @@ func generatePostActionIntegrationRequestBody() io.Reader {
 	return bytes.NewBuffer(json)
 }
 
-func generateTestIntegrationRequest(currentIndex int) *integrationRequest {
-	return &integrationRequest{
-		testKeywords, testCaption, []string{testGifURLPrevious, testGifURL, testGifURLNext}, currentIndex, testCursor, testRootID, testPostActionIntegrationRequest,
+func generateTestPreviewState(currentIndex int) previewState {
+	return previewState{
+		SessionID:       testSessionID,
+		UserID:          testUserID,
+		Keywords:        testKeywords,
+		Caption:         testCaption,
+		Gifs:            newTestGifs(testGifURLPrevious, testGifURL, testGifURLNext),
+		CurrentGifIndex: currentIndex,
+		SearchCursor:    testCursor,
+		RootID:          testRootID,
+		MediaType:       string(provider.MediaTypeGif),
 	}
 }
 
+func generateTestIntegrationRequest(currentIndex int) *integrationRequest {
+	return &integrationRequest{generateTestPreviewState(currentIndex), testPostActionIntegrationRequest}
+}
+
+func setupTestPreviewSession(p *Plugin) {
+	state := generateTestPreviewState(1)
+	_ = p.savePreviewSession(state)
+}
+
 func setupMockPluginWithAuthent() *Plugin {
 	api := &plugintest.API{}
 	api.On("HasPermissionToChannel", mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("*model.Permission")).Return(true)
 	p := &Plugin{}
 	p.SetAPI(api)
 	p.httpHandler = &mockHTTPHandler{}
+	p.pluginClient = &pluginapi.Client{KV: newMockKVStore()}
+	p.contextSecret = testContextSecret
+	setupTestPreviewSession(p)
 
 	return p
 }
@@ -71,7 +96,7 @@ func setupMockPluginWithAuthent() *Plugin {
 func TestHandleHTTPRequestShouldReturnOKStatusForAllSupportedRoutes(t *testing.T) {
 	p := setupMockPluginWithAuthent()
 
-	goodURLs := [4]string{URLCancel, URLShuffle, URLPrevious, URLSend}
+	goodURLs := [5]string{URLCancel, URLShuffle, URLPrevious, URLSend, URLFavorite}
 	for _, URL := range goodURLs {
 		w := httptest.NewRecorder()
 		r := httptest.NewRequest("POST", URL, generatePostActionIntegrationRequestBody())
@@ -146,6 +171,7 @@ func TestHandleHTTPRequestShouldFailWhenUserDontHavePostingPermissionToChannel(t
 	p := &Plugin{}
 	p.SetAPI(api)
 	p.httpHandler = &mockHTTPHandler{}
+	p.contextSecret = testContextSecret
 
 	w := httptest.NewRecorder()
 	r := httptest.NewRequest("POST", URLSend, generatePostActionIntegrationRequestBody())
@@ -158,25 +184,128 @@ func TestHandleHTTPRequestShouldFailWhenUserDontHavePostingPermissionToChannel(t
 	assert.Equal(t, 403, result.StatusCode)
 }
 
+func TestHandleHTTPRequestShouldServeGifFromLocalLibrary(t *testing.T) {
+	_, p := initMockAPI()
+	p.configuration.LocalLibraryDirectory = t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(p.configuration.LocalLibraryDirectory, "ship it.gif"), []byte("GIF89a"), 0600))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/library/ship%20it.gif", nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+
+	p.handleHTTPRequest(w, r)
+
+	result := w.Result()
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "image/gif", result.Header.Get("Content-Type"))
+	bodyBytes, _ := io.ReadAll(result.Body)
+	assert.Equal(t, "GIF89a", string(bodyBytes))
+}
+
+func TestHandleHTTPRequestShouldNotServeUnknownOrUnsafeLocalLibraryFiles(t *testing.T) {
+	_, p := initMockAPI()
+	p.configuration.LocalLibraryDirectory = t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(p.configuration.LocalLibraryDirectory, "notes.txt"), []byte("secret"), 0600))
+
+	for _, path := range []string{"/library/missing.gif", "/library/notes.txt", "/library/../plugin.gif", "/library/"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Add("Mattermost-User-Id", testUserID)
+
+		p.handleHTTPRequest(w, r)
+
+		assert.Equal(t, 404, w.Result().StatusCode, path)
+	}
+}
+
+func TestHandleHTTPRequestShouldNotServeLocalLibraryWhenMissingAuthHeader(t *testing.T) {
+	_, p := initMockAPI()
+	p.configuration.LocalLibraryDirectory = t.TempDir()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/library/cat.gif", nil)
+
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, 401, w.Result().StatusCode)
+}
+
+func TestHandleHTTPRequestShouldReturnCacheStatsToSystemAdmins(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	p.gifCache = provider.NewGifCache(42, time.Hour, nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLCacheStats, nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+
+	p.handleHTTPRequest(w, r)
+
+	result := w.Result()
+	assert.Equal(t, 200, result.StatusCode)
+	var stats provider.GifCacheStats
+	assert.Nil(t, json.NewDecoder(result.Body).Decode(&stats))
+	assert.Equal(t, 42, stats.MaxSize)
+}
+
+func TestHandleHTTPRequestShouldNotReturnCacheStatsToOtherUsers(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", URLCacheStats, nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, 403, w.Result().StatusCode)
+}
+
 func TestParseRequestShouldParseAllValuesFromCorrectRequest(t *testing.T) {
 	r := httptest.NewRequest("POST", URLSend, generatePostActionIntegrationRequestBody())
 
-	request, err := parseRequest(r)
+	request, err := parseRequest(r, testContextSecret)
 
 	assert.Nil(t, err)
 	assert.NotNil(t, request)
 	assert.Equal(t, request.ChannelId, testChannelID)
 	assert.Equal(t, request.UserId, testUserID)
-	assert.Equal(t, request.GifURLs, []string{testGifURLPrevious, testGifURL, testGifURLNext})
+	assert.Equal(t, request.SessionID, testSessionID)
 	assert.Equal(t, request.CurrentGifIndex, 1)
-	assert.Equal(t, request.Keywords, testKeywords)
-	assert.Equal(t, request.SearchCursor, testCursor)
-	assert.Equal(t, request.RootID, testRootID)
+}
+
+func TestParseRequestShouldFailWhenContextSignatureIsInvalid(t *testing.T) {
+	r := httptest.NewRequest("POST", URLSend, generatePostActionIntegrationRequestBody())
+
+	request, err := parseRequest(r, []byte("another secret"))
+
+	assert.Nil(t, request)
+	assert.Equal(t, errInvalidContextSignature, err)
+}
+
+func TestHandleHTTPRequestShouldRejectTamperedContext(t *testing.T) {
+	p := setupMockPluginWithAuthent()
+	api := p.API.(*plugintest.API)
+	api.On("LogError", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	tamperedRequest := testPostActionIntegrationRequest
+	tamperedRequest.Context = map[string]interface{}{
+		contextSessionID:    testSessionID,
+		contextCurrentIndex: 2,
+		contextSignature:    signContext(testContextSecret, testSessionID, 1),
+	}
+	body, _ := json.Marshal(tamperedRequest)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", URLSend, bytes.NewBuffer(body))
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
+	api.AssertCalled(t, "LogError", mock.MatchedBy(func(message string) bool { return strings.HasPrefix(message, "Audit") }), "userId", testUserID, "url", URLSend, "error", mock.Anything)
 }
 
 func TestParseRequestShouldFailIfRequestIfBodyCantBeRead(t *testing.T) {
 	r := httptest.NewRequest("POST", URLSend, nil)
-	request, err := parseRequest(r)
+	request, err := parseRequest(r, testContextSecret)
 	assert.Nil(t, request)
 	assert.NotNil(t, err)
 }
@@ -184,7 +313,7 @@ func TestParseRequestShouldFailIfRequestIfBodyCantBeRead(t *testing.T) {
 func TestParseRequestShouldFailIfBodyCantBeParsed(t *testing.T) {
 	body := bytes.NewBuffer([]byte("this is not a valid json"))
 	r := httptest.NewRequest("POST", URLSend, body)
-	request, err := parseRequest(r)
+	request, err := parseRequest(r, testContextSecret)
 	assert.Nil(t, request)
 	assert.NotNil(t, err)
 }
@@ -213,7 +342,7 @@ func TestParseRequestShouldFailWhenRequiredContextValueIsMissing(t *testing.T) {
 		body := bytes.NewBuffer([]byte(incompleteContextRequests[i]))
 		r := httptest.NewRequest("POST", URLSend, body)
 
-		request, err := parseRequest(r)
+		request, err := parseRequest(r, testContextSecret)
 
 		assert.Nil(t, request)
 		assert.NotNil(t, err)
@@ -247,6 +376,8 @@ func TestHandleCancelShouldDeleteEphemeralPost(t *testing.T) {
 		mock.AnythingOfType("string")).Return(nil)
 	p := Plugin{}
 	p.SetAPI(api)
+	p.pluginClient = &pluginapi.Client{KV: newMockKVStore()}
+	setupTestPreviewSession(&p)
 	h := &defaultHTTPHandler{}
 	w := httptest.NewRecorder()
 	h.handleCancel(&p, w, generateTestIntegrationRequest(1))
@@ -255,6 +386,40 @@ func TestHandleCancelShouldDeleteEphemeralPost(t *testing.T) {
 		"DeleteEphemeralPost",
 		mock.MatchedBy(func(s string) bool { return s == testUserID }),
 		mock.MatchedBy(func(postId string) bool { return postId == testPostID }))
+	_, err := p.loadPreviewSession(testSessionID)
+	assert.Equal(t, errPreviewSessionNotFound, err)
+}
+
+func TestHandleHTTPRequestShouldNotifyWhenPreviewSessionHasExpired(t *testing.T) {
+	p := setupMockPluginWithAuthent()
+	p.pluginClient = &pluginapi.Client{KV: newMockKVStore()}
+	notified := false
+	notifyUserOfError = func(_ plugin.API, _ string, message string, _ *model.AppError, _ *model.PostActionIntegrationRequest) {
+		notified = true
+		assert.Contains(t, message, "expired")
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", URLShuffle, generatePostActionIntegrationRequestBody())
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.True(t, notified)
+}
+
+func TestHandleHTTPRequestShouldRefusePreviewSessionOfAnotherUser(t *testing.T) {
+	p := setupMockPluginWithAuthent()
+	state := generateTestPreviewState(1)
+	state.UserID = "another-user"
+	assert.Nil(t, p.savePreviewSession(state))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", URLSend, generatePostActionIntegrationRequestBody())
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Result().StatusCode)
 }
 
 func TestHandleShuffleShouldUseTheNextLoadedGifToUpdateTheEphemeralPost(t *testing.T) {
@@ -276,6 +441,77 @@ func TestHandleShuffleShouldUseTheNextLoadedGifToUpdateTheEphemeralPost(t *testi
 		}))
 }
 
+func TestHandleShuffleShouldSaveTheNewGifsInThePreviewSession(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("UpdateEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Post")).Return(nil)
+	p.gifProvider = newMockGifProvider()
+	h := &defaultHTTPHandler{}
+	w := httptest.NewRecorder()
+	h.handleShuffle(p, w, generateTestIntegrationRequest(2))
+	assert.Equal(t, w.Result().StatusCode, http.StatusOK)
+	session, err := p.loadPreviewSession(testSessionID)
+	assert.Nil(t, err)
+	assert.Equal(t, newTestGifs(testGifURLPrevious, testGifURL, testGifURLNext, "fakeURL"), session.Gifs)
+	assert.Equal(t, testUserID, session.UserID)
+}
+
+// gifsProvider always provides the same GIFs
+type gifsProvider struct {
+	mockGifProvider
+	gifs []provider.Gif
+}
+
+func (m *gifsProvider) GetGifs(_ string, _ provider.MediaType, _ *string, _ bool) ([]provider.Gif, *model.AppError) {
+	return m.gifs, nil
+}
+
+func TestHandleShuffleShouldNotAddTheGifsAlreadySeen(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("UpdateEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Post")).Return(nil)
+	request := generateTestIntegrationRequest(2)
+	request.Gifs[1].ID = "42"
+	request.Gifs[1].Provider = "giphy"
+	// The providers can return the same GIF again, with another rendition URL, and another provider can use the same ID
+	p.gifProvider = &gifsProvider{gifs: []provider.Gif{
+		{ID: "42", Provider: "giphy", URL: "https://gif.fr/gif/42-small"},
+		{ID: "44", Provider: "giphy", URL: "https://gif.fr/gif/44"},
+		{ID: "42", Provider: "tenor", URL: "https://gif.fr/tenor/42"},
+	}}
+	h := &defaultHTTPHandler{}
+	w := httptest.NewRecorder()
+	h.handleShuffle(p, w, request)
+	assert.Equal(t, w.Result().StatusCode, http.StatusOK)
+	session, err := p.loadPreviewSession(testSessionID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{testGifURLPrevious, testGifURL, testGifURLNext, "https://gif.fr/gif/44", "https://gif.fr/tenor/42"}, getGifURLs(session.Gifs))
+}
+
+func TestHandleShuffleShouldNotifyUserWhenAllTheNewGifsWereAlreadySeen(t *testing.T) {
+	api, p := initMockAPI()
+	notifications := captureNotifications(t)
+	request := generateTestIntegrationRequest(2)
+	request.SearchCursor = "page2"
+	p.gifProvider = &gifsProvider{gifs: newTestGifs(testGifURL, testGifURLNext)}
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, []string{"No new GIFs found for '" + testKeywords + "'"}, *notifications)
+	api.AssertNotCalled(t, "UpdateEphemeralPost", mock.Anything, mock.Anything)
+	session, err := p.loadPreviewSession(testSessionID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{testGifURLPrevious, testGifURL, testGifURLNext}, getGifURLs(session.Gifs))
+}
+
+func getGifURLs(gifs []provider.Gif) []string {
+	urls := []string{}
+	for _, gif := range gifs {
+		urls = append(urls, gif.URL)
+	}
+	return urls
+}
+
 func TestHandleShuffleShouldLoadNewGifsIfNeededToUpdateEphemeralPostWhenSearchSucceeds(t *testing.T) {
 	api, p := initMockAPI()
 	api.On("UpdateEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Post")).Return(nil)
@@ -312,6 +548,20 @@ func TestHandleShuffleShouldNotifyUserWhenSearchReturnsNoResult(t *testing.T) {
 	assert.True(t, notifyUserWasCalled)
 }
 
+func TestHandleShuffleShouldNotSearchForSavedGifs(t *testing.T) {
+	_, p := initMockAPI()
+	p.configuration.RandomSearch = true
+	p.gifProvider = &mockGifProviderFail{"the provider should not be called"}
+	notifications := captureNotifications(t)
+	request := generateTestIntegrationRequest(2)
+	request.SearchCursor = ""
+	request.Saved = true
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+	assert.Equal(t, []string{"No more GIFs found for '" + testKeywords + "'"}, *notifications)
+}
+
 func TestHandleShuffleShouldFailWhenSearchFails(t *testing.T) {
 	api, p := initMockAPI()
 	p.gifProvider = &mockGifProviderFail{"fakeURL"}
@@ -349,7 +599,7 @@ func TestHandlePreviousShouldUpdateEphemeralPostWithPreviousGifFromContext(t *te
 func TestHandleSendSHouldDeleteTheEphemeralPostAndCreateANewPostWhenSearchSucceeds(t *testing.T) {
 	api, p := initMockAPI()
 	api.On("DeleteEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
-	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(nil, nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: testPostID}, nil)
 	p.gifProvider = newMockGifProvider()
 	h := &defaultHTTPHandler{}
 	w := httptest.NewRecorder()
@@ -370,6 +620,24 @@ func TestHandleSendSHouldDeleteTheEphemeralPostAndCreateANewPostWhenSearchSuccee
 	)
 }
 
+func TestHandleSendShouldPostTheGifWithTheDescriptionOfThePreview(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("DeleteEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: testPostID}, nil)
+	p.configuration.IncludeGifDescription = true
+	request := generateTestIntegrationRequest(1)
+	request.Gifs[1].Title = "Cat GIF"
+	request.AltText = "A cat waving"
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleSend(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	api.AssertCalled(t, "CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+		return strings.Contains(post.Message, "GIF description: A cat waving") &&
+			strings.Contains(post.Message, "![A cat waving]("+testGifURL+")")
+	}))
+}
+
 func TestHandleSendShouldFailWhenCreatePostFails(t *testing.T) {
 	api := &plugintest.API{}
 	api.On("DeleteEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
@@ -380,6 +648,7 @@ func TestHandleSendShouldFailWhenCreatePostFails(t *testing.T) {
 
 	p := Plugin{}
 	p.SetAPI(api)
+	p.pluginClient = &pluginapi.Client{KV: newMockKVStore()}
 	p.gifProvider = newMockGifProvider()
 	h := &defaultHTTPHandler{}
 	w := httptest.NewRecorder()
@@ -441,3 +710,36 @@ func TestDefaultNotifyUserOfErrorCreateAnEphemeralPostForDomainError(t *testing.
 		mock.MatchedBy(userIDCheck),
 		mock.MatchedBy(postCheck))
 }
+
+func TestHandleShuffleShouldLoadNextPageOfTrendingGifs(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("UpdateEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Post")).Return(nil)
+	gifProvider := &trendingGifProvider{mockGifProvider: *newMockGifProvider()}
+	p.gifProvider = gifProvider
+	p.configuration.RandomSearch = true
+	request := generateTestIntegrationRequest(2)
+	request.Trending = true
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, testCursor, gifProvider.trendingCursor)
+	api.AssertCalled(t, "UpdateEphemeralPost", testUserID, mock.MatchedBy(func(post *model.Post) bool {
+		return strings.Contains(post.Message, "trendingURL") &&
+			post.Attachments()[0].Actions[0].Integration.Context[contextSessionID] == testSessionID
+	}))
+}
+
+func TestHandleShuffleShouldSearchTheMediaTypeOfThePreview(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("UpdateEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("*model.Post")).Return(nil)
+	gifProvider := &mediaTypeGifProvider{mockGifProvider: *newMockGifProvider()}
+	p.gifProvider = gifProvider
+	request := generateTestIntegrationRequest(2)
+	request.MediaType = string(provider.MediaTypeSticker)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, provider.MediaTypeSticker, gifProvider.lastMediaType)
+}
@@ -1,6 +1,14 @@
 package configuration
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	// The time zones of the quiet hours must be known even on servers without a time zone database
+	_ "time/tzdata"
+)
 
 // Configuration captures the plugin's external configuration as exposed in the Mattermost server
 // configuration, as well as values computed from the configuration. Any public fields will be
@@ -13,8 +21,45 @@ type Configuration struct {
 	Rendition                    string
 	RenditionTenor               string
 	APIKey                       string
+	GiphyAPIKey                  string
+	TenorAPIKey                  string
+	FallbackProviders            string
+	LocalLibraryDirectory        string
+	CustomAPIURL                 string
+	CustomAPIQueryParameter      string
+	CustomAPICursorParameter     string
+	CustomAPIRatingParameter     string
+	CustomAPILanguageParameter   string
+	CustomAPIKeyParameter        string
+	CustomAPIResultsPath         string
+	CustomAPIGifURLPath          string
+	CustomAPINextCursorPath      string
 	DisablePostingWithoutPreview bool
 	RandomSearch                 bool
+	RegisterShares               bool
+	CacheTTLMinutes              int
+	CacheMaxSize                 int
+	CachePersistInKVStore        bool
+	RateLimitUserPerMinute       int
+	RateLimitChannelPerHour      int
+	AllowedMediaTypes            string
+	PreviewMode                  string
+	PreviewGridSize              int
+	ProxyMedia                   bool
+	ProxyMediaMaxSizeMB          int
+	ProxyMediaQuotaMB            int
+	AllowedPrivateMediaHosts     string
+	AttachmentMaxSizeMB          int
+	IncludeGifDescription        bool
+	AllowedChannels              string
+	BlockedChannels              string
+	QuietHoursStart              string
+	QuietHoursEnd                string
+	QuietHoursTimezone           string
+	BlockedKeywords              string
+	FilterResultMetadata         bool
+	AuditLogRetentionDays        int
+	ReportChannelID              string
 	// Computed fields:
 	CommandTriggerGif            string
 	CommandTriggerGifWithPreview string
@@ -33,16 +78,290 @@ func (c *Configuration) IsValid() error {
 		return errors.New("the Display Mode must be configured")
 	}
 
-	if (c.Provider == "giphy" || c.Provider == "tenor") && len(c.APIKey) == 0 {
-		return errors.New("when the selected Provider is Giphy or Tenor, an API Key must be provided")
+	if c.DisplayMode == DisplayModeAttachment && c.AttachmentMaxSizeMB <= 0 {
+		return errors.New("when the GIFs are posted as file attachments, their maximum size must be greater than zero")
+	}
+
+	if c.CacheTTLMinutes > 0 && c.CacheMaxSize <= 0 {
+		return errors.New("when the search cache is enabled, its maximum size must be greater than zero")
+	}
+
+	if c.PreviewMode == PreviewModeGrid && (c.PreviewGridSize < 2 || c.PreviewGridSize > MaxPreviewGridSize) {
+		return fmt.Errorf("the number of GIFs in the grid preview must be between 2 and %d", MaxPreviewGridSize)
+	}
+
+	if c.ProxyMedia && c.ProxyMediaMaxSizeMB <= 0 {
+		return errors.New("when the media are served by the plugin, their maximum size must be greater than zero")
+	}
+
+	if _, err := c.GetQuietHours(); err != nil {
+		return err
+	}
+
+	if _, err := c.GetBlockedKeywordPatterns(); err != nil {
+		return err
+	}
+
+	for _, mediaType := range c.GetAllowedMediaTypes() {
+		if !isKnownMediaType(mediaType) {
+			return fmt.Errorf("unknown media type %s in the allowed media types, the valid types are %s", mediaType, strings.Join(knownMediaTypes, ", "))
+		}
+	}
+
+	for i, provider := range c.GetProviderChain() {
+		if err := c.validateProvider(provider); err != nil {
+			if i == 0 {
+				return err
+			}
+			return fmt.Errorf("invalid fallback provider %s: %w", provider, err)
+		}
 	}
 
 	return nil
 }
 
+func (c *Configuration) validateProvider(provider string) error {
+	switch provider {
+	case "giphy", "tenor":
+		if len(c.GetAPIKey(provider)) == 0 {
+			return errors.New("when the selected Provider is Giphy or Tenor, an API Key must be provided")
+		}
+	case "local":
+		if len(c.LocalLibraryDirectory) == 0 {
+			return errors.New("when the selected Provider is the local GIF library, the library directory must be provided")
+		}
+	case "custom":
+		if len(c.CustomAPIURL) == 0 || len(c.CustomAPIQueryParameter) == 0 || len(c.CustomAPIGifURLPath) == 0 {
+			return errors.New("when the selected Provider is a custom API, the API URL, the query parameter name and the GIF URL path must be provided")
+		}
+	case "":
+	default:
+		return errors.New("unknown GIF provider " + provider)
+	}
+	return nil
+}
+
+// GetProviderChain returns the configured provider followed by the fallback providers, in the order they should be used
+func (c *Configuration) GetProviderChain() []string {
+	chain := []string{c.Provider}
+	for _, fallback := range strings.Split(c.FallbackProviders, ",") {
+		fallback = strings.ToLower(strings.TrimSpace(fallback))
+		alreadyInChain := fallback == ""
+		for _, provider := range chain {
+			if provider == fallback {
+				alreadyInChain = true
+			}
+		}
+		if !alreadyInChain {
+			chain = append(chain, fallback)
+		}
+	}
+	return chain
+}
+
+// GetAllowedMediaTypes returns the types of media that users can search for (gif, sticker, clip). Only GIFs are allowed if the setting is empty.
+func (c *Configuration) GetAllowedMediaTypes() []string {
+	mediaTypes := []string{}
+	for _, mediaType := range strings.Split(c.AllowedMediaTypes, ",") {
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType != "" {
+			mediaTypes = append(mediaTypes, mediaType)
+		}
+	}
+	if len(mediaTypes) == 0 {
+		return []string{MediaTypeGif}
+	}
+	return mediaTypes
+}
+
+// IsMediaTypeAllowed returns true if users can search for this type of media
+func (c *Configuration) IsMediaTypeAllowed(mediaType string) bool {
+	for _, allowed := range c.GetAllowedMediaTypes() {
+		if allowed == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// GetAllowedChannels returns the names or IDs of the only channels where GIFs can be posted, or an empty list if they can be posted in all the channels
+func (c *Configuration) GetAllowedChannels() []string {
+	return splitList(c.AllowedChannels)
+}
+
+// GetBlockedChannels returns the names or IDs of the channels where GIFs can't be posted
+func (c *Configuration) GetBlockedChannels() []string {
+	return splitList(c.BlockedChannels)
+}
+
+// GetAllowedPrivateMediaHosts returns the host names from which the media can be downloaded even if they have a private address
+func (c *Configuration) GetAllowedPrivateMediaHosts() []string {
+	return splitList(c.AllowedPrivateMediaHosts)
+}
+
+// splitList returns the lowercase values of a comma-separated list, without the empty values
+func splitList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetBlockedKeywordPatterns returns the case-insensitive patterns of the blocked keywords, one by line: a word or phrase
+// matches as whole words, and a value between slashes (like /kitt(y|en)/) is a regular expression
+func (c *Configuration) GetBlockedKeywordPatterns() ([]*regexp.Regexp, error) {
+	patterns := []*regexp.Regexp{}
+	for _, line := range strings.Split(c.BlockedKeywords, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		expression := `\b` + regexp.QuoteMeta(line) + `\b`
+		if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			expression = line[1 : len(line)-1]
+		}
+		pattern, err := regexp.Compile("(?i)" + expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blocked keyword %s: %w", line, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// QuietHours is the daily time range during which GIFs can't be posted
+type QuietHours struct {
+	// Start and End are the minutes after midnight in the time zone
+	Start    int
+	End      int
+	Location *time.Location
+}
+
+// GetQuietHours returns the configured quiet hours, nil if there are none, or an error if they are not valid
+func (c *Configuration) GetQuietHours() (*QuietHours, error) {
+	if c.QuietHoursStart == "" && c.QuietHoursEnd == "" {
+		return nil, nil
+	}
+	start, err := parseTimeOfDay(c.QuietHoursStart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start of the quiet hours: %w", err)
+	}
+	end, err := parseTimeOfDay(c.QuietHoursEnd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end of the quiet hours: %w", err)
+	}
+	location, err := LoadTimezone(c.QuietHoursTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone of the quiet hours: %w", err)
+	}
+	return &QuietHours{Start: start, End: end, Location: location}, nil
+}
+
+// Contains returns true if the time is during the quiet hours, which can span midnight
+func (q *QuietHours) Contains(t time.Time) bool {
+	t = t.In(q.Location)
+	minutes := t.Hour()*60 + t.Minute()
+	if q.Start <= q.End {
+		return minutes >= q.Start && minutes < q.End
+	}
+	return minutes >= q.Start || minutes < q.End
+}
+
+// parseTimeOfDay returns the minutes after midnight of a time formatted as HH:MM
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time formatted as HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// LoadTimezone returns the location of a time zone name like Europe/Paris, or UTC if the name is empty
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func isKnownMediaType(mediaType string) bool {
+	for _, known := range knownMediaTypes {
+		if known == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// SetProvider replaces the main provider, keeping the main API key for the previous provider if it is still used as a fallback
+func (c *Configuration) SetProvider(provider string) {
+	if provider == c.Provider {
+		return
+	}
+	switch {
+	case c.Provider == "giphy" && c.GiphyAPIKey == "":
+		c.GiphyAPIKey = c.APIKey
+	case c.Provider == "tenor" && c.TenorAPIKey == "":
+		c.TenorAPIKey = c.APIKey
+	}
+	c.APIKey = ""
+	c.Provider = provider
+}
+
+// GetCacheKeyPrefix returns a string that identifies all the settings that change the results of a search
+func (c *Configuration) GetCacheKeyPrefix() string {
+	settings := []string{strings.Join(c.GetProviderChain(), ","), c.Rating, c.Language, c.Rendition, c.RenditionTenor}
+	if c.FilterResultMetadata {
+		// The results are filtered with the blocked keywords
+		settings = append(settings, c.BlockedKeywords)
+	}
+	return strings.Join(settings, "|")
+}
+
+// GetAPIKey returns the API key to use for the given provider: its dedicated API key if set,
+// otherwise the main API key if the provider is the configured provider
+func (c *Configuration) GetAPIKey(provider string) string {
+	switch {
+	case provider == "giphy" && c.GiphyAPIKey != "":
+		return c.GiphyAPIKey
+	case provider == "tenor" && c.TenorAPIKey != "":
+		return c.TenorAPIKey
+	case provider == c.Provider:
+		return c.APIKey
+	default:
+		return ""
+	}
+}
+
 const (
 	// DisplayModeEmbedded display GIFs as Markdown embedded images
 	DisplayModeEmbedded = "embedded"
 	// DisplayModeFullURL displays GIFs as raw URLs using image preview
 	DisplayModeFullURL = "full_url"
+	// DisplayModeAttachment uploads GIFs as files attached to the post
+	DisplayModeAttachment = "attachment"
+)
+
+const (
+	// PreviewModeSingle previews one GIF at a time
+	PreviewModeSingle = "single"
+	// PreviewModeGrid previews a grid of GIF thumbnails to pick from
+	PreviewModeGrid = "grid"
+	// MaxPreviewGridSize is the maximum number of GIFs in a grid preview, to keep the preview readable
+	MaxPreviewGridSize = 10
 )
+
+const (
+	// MediaTypeGif is the media type of the animated GIFs, searched by default
+	MediaTypeGif = "gif"
+	// MediaTypeSticker is the media type of the GIFs with a transparent background
+	MediaTypeSticker = "sticker"
+	// MediaTypeClip is the media type of the short videos
+	MediaTypeClip = "clip"
+)
+
+var knownMediaTypes = []string{MediaTypeGif, MediaTypeSticker, MediaTypeClip}
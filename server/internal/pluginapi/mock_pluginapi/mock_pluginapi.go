@@ -8,8 +8,8 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
-	mattermost_plugin_api "github.com/mattermost/mattermost/server/public/pluginapi"
 	model "github.com/mattermost/mattermost/server/public/model"
+	pluginapi "github.com/mattermost/mattermost/server/public/pluginapi"
 )
 
 // MockBotService is a mock of BotService interface.
@@ -36,7 +36,7 @@ func (m *MockBotService) EXPECT() *MockBotServiceMockRecorder {
 }
 
 // EnsureBot mocks base method.
-func (m *MockBotService) EnsureBot(arg0 *model.Bot, arg1 ...mattermost_plugin_api.EnsureBotOption) (string, error) {
+func (m *MockBotService) EnsureBot(arg0 *model.Bot, arg1 ...pluginapi.EnsureBotOption) (string, error) {
 	m.ctrl.T.Helper()
 	varargs := []interface{}{arg0}
 	for _, a := range arg1 {
@@ -54,3 +54,74 @@ func (mr *MockBotServiceMockRecorder) EnsureBot(arg0 interface{}, arg1 ...interf
 	varargs := append([]interface{}{arg0}, arg1...)
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnsureBot", reflect.TypeOf((*MockBotService)(nil).EnsureBot), varargs...)
 }
+
+// MockKVService is a mock of KVService interface.
+type MockKVService struct {
+	ctrl     *gomock.Controller
+	recorder *MockKVServiceMockRecorder
+}
+
+// MockKVServiceMockRecorder is the mock recorder for MockKVService.
+type MockKVServiceMockRecorder struct {
+	mock *MockKVService
+}
+
+// NewMockKVService creates a new mock instance.
+func NewMockKVService(ctrl *gomock.Controller) *MockKVService {
+	mock := &MockKVService{ctrl: ctrl}
+	mock.recorder = &MockKVServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKVService) EXPECT() *MockKVServiceMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockKVService) Get(key string, o interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", key, o)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockKVServiceMockRecorder) Get(key, o interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockKVService)(nil).Get), key, o)
+}
+
+// Set mocks base method.
+func (m *MockKVService) Set(key string, value interface{}, options ...pluginapi.KVSetOption) (bool, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{key, value}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Set", varargs...)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockKVServiceMockRecorder) Set(key, value interface{}, options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{key, value}, options...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockKVService)(nil).Set), varargs...)
+}
+
+// SetAtomicWithRetries mocks base method.
+func (m *MockKVService) SetAtomicWithRetries(key string, valueFunc func([]byte) (interface{}, error)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAtomicWithRetries", key, valueFunc)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAtomicWithRetries indicates an expected call of SetAtomicWithRetries.
+func (mr *MockKVServiceMockRecorder) SetAtomicWithRetries(key, valueFunc interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAtomicWithRetries", reflect.TypeOf((*MockKVService)(nil).SetAtomicWithRetries), key, valueFunc)
+}
@@ -8,6 +8,7 @@ import (
 
 type Client struct {
 	Bot BotService
+	KV  KVService
 }
 
 // BotService is an interface declaring only the functions from
@@ -16,7 +17,15 @@ type BotService interface {
 	EnsureBot(*model.Bot, ...pluginapi.EnsureBotOption) (retBotID string, retErr error)
 }
 
+// KVService is an interface declaring only the functions from
+// mattermost-plugin-api KVService that are used in this plugin
+type KVService interface {
+	Get(key string, o interface{}) error
+	Set(key string, value interface{}, options ...pluginapi.KVSetOption) (bool, error)
+	SetAtomicWithRetries(key string, valueFunc func(oldValue []byte) (newValue interface{}, err error)) error
+}
+
 func NewClient(api plugin.API, driver plugin.Driver) *Client {
 	client := pluginapi.NewClient(api, driver)
-	return &Client{Bot: &client.Bot}
+	return &Client{Bot: &client.Bot, KV: &client.KV}
 }
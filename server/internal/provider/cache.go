@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	mmPluginapi "github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+const cacheKVKeyPrefix = "cache_"
+
+// GifCache stores the results of GIF searches in memory, with a least recently used eviction policy,
+// and optionally in the plugin KV store so that they are shared between the servers of a cluster.
+type GifCache struct {
+	lock    sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	kv      pluginapi.KVService
+	order   *list.List
+	entries map[string]*list.Element
+	hits    int64
+	misses  int64
+}
+
+// GifCacheStats describes the usage of the cache since its creation
+type GifCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Size    int   `json:"size"`
+	MaxSize int   `json:"maxSize"`
+}
+
+// cachedSearch is the page of GIFs of a search, or the suggestions of a query
+type cachedSearch struct {
+	Key         string   `json:"key"`
+	Gifs        []Gif    `json:"gifs,omitempty"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Cursor      string   `json:"cursor"`
+	ExpireAt    int64    `json:"expireAt"`
+}
+
+// NewGifCache creates a cache of at most maxSize searches, each kept for the ttl duration.
+// If kv is not nil, the searches are also persisted in the plugin KV store.
+func NewGifCache(maxSize int, ttl time.Duration, kv pluginapi.KVService) *GifCache {
+	return &GifCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		kv:      kv,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// GetStats returns the hit and miss counters of the cache
+func (c *GifCache) GetStats() GifCacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return GifCacheStats{Hits: c.hits, Misses: c.misses, Size: c.order.Len(), MaxSize: c.maxSize}
+}
+
+func (c *GifCache) get(key string) (cachedSearch, bool) {
+	now := model.GetMillis()
+	if search, found := c.getFromMemory(key, now); found {
+		return search, true
+	}
+
+	if c.kv != nil {
+		var search cachedSearch
+		if err := c.kv.Get(getCacheKVKey(key), &search); err == nil && search.Key == key && search.ExpireAt > now {
+			c.lock.Lock()
+			c.add(search)
+			c.hits++
+			c.lock.Unlock()
+			return search, true
+		}
+	}
+
+	c.lock.Lock()
+	c.misses++
+	c.lock.Unlock()
+	return cachedSearch{}, false
+}
+
+func (c *GifCache) getFromMemory(key string, now int64) (cachedSearch, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return cachedSearch{}, false
+	}
+	search := element.Value.(cachedSearch)
+	if search.ExpireAt <= now {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return cachedSearch{}, false
+	}
+	c.order.MoveToFront(element)
+	c.hits++
+	return search, true
+}
+
+func (c *GifCache) set(search cachedSearch) {
+	search.ExpireAt = model.GetMillis() + c.ttl.Milliseconds()
+	c.lock.Lock()
+	c.add(search)
+	c.lock.Unlock()
+
+	if c.kv != nil {
+		// The cache is only an optimization: failing to persist a search is not an error
+		_, _ = c.kv.Set(getCacheKVKey(search.Key), search, mmPluginapi.SetExpiry(c.ttl))
+	}
+}
+
+// add stores the search in memory, evicting the least recently used searches if needed. The lock must be held.
+func (c *GifCache) add(search cachedSearch) {
+	if element, found := c.entries[search.Key]; found {
+		element.Value = search
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[search.Key] = c.order.PushFront(search)
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(cachedSearch).Key)
+	}
+}
+
+// getCacheKVKey hashes the cache key, as KV store keys are limited in length
+func getCacheKVKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return cacheKVKeyPrefix + hex.EncodeToString(hash[:])
+}
+
+// cached find GIFs with another provider, reusing the results of previous identical searches
+type cached struct {
+	GifProvider
+	cache           *GifCache
+	keyPrefix       string
+	suggestionsOnly bool
+}
+
+// NewCachedGifProvider creates a GIF provider that stores the results of the given provider in the cache.
+// The key prefix must identify the provider and every setting that changes the search results (rating, language, rendition, etc.).
+// Random searches are never cached, as they are expected to return different GIFs each time.
+func NewCachedGifProvider(gifProvider GifProvider, cache *GifCache, keyPrefix string) GifProvider {
+	return &cached{
+		GifProvider: gifProvider,
+		cache:       cache,
+		keyPrefix:   keyPrefix,
+	}
+}
+
+// NewSuggestionCachedGifProvider creates a GIF provider that only stores the search suggestions of the given provider in the cache,
+// for when the search results must not be cached
+func NewSuggestionCachedGifProvider(gifProvider GifProvider, cache *GifCache, keyPrefix string) GifProvider {
+	return &cached{
+		GifProvider:     gifProvider,
+		cache:           cache,
+		keyPrefix:       keyPrefix,
+		suggestionsOnly: true,
+	}
+}
+
+func (p *cached) GetAttributionMessageForGif(gif Gif) string {
+	return GetAttributionMessageForGif(p.GifProvider, gif)
+}
+
+func (p *cached) GetStillURL(gifURL string) string {
+	return GetStillURL(p.GifProvider, gifURL)
+}
+
+func (p *cached) RegisterShare(gif Gif, query string) (bool, *model.AppError) {
+	return RegisterShare(p.GifProvider, gif, query)
+}
+
+func (p *cached) SupportsMediaType(mediaType MediaType) bool {
+	return SupportsMediaType(p.GifProvider, mediaType)
+}
+
+// Return the cached GIFs of the search if they exist, otherwise search with the underlying provider and cache the results
+func (p *cached) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	if random || p.suggestionsOnly {
+		return p.GifProvider.GetGifs(request, mediaType, cursor, random)
+	}
+
+	key := strings.Join([]string{p.keyPrefix, string(mediaType), request, *cursor}, "|")
+	return p.getCachedGifs(key, cursor, func() ([]Gif, *model.AppError) {
+		return p.GifProvider.GetGifs(request, mediaType, cursor, random)
+	})
+}
+
+// Return the cached trending GIFs if they exist, otherwise ask the underlying provider and cache them
+func (p *cached) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	if p.suggestionsOnly {
+		return p.GifProvider.GetTrendingGifs(cursor)
+	}
+
+	// The prefix prevents any conflict with the keys of the searches, that start with the provider name
+	key := strings.Join([]string{"trending", p.keyPrefix, *cursor}, "|")
+	return p.getCachedGifs(key, cursor, func() ([]Gif, *model.AppError) {
+		return p.GifProvider.GetTrendingGifs(cursor)
+	})
+}
+
+// getCachedGifs returns the cached GIFs and cursor for the key if they exist, otherwise the results of search, that are then cached
+func (p *cached) getCachedGifs(key string, cursor *string, search func() ([]Gif, *model.AppError)) ([]Gif, *model.AppError) {
+	if cachedResults, found := p.cache.get(key); found {
+		*cursor = cachedResults.Cursor
+		return append([]Gif{}, cachedResults.Gifs...), nil
+	}
+
+	gifs, err := search()
+	if err != nil {
+		return gifs, err
+	}
+	p.cache.set(cachedSearch{Key: key, Gifs: gifs, Cursor: *cursor})
+	return gifs, nil
+}
+
+// Return the cached suggestions for the query if they exist, otherwise ask the underlying provider and cache them
+func (p *cached) GetSearchSuggestions(query string) ([]string, *model.AppError) {
+	if _, ok := p.GifProvider.(SuggestionProvider); !ok {
+		return []string{}, nil
+	}
+
+	// The prefix prevents any conflict with the keys of the searches, that start with the provider name
+	key := strings.Join([]string{"suggestions", p.keyPrefix, query}, "|")
+	if search, found := p.cache.get(key); found {
+		return append([]string{}, search.Suggestions...), nil
+	}
+
+	suggestions, err := GetSearchSuggestions(p.GifProvider, query)
+	if err != nil {
+		return suggestions, err
+	}
+	p.cache.set(cachedSearch{Key: key, Suggestions: suggestions})
+	return suggestions, nil
+}
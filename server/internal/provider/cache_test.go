@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	mock_pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi/mock_pluginapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachedGifProviderShouldReuseResultsOfIdenticalSearch(t *testing.T) {
+	stub := &stubGifProvider{urls: []string{"url1", "url2"}, nextCursor: "2"}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		cursor := ""
+		gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"url1", "url2"}, getGifURLs(gifs))
+		assert.Equal(t, "2", cursor)
+	}
+	assert.Equal(t, 1, stub.calls)
+	assert.Equal(t, GifCacheStats{Hits: 1, Misses: 1, Size: 1, MaxSize: 10}, cache.GetStats())
+}
+
+func TestCachedGifProviderShouldNotMixDifferentSearches(t *testing.T) {
+	stub := &stubGifProvider{urls: []string{"url1"}, nextCursor: "1"}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+	otherSettings := NewCachedGifProvider(stub, cache, "giphy|r")
+
+	cursor := ""
+	_, _ = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	cursor = ""
+	_, _ = p.GetGifs("dog", MediaTypeGif, &cursor, false)
+	cursor = "1"
+	_, _ = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	cursor = ""
+	_, _ = otherSettings.GetGifs("cat", MediaTypeGif, &cursor, false)
+
+	assert.Equal(t, 4, stub.calls)
+	assert.Equal(t, int64(0), cache.GetStats().Hits)
+}
+
+func TestCachedGifProviderShouldNotCacheRandomSearches(t *testing.T) {
+	stub := &stubGifProvider{urls: []string{"url1"}}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		cursor := ""
+		_, err := p.GetGifs("cat", MediaTypeGif, &cursor, true)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, stub.calls)
+	assert.Equal(t, 0, cache.GetStats().Size)
+}
+
+func TestCachedGifProviderShouldNotCacheErrors(t *testing.T) {
+	stub := &stubGifProvider{errorMessage: "failure"}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		cursor := ""
+		_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, 2, stub.calls)
+}
+
+func TestGifCacheShouldEvictLeastRecentlyUsedSearches(t *testing.T) {
+	cache := NewGifCache(2, time.Hour, nil)
+	cache.set(cachedSearch{Key: "a", Gifs: []Gif{NewGifFromURL("a")}})
+	cache.set(cachedSearch{Key: "b", Gifs: []Gif{NewGifFromURL("b")}})
+	_, found := cache.get("a")
+	assert.True(t, found)
+	cache.set(cachedSearch{Key: "c", Gifs: []Gif{NewGifFromURL("c")}})
+
+	_, found = cache.get("b")
+	assert.False(t, found)
+	_, found = cache.get("a")
+	assert.True(t, found)
+	_, found = cache.get("c")
+	assert.True(t, found)
+	assert.Equal(t, 2, cache.GetStats().Size)
+}
+
+func TestGifCacheShouldExpireSearches(t *testing.T) {
+	cache := NewGifCache(2, -time.Second, nil)
+	cache.set(cachedSearch{Key: "a", Gifs: []Gif{NewGifFromURL("a")}})
+
+	_, found := cache.get("a")
+	assert.False(t, found)
+	assert.Equal(t, 0, cache.GetStats().Size)
+}
+
+func TestGifCacheShouldPersistSearchesInKVStore(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	kv := mock_pluginapi.NewMockKVService(mockCtrl)
+
+	var stored cachedSearch
+	kv.EXPECT().Set(getCacheKVKey("a"), gomock.Any(), gomock.Any()).DoAndReturn(func(_ string, value interface{}, _ ...interface{}) (bool, error) {
+		stored = value.(cachedSearch)
+		return true, nil
+	})
+	NewGifCache(2, time.Hour, kv).set(cachedSearch{Key: "a", Gifs: []Gif{{ID: "id", Title: "title", URL: "url"}}, Cursor: "next"})
+
+	// Another server of the cluster, with an empty memory cache
+	kv.EXPECT().Get(getCacheKVKey("a"), gomock.Any()).DoAndReturn(func(_ string, o interface{}) error {
+		*o.(*cachedSearch) = stored
+		return nil
+	})
+	otherCache := NewGifCache(2, time.Hour, kv)
+	search, found := otherCache.get("a")
+	assert.True(t, found)
+	assert.Equal(t, []Gif{{ID: "id", Title: "title", URL: "url"}}, search.Gifs)
+	assert.Equal(t, "next", search.Cursor)
+	assert.Equal(t, int64(1), otherCache.GetStats().Hits)
+}
+
+func TestCachedGifProviderShouldReuseSuggestions(t *testing.T) {
+	stub := &stubSuggestionProvider{suggestions: []string{"happy"}}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		suggestions, err := GetSearchSuggestions(p, "hap")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"happy"}, suggestions)
+	}
+	assert.Equal(t, 1, stub.suggestionCalls)
+}
+
+func TestSuggestionCachedGifProviderShouldOnlyCacheSuggestions(t *testing.T) {
+	stub := &stubSuggestionProvider{stubGifProvider: stubGifProvider{urls: []string{"url1"}}, suggestions: []string{"happy"}}
+	p := NewSuggestionCachedGifProvider(stub, NewGifCache(10, time.Hour, nil), "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		cursor := ""
+		_, _ = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+		_, _ = GetSearchSuggestions(p, "hap")
+	}
+	assert.Equal(t, 2, stub.calls)
+	assert.Equal(t, 1, stub.suggestionCalls)
+}
+
+func TestCachedGifProviderShouldReuseTrendingGifsSeparatelyFromSearches(t *testing.T) {
+	stub := &stubGifProvider{urls: []string{"url1"}, nextCursor: "1"}
+	cache := NewGifCache(10, time.Hour, nil)
+	p := NewCachedGifProvider(stub, cache, "giphy|g")
+
+	for i := 0; i < 2; i++ {
+		cursor := ""
+		gifs, err := p.GetTrendingGifs(&cursor)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"url1"}, getGifURLs(gifs))
+		assert.Equal(t, "1", cursor)
+	}
+	cursor := ""
+	_, _ = p.GetGifs("", MediaTypeGif, &cursor, false)
+	assert.Equal(t, 2, stub.calls)
+}
+
+func TestCachedGifProviderShouldCacheEachMediaTypeSeparately(t *testing.T) {
+	stub := &stubGifProvider{urls: []string{"url1"}}
+	p := NewCachedGifProvider(stub, NewGifCache(10, time.Hour, nil), "giphy|g")
+
+	for _, mediaType := range []MediaType{MediaTypeGif, MediaTypeSticker, MediaTypeGif, MediaTypeSticker} {
+		cursor := ""
+		_, err := p.GetGifs("cat", mediaType, &cursor, false)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, stub.calls)
+}
@@ -0,0 +1,190 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// CustomAPIMapping describes how to call a custom search API and how to read its JSON response
+type CustomAPIMapping struct {
+	// URL is the search endpoint, called with a GET request
+	URL string
+	// Names of the query parameters, only QueryParameter is mandatory
+	QueryParameter    string
+	CursorParameter   string
+	RatingParameter   string
+	LanguageParameter string
+	APIKeyParameter   string
+	// JSON paths (dot-separated keys or array indexes, ex: "data.results") of the response values
+	ResultsPath    string
+	GifURLPath     string
+	NextCursorPath string
+}
+
+// custom find GIFs using any search API whose response is described by a CustomAPIMapping
+type custom struct {
+	abstractGifProvider
+	apiKey  string
+	mapping CustomAPIMapping
+}
+
+// NewCustomProvider creates an instance of a GIF provider that uses an API configured by the administrator
+func NewCustomProvider(httpClient HTTPClient, errorGenerator pluginError.PluginError, mapping CustomAPIMapping, apiKey, language, rating string) (GifProvider, *model.AppError) {
+	if errorGenerator == nil {
+		return nil, model.NewAppError("NewCustomProvider", "errorGenerator cannot be nil for Custom Provider", nil, "", http.StatusInternalServerError)
+	}
+	if httpClient == nil {
+		return nil, errorGenerator.FromMessage("httpClient cannot be nil for Custom Provider")
+	}
+	if mapping.URL == "" {
+		return nil, errorGenerator.FromMessage("the API URL cannot be empty for Custom Provider")
+	}
+	if mapping.QueryParameter == "" {
+		return nil, errorGenerator.FromMessage("the query parameter name cannot be empty for Custom Provider")
+	}
+	if mapping.GifURLPath == "" {
+		return nil, errorGenerator.FromMessage("the GIF URL path cannot be empty for Custom Provider")
+	}
+
+	customProvider := &custom{}
+	customProvider.httpClient = httpClient
+	customProvider.errorGenerator = errorGenerator
+	customProvider.apiKey = apiKey
+	customProvider.language = language
+	customProvider.rating = rating
+	customProvider.mapping = mapping
+
+	return customProvider, nil
+}
+
+func (p *custom) GetAttributionMessage() string {
+	return ""
+}
+
+// Return the GIFs that match the query, or an empty list if no GIF matches the query, or an error if the search failed.
+// The custom search API only gives the URLs of its GIFs, that also identify them.
+func (p *custom) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	if mediaType != MediaTypeGif {
+		return []Gif{}, newUnsupportedMediaTypeError(p.errorGenerator, mediaType, "custom search API")
+	}
+	req, err := http.NewRequest("GET", p.mapping.URL, nil)
+	if err != nil {
+		return []Gif{}, p.errorGenerator.FromError("Could not generate URL", err)
+	}
+
+	q := req.URL.Query()
+	q.Add(p.mapping.QueryParameter, request)
+	if p.mapping.CursorParameter != "" && cursor != nil && *cursor != "" {
+		q.Add(p.mapping.CursorParameter, *cursor)
+	}
+	if p.mapping.RatingParameter != "" && p.rating != "none" && len(p.rating) > 0 {
+		q.Add(p.mapping.RatingParameter, p.rating)
+	}
+	if p.mapping.LanguageParameter != "" && len(p.language) > 0 {
+		q.Add(p.mapping.LanguageParameter, p.language)
+	}
+	if p.mapping.APIKeyParameter != "" && len(p.apiKey) > 0 {
+		q.Add(p.mapping.APIKeyParameter, p.apiKey)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	r, err := p.httpClient.Do(req)
+	if err != nil {
+		return []Gif{}, p.errorGenerator.FromError("Error calling the custom GIF API", err)
+	}
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	if r.StatusCode != http.StatusOK {
+		return []Gif{}, p.errorGenerator.FromMessage(fmt.Sprintf("Error calling the custom GIF API (HTTP Status: %v)", r.Status))
+	}
+	if r.Body == nil {
+		return []Gif{}, p.errorGenerator.FromMessage("Custom GIF API response body is empty")
+	}
+
+	var response interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err = decoder.Decode(&response); err != nil {
+		return []Gif{}, p.errorGenerator.FromError("Could not parse the custom GIF API response body", err)
+	}
+
+	results, found := getJSONPath(response, p.mapping.ResultsPath)
+	resultList, isList := results.([]interface{})
+	if !found || !isList {
+		return []Gif{}, p.errorGenerator.FromMessage("No result list found at path \"" + p.mapping.ResultsPath + "\" in the custom GIF API response")
+	}
+	if len(resultList) < 1 {
+		return []Gif{}, nil
+	}
+
+	gifs := []Gif{}
+	for _, result := range resultList {
+		if url, urlFound := getJSONPath(result, p.mapping.GifURLPath); urlFound {
+			if urlString, isString := url.(string); isString && urlString != "" {
+				gif := NewGifFromURL(urlString)
+				gif.Provider = "custom"
+				gifs = append(gifs, gif)
+			}
+		}
+	}
+	if len(gifs) < 1 {
+		return []Gif{}, p.errorGenerator.FromMessage("No GIF URL found at path \"" + p.mapping.GifURLPath + "\" in the custom GIF API response")
+	}
+
+	if p.mapping.NextCursorPath != "" {
+		*cursor = ""
+		if next, nextFound := getJSONPath(response, p.mapping.NextCursorPath); nextFound && next != nil {
+			*cursor = fmt.Sprintf("%v", next)
+		}
+	}
+
+	if random {
+		// Only pseudo-randomization is possible: the order of the current page of results is shuffled
+		// #nosec G404 -- shuffling GIFs does not require a secure random generator
+		rand.Shuffle(len(gifs), func(i, j int) { gifs[i], gifs[j] = gifs[j], gifs[i] })
+	}
+
+	return gifs, nil
+}
+
+// The custom search API only describes a search endpoint
+func (p *custom) GetTrendingGifs(_ *string) ([]Gif, *model.AppError) {
+	return []Gif{}, p.errorGenerator.FromMessage("Trending GIFs are not supported by the custom search API provider")
+}
+
+// getJSONPath returns the value found at the given dot-separated path of a decoded JSON document.
+// Each path element is either an object key or, for arrays, an index. An empty path returns the document itself.
+func getJSONPath(document interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return document, true
+	}
+	current := document
+	for _, element := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			child, found := value[element]
+			if !found {
+				return nil, false
+			}
+			current = child
+		case []interface{}:
+			index, err := strconv.Atoi(element)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
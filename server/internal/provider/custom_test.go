@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"net/http"
+	"testing"
+
+	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
+	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const defaultCustomResponseBody = `{
+	"data": {
+		"items": [
+			{ "id": "1", "media": [ { "url": "https://fakeurl/1.gif" } ] },
+			{ "id": "2", "media": [ { "url": "https://fakeurl/2.gif" } ] }
+		]
+	},
+	"paging": { "next": 42 }
+}`
+
+var testCustomMapping = CustomAPIMapping{
+	URL:               "https://gifs.test/api/search",
+	QueryParameter:    "query",
+	CursorParameter:   "page",
+	RatingParameter:   "safety",
+	LanguageParameter: "locale",
+	APIKeyParameter:   "token",
+	ResultsPath:       "data.items",
+	GifURLPath:        "media.0.url",
+	NextCursorPath:    "paging.next",
+}
+
+func generateCustomProviderForTest(mockHTTPResponse *http.Response) (*custom, *MockHTTPClient) {
+	client := NewMockHTTPClient(mockHTTPResponse)
+	provider, _ := NewCustomProvider(client, test.MockErrorGenerator(), testCustomMapping, "apikey", "fr", "pg")
+	return provider.(*custom), client
+}
+
+func TestNewCustomProvider(t *testing.T) {
+	testHTTPClient := NewMockHTTPClient(newServerResponseOK(defaultCustomResponseBody))
+	testErrorGenerator := test.MockErrorGenerator()
+	mappingWithoutURL := testCustomMapping
+	mappingWithoutURL.URL = ""
+	mappingWithoutQuery := testCustomMapping
+	mappingWithoutQuery.QueryParameter = ""
+	mappingWithoutGifURLPath := testCustomMapping
+	mappingWithoutGifURLPath.GifURLPath = ""
+	testCases := []struct {
+		testLabel           string
+		paramHTTPClient     HTTPClient
+		paramErrorGenerator pluginError.PluginError
+		paramMapping        CustomAPIMapping
+		expectedError       bool
+	}{
+		{testLabel: "OK", paramHTTPClient: testHTTPClient, paramErrorGenerator: testErrorGenerator, paramMapping: testCustomMapping, expectedError: false},
+		{testLabel: "KO missing URL", paramHTTPClient: testHTTPClient, paramErrorGenerator: testErrorGenerator, paramMapping: mappingWithoutURL, expectedError: true},
+		{testLabel: "KO missing query parameter", paramHTTPClient: testHTTPClient, paramErrorGenerator: testErrorGenerator, paramMapping: mappingWithoutQuery, expectedError: true},
+		{testLabel: "KO missing GIF URL path", paramHTTPClient: testHTTPClient, paramErrorGenerator: testErrorGenerator, paramMapping: mappingWithoutGifURLPath, expectedError: true},
+		{testLabel: "KO nil errorGenerator", paramHTTPClient: testHTTPClient, paramErrorGenerator: nil, paramMapping: testCustomMapping, expectedError: true},
+		{testLabel: "KO nil httpClient", paramHTTPClient: nil, paramErrorGenerator: testErrorGenerator, paramMapping: testCustomMapping, expectedError: true},
+	}
+
+	for _, testCase := range testCases {
+		provider, err := NewCustomProvider(testCase.paramHTTPClient, testCase.paramErrorGenerator, testCase.paramMapping, "apikey", "fr", "pg")
+		if testCase.expectedError {
+			assert.NotNil(t, err, testCase.testLabel)
+			assert.Nil(t, provider, testCase.testLabel)
+		} else {
+			assert.Nil(t, err, testCase.testLabel)
+			assert.NotNil(t, provider, testCase.testLabel)
+			assert.Equal(t, testCase.paramMapping, provider.(*custom).mapping, testCase.testLabel)
+		}
+	}
+}
+
+func TestCustomProviderGetGifURLShouldReturnUrlsAndCursorWhenSearchSucceeds(t *testing.T) {
+	p, _ := generateCustomProviderForTest(newServerResponseOK(defaultCustomResponseBody))
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://fakeurl/1.gif", "https://fakeurl/2.gif"}, getGifURLs(gifs))
+	assert.Equal(t, "42", cursor)
+}
+
+func TestCustomProviderGetGifURLShouldUseConfiguredParameters(t *testing.T) {
+	p, client := generateCustomProviderForTest(newServerResponseOK(defaultCustomResponseBody))
+	client.testRequestFunc = func(req *http.Request) bool {
+		assert.Equal(t, "gifs.test", req.URL.Host)
+		assert.Equal(t, "/api/search", req.URL.Path)
+		assert.Equal(t, "cat", req.URL.Query().Get("query"))
+		assert.Equal(t, "12", req.URL.Query().Get("page"))
+		assert.Equal(t, "pg", req.URL.Query().Get("safety"))
+		assert.Equal(t, "fr", req.URL.Query().Get("locale"))
+		assert.Equal(t, "apikey", req.URL.Query().Get("token"))
+		return true
+	}
+	cursor := "12"
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestCustomProviderGetGifURLShouldSkipUnconfiguredParameters(t *testing.T) {
+	p, client := generateCustomProviderForTest(newServerResponseOK(defaultCustomResponseBody))
+	p.mapping.CursorParameter = ""
+	p.mapping.APIKeyParameter = ""
+	p.rating = "none"
+	p.language = ""
+	client.testRequestFunc = func(req *http.Request) bool {
+		assert.Equal(t, "query=cat", req.URL.RawQuery)
+		return true
+	}
+	cursor := "12"
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestCustomProviderGetGifURLShouldReturnEmptyUrlWhenSearchReturnNoResult(t *testing.T) {
+	p, _ := generateCustomProviderForTest(newServerResponseOK(`{"data": {"items": []}}`))
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Empty(t, gifs)
+}
+
+func TestCustomProviderGetGifURLShouldHandleAPIErrors(t *testing.T) {
+	testCases := []struct {
+		testLabel     string
+		httpResponse  *http.Response
+		expectedError string
+	}{
+		{testLabel: "KO empty HTTP response body", httpResponse: newServerResponseOK(""), expectedError: "empty"},
+		{testLabel: "KO HTTP response JSON parse error", httpResponse: newServerResponseOK("This is not a valid JSON response"), expectedError: "parse"},
+		{testLabel: "KO HTTP 500", httpResponse: newServerResponseKO(500), expectedError: "500"},
+		{testLabel: "KO results path not found", httpResponse: newServerResponseOK(`{"results": []}`), expectedError: "data.items"},
+		{testLabel: "KO GIF URL path not found", httpResponse: newServerResponseOK(`{"data": {"items": [{"url": "https://fakeurl/1.gif"}]}}`), expectedError: "media.0.url"},
+	}
+
+	for _, testCase := range testCases {
+		p, _ := generateCustomProviderForTest(testCase.httpResponse)
+		cursor := ""
+		gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+		assert.NotNil(t, err, testCase.testLabel)
+		assert.Contains(t, err.Error(), testCase.expectedError, testCase.testLabel)
+		assert.Empty(t, gifs, testCase.testLabel)
+	}
+}
+
+func TestGetJSONPath(t *testing.T) {
+	document := map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": []interface{}{"zero", map[string]interface{}{"c": "deep"}},
+		},
+	}
+	testCases := []struct {
+		path          string
+		expectedFound bool
+		expectedValue interface{}
+	}{
+		{path: "", expectedFound: true, expectedValue: document},
+		{path: "a.b.0", expectedFound: true, expectedValue: "zero"},
+		{path: "a.b.1.c", expectedFound: true, expectedValue: "deep"},
+		{path: "a.b.2", expectedFound: false},
+		{path: "a.b.x", expectedFound: false},
+		{path: "a.z", expectedFound: false},
+		{path: "a.b.0.c", expectedFound: false},
+	}
+	for _, testCase := range testCases {
+		value, found := getJSONPath(document, testCase.path)
+		assert.Equal(t, testCase.expectedFound, found, testCase.path)
+		if testCase.expectedFound {
+			assert.Equal(t, testCase.expectedValue, value, testCase.path)
+		}
+	}
+}
+
+func TestCustomProviderGetTrendingGifURLShouldFail(t *testing.T) {
+	p, _ := generateCustomProviderForTest(newServerResponseOK("{}"))
+	cursor := ""
+	gifs, err := p.GetTrendingGifs(&cursor)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not supported")
+	assert.Empty(t, gifs)
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+
+	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// GifAttributionProvider is implemented by GIF providers whose attribution message depends
+// on which underlying provider found the GIF
+type GifAttributionProvider interface {
+	GetAttributionMessageForGif(gif Gif) string
+}
+
+// GetAttributionMessageForGif returns the attribution message of the provider that found the GIF
+func GetAttributionMessageForGif(gifProvider GifProvider, gif Gif) string {
+	if gifAttributionProvider, ok := gifProvider.(GifAttributionProvider); ok {
+		return gifAttributionProvider.GetAttributionMessageForGif(gif)
+	}
+	return gifProvider.GetAttributionMessage()
+}
+
+// fallback find GIFs by trying an ordered list of providers until one of them returns results
+type fallback struct {
+	errorGenerator pluginError.PluginError
+	names          []string
+	providers      []GifProvider
+}
+
+// fallbackCursor is the search cursor of the fallback provider. It keeps the cursor of each provider
+// so that the successive searches of a shuffle continue with the provider that served the last results.
+// The cursor is empty once the last provider has no more results, like the cursor of a single provider.
+type fallbackCursor struct {
+	// Next is the index of the provider that is tried first for the next results
+	Next    int               `json:"next"`
+	Cursors map[string]string `json:"cursors"`
+}
+
+// NewFallbackProvider creates a GIF provider that searches with the first provider, and then with
+// the next ones when a provider fails or doesn't find any GIF
+func NewFallbackProvider(errorGenerator pluginError.PluginError, names []string, providers []GifProvider) (GifProvider, *model.AppError) {
+	if errorGenerator == nil {
+		return nil, model.NewAppError("NewFallbackProvider", "errorGenerator cannot be nil for Fallback Provider", nil, "", http.StatusInternalServerError)
+	}
+	if len(providers) == 0 {
+		return nil, errorGenerator.FromMessage("at least one provider is needed for Fallback Provider")
+	}
+	if len(names) != len(providers) {
+		return nil, errorGenerator.FromMessage("each provider must be named for Fallback Provider")
+	}
+	for i := range providers {
+		if providers[i] == nil {
+			return nil, errorGenerator.FromMessage("provider " + names[i] + " cannot be nil for Fallback Provider")
+		}
+	}
+
+	return &fallback{
+		errorGenerator: errorGenerator,
+		names:          names,
+		providers:      providers,
+	}, nil
+}
+
+func (p *fallback) GetAttributionMessage() string {
+	return p.providers[0].GetAttributionMessage()
+}
+
+// Return the attribution message of the provider named by the GIF, or the one of the first provider
+func (p *fallback) GetAttributionMessageForGif(gif Gif) string {
+	for i, name := range p.names {
+		if name == gif.Provider {
+			return GetAttributionMessageForGif(p.providers[i], gif)
+		}
+	}
+	return p.GetAttributionMessage()
+}
+
+// Return the still image given by the provider that served the GIF, if one of them recognizes it
+func (p *fallback) GetStillURL(gifURL string) string {
+	for _, gifProvider := range p.providers {
+		if stillURL := GetStillURL(gifProvider, gifURL); stillURL != gifURL {
+			return stillURL
+		}
+	}
+	return gifURL
+}
+
+// Register the share with the provider that served the GIF, if one of them recognizes it
+func (p *fallback) RegisterShare(gif Gif, query string) (bool, *model.AppError) {
+	for _, gifProvider := range p.providers {
+		if registered, err := RegisterShare(gifProvider, gif, query); registered || err != nil {
+			return registered, err
+		}
+	}
+	return false, nil
+}
+
+// Return true if one of the providers can search for this type of media
+func (p *fallback) SupportsMediaType(mediaType MediaType) bool {
+	for _, gifProvider := range p.providers {
+		if SupportsMediaType(gifProvider, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the suggestions of the first provider that can suggest keywords
+func (p *fallback) GetSearchSuggestions(query string) ([]string, *model.AppError) {
+	for _, gifProvider := range p.providers {
+		if _, ok := gifProvider.(SuggestionProvider); ok {
+			return GetSearchSuggestions(gifProvider, query)
+		}
+	}
+	return []string{}, nil
+}
+
+// Return the GIFs of the first provider that finds GIFs matching the request, or the error of the first provider if they all failed
+func (p *fallback) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	return p.findGifs(cursor, random, func(gifProvider GifProvider, providerCursor *string) ([]Gif, *model.AppError) {
+		return gifProvider.GetGifs(request, mediaType, providerCursor, random)
+	})
+}
+
+// Return the trending GIFs of the first provider that finds some, or the error of the first provider if they all failed
+func (p *fallback) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	return p.findGifs(cursor, false, func(gifProvider GifProvider, providerCursor *string) ([]Gif, *model.AppError) {
+		return gifProvider.GetTrendingGifs(providerCursor)
+	})
+}
+
+// findGifs calls search with each provider, starting with the one that served the last results, until one of them finds GIFs
+func (p *fallback) findGifs(cursor *string, random bool, search func(gifProvider GifProvider, providerCursor *string) ([]Gif, *model.AppError)) ([]Gif, *model.AppError) {
+	state := p.parseCursor(*cursor)
+
+	var firstErr *model.AppError
+	for i := state.Next; i < len(p.providers); i++ {
+		providerCursor := state.Cursors[p.names[i]]
+		gifs, err := search(p.providers[i], &providerCursor)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if len(gifs) < 1 {
+			continue
+		}
+
+		state.Next = i
+		state.Cursors[p.names[i]] = providerCursor
+		if providerCursor == "" && !random {
+			// This provider has no more results: the next search will use the next providers
+			state.Next = i + 1
+		}
+		*cursor = ""
+		if state.Next < len(p.providers) {
+			*cursor = p.formatCursor(state)
+		}
+		return gifs, nil
+	}
+
+	if firstErr != nil {
+		return []Gif{}, firstErr
+	}
+	*cursor = ""
+	return []Gif{}, nil
+}
+
+func (p *fallback) parseCursor(cursor string) fallbackCursor {
+	state := fallbackCursor{}
+	if cursor != "" {
+		if err := json.Unmarshal([]byte(cursor), &state); err != nil || state.Next < 0 {
+			state = fallbackCursor{}
+		}
+	}
+	if state.Cursors == nil {
+		state.Cursors = map[string]string{}
+	}
+	return state
+}
+
+func (p *fallback) formatCursor(state fallbackCursor) string {
+	cursor, _ := json.Marshal(state)
+	return string(cursor)
+}
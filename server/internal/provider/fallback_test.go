@@ -0,0 +1,263 @@
+package provider
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// stubGifProvider returns the configured URLs and cursor, or fails if an error message is configured
+type stubGifProvider struct {
+	name         string
+	urls         []string
+	nextCursor   string
+	errorMessage string
+	attribution  string
+	calls        int
+	lastCursor   string
+}
+
+func (s *stubGifProvider) GetGifs(_ string, _ MediaType, cursor *string, _ bool) ([]Gif, *model.AppError) {
+	s.calls++
+	s.lastCursor = *cursor
+	if s.errorMessage != "" {
+		return []Gif{}, test.MockErrorGenerator().FromError(s.errorMessage, errors.New(s.errorMessage))
+	}
+	*cursor = s.nextCursor
+	gifs := []Gif{}
+	for _, url := range s.urls {
+		gif := NewGifFromURL(url)
+		gif.Provider = s.name
+		gifs = append(gifs, gif)
+	}
+	return gifs, nil
+}
+
+func (s *stubGifProvider) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	return s.GetGifs("", MediaTypeGif, cursor, false)
+}
+
+func (s *stubGifProvider) GetAttributionMessage() string {
+	return s.attribution
+}
+
+func generateFallbackProviderForTest(primary, secondary *stubGifProvider) GifProvider {
+	primary.name, secondary.name = "giphy", "tenor"
+	provider, _ := NewFallbackProvider(test.MockErrorGenerator(), []string{"giphy", "tenor"}, []GifProvider{primary, secondary})
+	return provider
+}
+
+func TestNewFallbackProvider(t *testing.T) {
+	stub := &stubGifProvider{}
+	testCases := []struct {
+		testLabel      string
+		paramNames     []string
+		paramProviders []GifProvider
+		expectedError  bool
+	}{
+		{testLabel: "OK", paramNames: []string{"giphy", "tenor"}, paramProviders: []GifProvider{stub, stub}, expectedError: false},
+		{testLabel: "KO no provider", paramNames: []string{}, paramProviders: []GifProvider{}, expectedError: true},
+		{testLabel: "KO missing name", paramNames: []string{"giphy"}, paramProviders: []GifProvider{stub, stub}, expectedError: true},
+		{testLabel: "KO nil provider", paramNames: []string{"giphy", "tenor"}, paramProviders: []GifProvider{stub, nil}, expectedError: true},
+	}
+	for _, testCase := range testCases {
+		provider, err := NewFallbackProvider(test.MockErrorGenerator(), testCase.paramNames, testCase.paramProviders)
+		if testCase.expectedError {
+			assert.NotNil(t, err, testCase.testLabel)
+			assert.Nil(t, provider, testCase.testLabel)
+		} else {
+			assert.Nil(t, err, testCase.testLabel)
+			assert.NotNil(t, provider, testCase.testLabel)
+		}
+	}
+}
+
+func TestFallbackProviderGetGifURLShouldUsePrimaryProviderWhenItSucceeds(t *testing.T) {
+	primary := &stubGifProvider{urls: []string{"giphy1"}, nextCursor: "1", attribution: "GIPHY"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}, nextCursor: "t1", attribution: "Tenor"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"giphy1"}, getGifURLs(gifs))
+	assert.Equal(t, 0, secondary.calls)
+	assert.Equal(t, "GIPHY", GetAttributionMessageForGif(p, gifs[0]))
+
+	// The next page is requested to the same provider with its own cursor
+	_, err = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, primary.calls)
+	assert.Equal(t, "1", primary.lastCursor)
+}
+
+func TestFallbackProviderGetGifURLShouldFallbackWhenPrimaryProviderFails(t *testing.T) {
+	primary := &stubGifProvider{errorMessage: "HTTP Status: 429", attribution: "GIPHY"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}, nextCursor: "t1", attribution: "Tenor"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tenor1"}, getGifURLs(gifs))
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(p, gifs[0]))
+
+	// The next page is requested to the provider that served the last results
+	_, err = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 2, secondary.calls)
+	assert.Equal(t, "t1", secondary.lastCursor)
+}
+
+func TestFallbackProviderGetGifURLShouldFallbackWhenPrimaryProviderFindsNothing(t *testing.T) {
+	primary := &stubGifProvider{urls: []string{}, attribution: "GIPHY"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}, nextCursor: "t1", attribution: "Tenor"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tenor1"}, getGifURLs(gifs))
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(p, gifs[0]))
+}
+
+func TestFallbackProviderGetGifURLShouldUseNextProviderWhenResultsAreExhausted(t *testing.T) {
+	primary := &stubGifProvider{urls: []string{"giphy1"}, nextCursor: "", attribution: "GIPHY"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}, nextCursor: "", attribution: "Tenor"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, _ := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Equal(t, []string{"giphy1"}, getGifURLs(gifs))
+	assert.Equal(t, "GIPHY", GetAttributionMessageForGif(p, gifs[0]))
+	assert.NotEmpty(t, cursor)
+	gifs, _ = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Equal(t, []string{"tenor1"}, getGifURLs(gifs))
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(p, gifs[0]))
+	// The last provider has no more results, so there is no next page
+	assert.Equal(t, "", cursor)
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 1, secondary.calls)
+}
+
+func TestFallbackProviderGetAttributionMessageForGifShouldDefaultToThePrimaryProvider(t *testing.T) {
+	p := generateFallbackProviderForTest(&stubGifProvider{attribution: "GIPHY"}, &stubGifProvider{attribution: "Tenor"})
+
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(p, Gif{URL: "tenor1", Provider: "tenor"}))
+	assert.Equal(t, "GIPHY", GetAttributionMessageForGif(p, NewGifFromURL("saved")))
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(NewCachedGifProvider(p, NewGifCache(10, time.Minute, nil), "fallback"), Gif{URL: "tenor1", Provider: "tenor"}))
+}
+
+func TestFallbackProviderGetGifURLShouldReturnFirstErrorWhenAllProvidersFail(t *testing.T) {
+	primary := &stubGifProvider{errorMessage: "giphy failure"}
+	secondary := &stubGifProvider{errorMessage: "tenor failure"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "giphy failure")
+	assert.Empty(t, gifs)
+}
+
+func TestFallbackProviderGetGifURLShouldIgnoreInvalidCursor(t *testing.T) {
+	primary := &stubGifProvider{urls: []string{"giphy1"}, nextCursor: "1"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := "42"
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"giphy1"}, getGifURLs(gifs))
+	assert.Equal(t, "", primary.lastCursor)
+}
+
+// stubSuggestionProvider also suggests the configured keywords
+type stubSuggestionProvider struct {
+	stubGifProvider
+	suggestions     []string
+	suggestionCalls int
+}
+
+func (s *stubSuggestionProvider) GetSearchSuggestions(_ string) ([]string, *model.AppError) {
+	s.suggestionCalls++
+	return s.suggestions, nil
+}
+
+func TestFallbackProviderGetSearchSuggestionsShouldUseFirstProviderWithSuggestions(t *testing.T) {
+	primary := &stubGifProvider{}
+	secondary := &stubSuggestionProvider{suggestions: []string{"happy"}}
+	p, _ := NewFallbackProvider(test.MockErrorGenerator(), []string{"local", "tenor"}, []GifProvider{primary, secondary})
+
+	suggestions, err := GetSearchSuggestions(p, "hap")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"happy"}, suggestions)
+}
+
+func TestGetSearchSuggestionsShouldReturnNothingWhenProviderHasNoSuggestion(t *testing.T) {
+	suggestions, err := GetSearchSuggestions(&stubGifProvider{}, "hap")
+	assert.Nil(t, err)
+	assert.Empty(t, suggestions)
+}
+
+func TestFallbackProviderGetTrendingGifURLShouldFallbackWhenPrimaryProviderFails(t *testing.T) {
+	primary := &stubGifProvider{errorMessage: "not supported", attribution: "custom"}
+	secondary := &stubGifProvider{urls: []string{"tenor1"}, nextCursor: "t1", attribution: "Tenor"}
+	p := generateFallbackProviderForTest(primary, secondary)
+
+	cursor := ""
+	gifs, err := p.GetTrendingGifs(&cursor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"tenor1"}, getGifURLs(gifs))
+	assert.Equal(t, "Tenor", GetAttributionMessageForGif(p, gifs[0]))
+}
+
+func TestFallbackProviderGetStillURLShouldUseTheProviderThatRecognizesTheGif(t *testing.T) {
+	giphyProvider := generateGiphyProviderForTest(newServerResponseOK(defaultGiphyResponseBodyForSearch))
+	p, _ := NewFallbackProvider(test.MockErrorGenerator(), []string{"tenor", "giphy"}, []GifProvider{&stubGifProvider{}, giphyProvider})
+	cached := NewCachedGifProvider(p, NewGifCache(10, time.Hour, nil), "tenor,giphy")
+
+	assert.Equal(t, "https://media.giphy.com/media/abc/100_s.gif", GetStillURL(cached, "https://media.giphy.com/media/abc/100.gif"))
+	assert.Equal(t, "https://media.tenor.com/abc/cat.gif", GetStillURL(cached, "https://media.tenor.com/abc/cat.gif"))
+}
+
+func TestFallbackProviderRegisterShareShouldUseTheProviderThatRecognizesTheGif(t *testing.T) {
+	tenorProvider, client, _ := generateTenorProviderForURLBuildingTests()
+	client.response = newServerResponseOK(`{"status": "ok"}`)
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/registershare")
+	}
+	giphyProvider := generateGiphyProviderForTest(newServerResponseOK(defaultGiphyResponseBodyForSearch))
+	p, _ := NewFallbackProvider(test.MockErrorGenerator(), []string{"giphy", "custom", "tenor"}, []GifProvider{giphyProvider, &stubGifProvider{}, tenorProvider})
+	cached := NewCachedGifProvider(p, NewGifCache(10, time.Hour, nil), "giphy,custom,tenor")
+
+	registered, err := RegisterShare(cached, Gif{ID: "4242", URL: "https://media.tenor.com/abc/cat.gif"}, "cat")
+	assert.True(t, registered)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+
+	registered, err = RegisterShare(cached, NewGifFromURL("https://gifs.example.com/cat.gif"), "cat")
+	assert.False(t, registered)
+	assert.Nil(t, err)
+}
+
+func TestSupportsMediaType(t *testing.T) {
+	assert.True(t, SupportsMediaType(&giphy{}, MediaTypeSticker))
+	assert.False(t, SupportsMediaType(&giphy{}, MediaTypeClip))
+	assert.True(t, SupportsMediaType(&tenor{}, MediaTypeClip))
+	assert.True(t, SupportsMediaType(&local{}, MediaTypeGif))
+	assert.False(t, SupportsMediaType(&local{}, MediaTypeSticker))
+
+	fallbackProvider, err := NewFallbackProvider(test.MockErrorGenerator(), []string{"giphy", "tenor"}, []GifProvider{&giphy{}, &tenor{}})
+	assert.Nil(t, err)
+	assert.True(t, SupportsMediaType(NewCachedGifProvider(fallbackProvider, NewGifCache(10, time.Minute, nil), "fallback"), MediaTypeClip))
+}
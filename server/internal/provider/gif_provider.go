@@ -2,6 +2,9 @@ package provider
 
 import (
 	"net/http"
+	"net/url"
+	"path"
+	"strings"
 
 	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
 	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
@@ -9,10 +12,75 @@ import (
 	"github.com/mattermost/mattermost/server/public/model"
 )
 
+// MediaType is the kind of media searched for: animated GIFs, stickers (GIFs with a transparent background) or short clips
+type MediaType string
+
+const (
+	MediaTypeGif     MediaType = pluginConf.MediaTypeGif
+	MediaTypeSticker MediaType = pluginConf.MediaTypeSticker
+	MediaTypeClip    MediaType = pluginConf.MediaTypeClip
+)
+
+// Gif is a media found by a GIF provider
+type Gif struct {
+	// ID identifies the GIF for its provider, or is the URL of the GIF if the provider doesn't identify its GIFs
+	ID string `json:"id"`
+	// Title is the name of the GIF, when the provider gives one
+	Title string `json:"title,omitempty"`
+	// Description is the text alternative of the GIF, when the provider gives one
+	Description string `json:"description,omitempty"`
+	// PageURL is the page of the GIF on the website of the provider
+	PageURL string `json:"pageUrl,omitempty"`
+	// URL is the URL of the rendition configured for the provider
+	URL string `json:"url"`
+	// Renditions are the versions of the GIF returned by the provider, by rendition name
+	Renditions map[string]Rendition `json:"renditions,omitempty"`
+	// SentEventURL must be called when the GIF is posted, when the provider gives one
+	SentEventURL string `json:"sentEventUrl,omitempty"`
+	// StillURL is a still image of the GIF, when the provider gives one with the results
+	StillURL string `json:"stillUrl,omitempty"`
+	// Provider is the name of the provider that found the GIF, empty for a GIF only known by its URL
+	Provider string `json:"provider,omitempty"`
+}
+
+// videoExtensions are the file extensions of the media that are short videos rather than animated images, like the clips
+var videoExtensions = []string{".mp4", ".webm"}
+
+// IsVideo returns true if the URL of the GIF is a video, that can't be displayed as an image
+func (g Gif) IsVideo() bool {
+	parsedURL, err := url.Parse(g.URL)
+	if err != nil {
+		return false
+	}
+	extension := strings.ToLower(path.Ext(parsedURL.Path))
+	for _, videoExtension := range videoExtensions {
+		if extension == videoExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// Rendition is a version of a GIF in a given format or size. The dimensions and size are 0 when the provider doesn't give them.
+type Rendition struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Size   int    `json:"size,omitempty"`
+}
+
+// NewGifFromURL returns a GIF only known by its URL
+func NewGifFromURL(gifURL string) Gif {
+	return Gif{ID: gifURL, URL: gifURL}
+}
+
 // GifProvider exposes methods to get GIF from an API
 type GifProvider interface {
-	// GetGifURL return the URL of a GIF that matches the requested keywords if one is found or else an empty string
-	GetGifURL(request string, cursor *string, random bool) ([]string, *model.AppError)
+	// GetGifs return the media of the given type that match the requested keywords, or an empty list if none is found
+	GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError)
+
+	// GetTrendingGifs return the GIFs that are currently popular, or an error if the provider can't find them
+	GetTrendingGifs(cursor *string) ([]Gif, *model.AppError)
 
 	// GetAttributionMessage returns the text that should be displayed near the GIF, as defined by the providers' Terms of Service
 	GetAttributionMessage() string
@@ -24,6 +92,10 @@ type HTTPClient interface {
 	Get(s string) (*http.Response, error)
 }
 
+// ResultFilter returns true if a result must be excluded from the search results, given the texts
+// that describe it in the response of the provider (title, tags, user name, etc.)
+type ResultFilter func(texts []string) bool
+
 type Query struct {
 	Keywords string
 	Cursor   string
@@ -36,19 +108,73 @@ type abstractGifProvider struct {
 	language       string
 	rating         string
 	rendition      string
+	resultFilter   ResultFilter
+}
+
+// isExcluded returns true if the result described by the texts must be excluded from the search results
+func (p *abstractGifProvider) isExcluded(texts ...string) bool {
+	return p.resultFilter != nil && p.resultFilter(texts)
+}
+
+// filterableGifProvider is implemented by the providers whose responses describe the GIFs, so their results can be filtered
+type filterableGifProvider interface {
+	setResultFilter(resultFilter ResultFilter)
 }
 
-func defaultGifProviderGenerator(configuration pluginConf.Configuration, errorGenerator pluginError.PluginError, rootURL string) (gifProvider GifProvider, err *model.AppError) {
+// defaultGifProviderGenerator creates the providers of the configuration. The results of the Giphy and Tenor
+// searches are filtered by the result filter, if any.
+func defaultGifProviderGenerator(configuration pluginConf.Configuration, errorGenerator pluginError.PluginError, rootURL string, resultFilter ResultFilter) (GifProvider, *model.AppError) {
 	if configuration.Provider == "" {
 		return nil, errorGenerator.FromMessage("The GIF provider must be configured")
 	}
-	switch configuration.Provider {
+	names := configuration.GetProviderChain()
+	providers := []GifProvider{}
+	for _, name := range names {
+		gifProvider, err := newGifProvider(name, configuration, errorGenerator, rootURL)
+		if err != nil {
+			return nil, err
+		}
+		if filterable, ok := gifProvider.(filterableGifProvider); ok {
+			filterable.setResultFilter(resultFilter)
+		}
+		providers = append(providers, gifProvider)
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewFallbackProvider(errorGenerator, names, providers)
+}
+
+func newGifProvider(name string, configuration pluginConf.Configuration, errorGenerator pluginError.PluginError, rootURL string) (gifProvider GifProvider, err *model.AppError) {
+	switch name {
 	case "giphy":
-		gifProvider, err = NewGiphyProvider(http.DefaultClient, errorGenerator, configuration.APIKey, configuration.Language, configuration.Rating, configuration.Rendition, rootURL)
+		gifProvider, err = NewGiphyProvider(http.DefaultClient, errorGenerator, configuration.GetAPIKey(name), configuration.Language, configuration.Rating, configuration.Rendition, rootURL)
 	case "tenor":
-		gifProvider, err = NewTenorProvider(http.DefaultClient, errorGenerator, configuration.APIKey, configuration.Language, configuration.Rating, configuration.RenditionTenor)
+		gifProvider, err = NewTenorProvider(http.DefaultClient, errorGenerator, configuration.GetAPIKey(name), configuration.Language, configuration.Rating, configuration.RenditionTenor)
+	case "local":
+		gifProvider, err = NewLocalProvider(errorGenerator, configuration.LocalLibraryDirectory, rootURL)
+	case "custom":
+		mapping := CustomAPIMapping{
+			URL:               configuration.CustomAPIURL,
+			QueryParameter:    configuration.CustomAPIQueryParameter,
+			CursorParameter:   configuration.CustomAPICursorParameter,
+			RatingParameter:   configuration.CustomAPIRatingParameter,
+			LanguageParameter: configuration.CustomAPILanguageParameter,
+			APIKeyParameter:   configuration.CustomAPIKeyParameter,
+			ResultsPath:       configuration.CustomAPIResultsPath,
+			GifURLPath:        configuration.CustomAPIGifURLPath,
+			NextCursorPath:    configuration.CustomAPINextCursorPath,
+		}
+		gifProvider, err = NewCustomProvider(http.DefaultClient, errorGenerator, mapping, configuration.GetAPIKey(name), configuration.Language, configuration.Rating)
+	default:
+		err = errorGenerator.FromMessage("Unknown GIF provider: " + name)
 	}
 	return gifProvider, err
 }
 
 var GifProviderGenerator = defaultGifProviderGenerator
+
+// newUnsupportedMediaTypeError returns the error of a provider that can't search for this type of media
+func newUnsupportedMediaTypeError(errorGenerator pluginError.PluginError, mediaType MediaType, providerName string) *model.AppError {
+	return errorGenerator.FromMessage("Searching for the media type '" + string(mediaType) + "' is not supported by the " + providerName + " provider")
+}
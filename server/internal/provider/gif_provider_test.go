@@ -20,17 +20,23 @@ func TestDefaultGifProviderGenerator(t *testing.T) {
 		{testLabel: "Empty provider", providerType: "", expectedError: true, expectedType: nil},
 		{testLabel: "Giphyprovider", providerType: "giphy", expectedError: false, expectedType: &giphy{}},
 		{testLabel: "Tenor provider", providerType: "tenor", expectedError: false, expectedType: tenor{}},
+		{testLabel: "Local provider", providerType: "local", expectedError: false, expectedType: &local{}},
+		{testLabel: "Custom provider", providerType: "custom", expectedError: false, expectedType: &custom{}},
 	}
 
 	for _, testCase := range testCases {
 		testConfig := pluginConf.Configuration{Provider: testCase.providerType,
-			APIKey:         testGiphyAPIKey,
-			Language:       testGiphyLanguage,
-			Rating:         testGiphyRating,
-			Rendition:      testGiphyRendition,
-			RenditionTenor: testTenorRendition,
+			APIKey:                  testGiphyAPIKey,
+			Language:                testGiphyLanguage,
+			Rating:                  testGiphyRating,
+			Rendition:               testGiphyRendition,
+			RenditionTenor:          testTenorRendition,
+			LocalLibraryDirectory:   "/tmp",
+			CustomAPIURL:            "https://gifs.test/search",
+			CustomAPIQueryParameter: "q",
+			CustomAPIGifURLPath:     "url",
 		}
-		provider, err := defaultGifProviderGenerator(testConfig, test.MockErrorGenerator(), "/test")
+		provider, err := defaultGifProviderGenerator(testConfig, test.MockErrorGenerator(), "/test", nil)
 		if testCase.expectedError {
 			assert.NotNil(t, err, testCase.testLabel)
 			assert.Nil(t, provider, testCase.testLabel)
@@ -41,3 +47,51 @@ func TestDefaultGifProviderGenerator(t *testing.T) {
 		}
 	}
 }
+
+func TestDefaultGifProviderGeneratorWithFallbackProviders(t *testing.T) {
+	testConfig := pluginConf.Configuration{Provider: "giphy",
+		APIKey:            testGiphyAPIKey,
+		TenorAPIKey:       testTenorAPIKey,
+		FallbackProviders: "tenor, giphy",
+		Rendition:         testGiphyRendition,
+		RenditionTenor:    testTenorRendition,
+	}
+	provider, err := defaultGifProviderGenerator(testConfig, test.MockErrorGenerator(), "/test", nil)
+	assert.Nil(t, err)
+	assert.IsType(t, &fallback{}, provider)
+	assert.Equal(t, []string{"giphy", "tenor"}, provider.(*fallback).names)
+	assert.Equal(t, testGiphyAPIKey, provider.(*fallback).providers[0].(*giphy).apiKey)
+	assert.Equal(t, testTenorAPIKey, provider.(*fallback).providers[1].(*tenor).apiKey)
+}
+
+func TestDefaultGifProviderGeneratorWithUnknownFallbackProvider(t *testing.T) {
+	testConfig := pluginConf.Configuration{Provider: "giphy",
+		APIKey:            testGiphyAPIKey,
+		FallbackProviders: "unknown",
+		Rendition:         testGiphyRendition,
+	}
+	provider, err := defaultGifProviderGenerator(testConfig, test.MockErrorGenerator(), "/test", nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, provider)
+}
+
+func TestDefaultGifProviderGeneratorShouldSetResultFilter(t *testing.T) {
+	testConfig := pluginConf.Configuration{Provider: "giphy",
+		APIKey:            testGiphyAPIKey,
+		TenorAPIKey:       testTenorAPIKey,
+		FallbackProviders: "tenor",
+		Rendition:         testGiphyRendition,
+		RenditionTenor:    testTenorRendition,
+	}
+	provider, err := defaultGifProviderGenerator(testConfig, test.MockErrorGenerator(), "/test", func(_ []string) bool { return true })
+	assert.Nil(t, err)
+	assert.True(t, provider.(*fallback).providers[0].(*giphy).isExcluded("kitty"))
+	assert.True(t, provider.(*fallback).providers[1].(*tenor).isExcluded("kitty"))
+}
+
+func TestGifIsVideo(t *testing.T) {
+	assert.True(t, NewGifFromURL("https://media.tenor.com/abc/cat.mp4").IsVideo())
+	assert.True(t, NewGifFromURL("https://example.com/clip.WEBM?token=1").IsVideo())
+	assert.False(t, NewGifFromURL("https://media.giphy.com/media/abc/giphy.gif").IsVideo())
+	assert.False(t, NewGifFromURL("https://example.com/mp4").IsVideo())
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
 
@@ -20,13 +22,38 @@ type giphy struct {
 }
 
 const (
-	baseURLGiphy = "https://api.giphy.com/v1/gifs"
+	baseURLGiphy = "https://api.giphy.com/v1"
 )
 
+// giphyMediaPaths are the paths of the Giphy API for each supported media type
+var giphyMediaPaths = map[MediaType]string{
+	MediaTypeGif:     "gifs",
+	MediaTypeSticker: "stickers",
+}
+
 type GiphyData struct {
-	Images map[string]struct {
-		URL string `json:"url"`
-	} `json:"images"`
+	ID string `json:"id"`
+	// URL is the page of the GIF on the Giphy website
+	URL      string                `json:"url"`
+	Images   map[string]GiphyImage `json:"images"`
+	Title    string                `json:"title"`
+	Slug     string                `json:"slug"`
+	Username string                `json:"username"`
+	AltText  string                `json:"alt_text"`
+	// Analytics are the URLs that Giphy asks to call when the GIF is displayed, clicked or sent
+	Analytics struct {
+		OnSent struct {
+			URL string `json:"url"`
+		} `json:"onsent"`
+	} `json:"analytics"`
+}
+
+// GiphyImage is a rendition of a Giphy GIF: the API returns its dimensions and size as strings
+type GiphyImage struct {
+	URL    string `json:"url"`
+	Width  string `json:"width"`
+	Height string `json:"height"`
+	Size   string `json:"size"`
 }
 
 type GiphySearchResult struct {
@@ -36,6 +63,12 @@ type GiphySearchResult struct {
 	} `json:"pagination"`
 }
 
+type GiphyTagsResult struct {
+	Data []struct {
+		Name string `json:"name"`
+	} `json:"data"`
+}
+
 type GiphyRandomResult struct {
 	Data GiphyData `json:"data"`
 }
@@ -74,20 +107,34 @@ func NewGiphyProvider(httpClient HTTPClient, errorGenerator pluginError.PluginEr
 	return GiphyProvider, nil
 }
 
+func (p *giphy) setResultFilter(resultFilter ResultFilter) {
+	p.resultFilter = resultFilter
+}
+
 func (p *giphy) GetAttributionMessage() string {
 	return fmt.Sprintf("![GIPHY](%s/public/powered-by-giphy.png)", p.rootURL)
 }
 
-// Return the URL of a GIF that matches the query, or an empty string if no GIF matches the query, or an error if the search failed
-func (p *giphy) GetGifURL(request string, cursor *string, random bool) ([]string, *model.AppError) {
+// Return true for the GIFs and the stickers, as Giphy has no clips
+func (p *giphy) SupportsMediaType(mediaType MediaType) bool {
+	_, ok := giphyMediaPaths[mediaType]
+	return ok
+}
+
+// Return the GIFs that match the query, or an empty list if no GIF matches the query, or an error if the search failed
+func (p *giphy) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	mediaPath, ok := giphyMediaPaths[mediaType]
+	if !ok {
+		return []Gif{}, newUnsupportedMediaTypeError(p.errorGenerator, mediaType, "GIPHY")
+	}
 	if random {
-		return p.getRandomGifURL(request)
+		return p.getRandomGif(mediaPath, request)
 	}
-	return p.getSearchGifURL(request, cursor)
+	return p.getSearchGifs(mediaPath, request, cursor)
 }
 
-// Return the URL of a GIF that matches the query, or an empty string if no GIF matches the query, or an error if the search failed
-func (p *giphy) getSearchGifURL(request string, cursor *string) ([]string, *model.AppError) {
+// Return the GIFs that match the query, or an empty list if no GIF matches the query, or an error if the search failed
+func (p *giphy) getSearchGifs(mediaPath, request string, cursor *string) ([]Gif, *model.AppError) {
 	parameters := map[string]string{"q": request}
 	if counter, err2 := strconv.Atoi(*cursor); err2 == nil {
 		parameters["offset"] = fmt.Sprintf("%d", counter)
@@ -96,41 +143,60 @@ func (p *giphy) getSearchGifURL(request string, cursor *string) ([]string, *mode
 		parameters["lang"] = p.language
 	}
 
-	body, err := p.callGiphyEndpoint("search", parameters)
+	return p.getGifsFromEndpoint(mediaPath+"/search", parameters, cursor)
+}
+
+// Return the GIFs that are currently trending on Giphy, or an error if the search failed
+func (p *giphy) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	parameters := map[string]string{}
+	if counter, err := strconv.Atoi(*cursor); err == nil {
+		parameters["offset"] = fmt.Sprintf("%d", counter)
+	}
+	return p.getGifsFromEndpoint("gifs/trending", parameters, cursor)
+}
+
+// Return the GIFs listed by a paginated endpoint, and update the cursor to the next page
+func (p *giphy) getGifsFromEndpoint(endpoint string, parameters map[string]string, cursor *string) ([]Gif, *model.AppError) {
+	body, err := p.callGiphyEndpoint(endpoint, parameters)
 	if err != nil {
-		return []string{}, err
+		return []Gif{}, err
 	}
 
 	var response GiphySearchResult
 	if decodeErr := json.Unmarshal(body, &response); decodeErr != nil {
-		return []string{}, p.errorGenerator.FromError("Could not parse Giphy response body", decodeErr)
+		return []Gif{}, p.errorGenerator.FromError("Could not parse Giphy response body", decodeErr)
 	}
 
 	if len(response.Data) < 1 {
-		return []string{}, nil
+		return []Gif{}, nil
 	}
 
-	urls := []string{}
+	gifs := []Gif{}
+	excluded := 0
 	for i := range response.Data {
-		if url, err := p.getURL(response.Data[i]); err == nil {
-			urls = append(urls, url)
+		if p.isExcludedGif(response.Data[i]) {
+			excluded++
+			continue
+		}
+		if gif, err := p.getGif(response.Data[i]); err == nil {
+			gifs = append(gifs, gif)
 		}
 	}
 
-	if len(urls) < 1 {
-		return []string{}, p.errorGenerator.FromMessage("No gifs found for display style \"" + p.rendition + "\" in the response")
+	if len(gifs) < 1 && excluded < len(response.Data) {
+		return []Gif{}, p.errorGenerator.FromMessage("No gifs found for display style \"" + p.rendition + "\" in the response")
 	}
 
 	*cursor = fmt.Sprintf("%d", response.Pagination.Offset+1)
 
-	return urls, nil
+	return gifs, nil
 }
 
-// Return the URL of a random GIF that matches the query, or an empty string if no GIF matches the query, or an error if the search failed
-func (p *giphy) getRandomGifURL(request string) ([]string, *model.AppError) {
-	body, err := p.callGiphyEndpoint("random", map[string]string{"tag": request})
+// Return a random GIF that matches the query, or an empty list if no GIF matches the query, or an error if the search failed
+func (p *giphy) getRandomGif(mediaPath, request string) ([]Gif, *model.AppError) {
+	body, err := p.callGiphyEndpoint(mediaPath+"/random", map[string]string{"tag": request})
 	if err != nil {
-		return []string{}, err
+		return []Gif{}, err
 	}
 
 	var response GiphyRandomResult
@@ -139,16 +205,38 @@ func (p *giphy) getRandomGifURL(request string) ([]string, *model.AppError) {
 		var emptyResponse GiphyRandomEmptyResult
 		if err = json.Unmarshal(body, &emptyResponse); err == nil {
 			// No GIF found
-			return []string{}, nil
+			return []Gif{}, nil
 		}
-		return []string{}, p.errorGenerator.FromError("Could not parse Giphy response body", err)
+		return []Gif{}, p.errorGenerator.FromError("Could not parse Giphy response body", err)
 	}
 
-	url, err := p.getURL(response.Data)
+	if p.isExcludedGif(response.Data) {
+		return []Gif{}, nil
+	}
+	gif, err := p.getGif(response.Data)
+	if err != nil {
+		return []Gif{}, err
+	}
+	return []Gif{gif}, nil
+}
+
+// Return the tags suggested by the Giphy autocomplete for the beginning of a search
+func (p *giphy) GetSearchSuggestions(query string) ([]string, *model.AppError) {
+	body, err := p.callGiphyEndpoint("gifs/search/tags", map[string]string{"q": query})
 	if err != nil {
 		return []string{}, err
 	}
-	return []string{url}, nil
+
+	var response GiphyTagsResult
+	if decodeErr := json.Unmarshal(body, &response); decodeErr != nil {
+		return []string{}, p.errorGenerator.FromError("Could not parse Giphy response body", decodeErr)
+	}
+
+	suggestions := []string{}
+	for _, tag := range response.Data {
+		suggestions = append(suggestions, tag.Name)
+	}
+	return suggestions, nil
 }
 
 func (p *giphy) callGiphyEndpoint(endpoint string, customParameters map[string]string) ([]byte, *model.AppError) {
@@ -195,11 +283,74 @@ func (p *giphy) callGiphyEndpoint(endpoint string, customParameters map[string]s
 	return body, nil
 }
 
-func (p *giphy) getURL(gif GiphyData) (string, *model.AppError) {
-	url := gif.Images[p.rendition].URL
+// Call the analytics URL given by Giphy for the sent GIFs, with the time of the share as Giphy requires.
+// The GIFs without this URL don't come from Giphy, or from a search that Giphy doesn't track.
+func (p *giphy) RegisterShare(gif Gif, _ string) (bool, *model.AppError) {
+	if gif.SentEventURL == "" {
+		return false, nil
+	}
+	req, err := http.NewRequest("GET", gif.SentEventURL, nil)
+	if err != nil {
+		return true, p.errorGenerator.FromError("Could not generate the Giphy analytics URL", err)
+	}
+	q := req.URL.Query()
+	q.Set("ts", strconv.FormatInt(model.GetMillis(), 10))
+	req.URL.RawQuery = q.Encode()
+
+	r, err := p.httpClient.Do(req)
+	if err != nil {
+		return true, p.errorGenerator.FromError("Error calling the Giphy analytics", err)
+	}
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusNoContent {
+		return true, p.errorGenerator.FromMessage(fmt.Sprintf("Error calling the Giphy analytics (HTTP Status: %v)", r.Status))
+	}
+	return true, nil
+}
+
+// Return the URL of the still version of a Giphy GIF: every rendition has a still version, whose file name ends with _s
+func (p *giphy) GetStillURL(gifURL string) string {
+	parsedURL, err := url.Parse(gifURL)
+	if err != nil || !strings.HasSuffix(parsedURL.Hostname(), "giphy.com") ||
+		!strings.HasSuffix(parsedURL.Path, ".gif") || strings.HasSuffix(parsedURL.Path, "_s.gif") {
+		return gifURL
+	}
+	parsedURL.Path = strings.TrimSuffix(parsedURL.Path, ".gif") + "_s.gif"
+	return parsedURL.String()
+}
+
+// isExcludedGif returns true if the GIF must be excluded from the results because of its metadata
+func (p *giphy) isExcludedGif(gif GiphyData) bool {
+	return p.isExcluded(gif.Title, gif.Slug, gif.Username, gif.AltText)
+}
+
+// getGif returns the GIF with the URL of the configured rendition, or an error if the GIF doesn't have this rendition
+func (p *giphy) getGif(data GiphyData) (Gif, *model.AppError) {
+	url := data.Images[p.rendition].URL
 
 	if len(url) < 1 {
-		return "", p.errorGenerator.FromMessage("No URL found for display style \"" + p.rendition + "\" in the response")
+		return Gif{}, p.errorGenerator.FromMessage("No URL found for display style \"" + p.rendition + "\" in the response")
+	}
+	gif := Gif{ID: data.ID, Title: data.Title, Description: data.AltText, PageURL: data.URL, URL: url, Renditions: map[string]Rendition{}, SentEventURL: data.Analytics.OnSent.URL, Provider: "giphy"}
+	if gif.ID == "" {
+		gif.ID = url
+	}
+	for name, image := range data.Images {
+		// Some renditions are only videos, without a GIF URL
+		if image.URL != "" {
+			gif.Renditions[name] = Rendition{URL: image.URL, Width: atoiOrZero(image.Width), Height: atoiOrZero(image.Height), Size: atoiOrZero(image.Size)}
+		}
+	}
+	return gif, nil
+}
+
+// atoiOrZero returns the integer of the text, or 0 if it's not an integer
+func atoiOrZero(text string) int {
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0
 	}
-	return url, nil
+	return value
 }
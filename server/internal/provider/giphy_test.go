@@ -2,6 +2,7 @@ package provider
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
@@ -84,7 +85,7 @@ func TestGiphyProviderGetGifURLShouldHandleAPIErrors(t *testing.T) {
 	for _, random := range [2]bool{true, false} {
 		for _, testCase := range testCases {
 			p := generateGiphyProviderForTest(testCase.httpResponse)
-			url, err := p.GetGifURL("cat", &testCase.cursor, random)
+			url, err := p.GetGifs("cat", MediaTypeGif, &testCase.cursor, random)
 			assert.NotNil(t, err, testCase.testLabel)
 			assert.Contains(t, err.Error(), testCase.expectedError, testCase.testLabel)
 			assert.Empty(t, url, testCase.testLabel)
@@ -112,10 +113,33 @@ func TestGiphyProviderGetGifURLShouldReturnUrlWhenSearchSucceeds(t *testing.T) {
 	cursor := ""
 	for _, testCase := range generateSearchAndRandomTestCases(defaultGiphyResponseBodyForSearch, defaultGiphyResponseBodyForRandom) {
 		p := generateGiphyProviderForTest(testCase.httpResponse)
-		url, err := p.GetGifURL("cat", &cursor, testCase.random)
+		url, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
 		assert.Nil(t, err, testCase.label)
 		assert.NotEmpty(t, url, testCase.label)
-		assert.Equal(t, []string{"url"}, url, testCase.label)
+		assert.Equal(t, []string{"url"}, getGifURLs(url), testCase.label)
+	}
+}
+
+func TestGiphyProviderGetGifURLShouldReturnTheMetadataOfTheGifs(t *testing.T) {
+	gifData := `{"id": "abc42", "title": "Grumpy cat GIF", "alt_text": "A cat frowning at the camera", "url": "https://giphy.com/gifs/grumpy-cat-abc42",
+		"images": {"fixed_height_small": {"url": "https://media.giphy.com/small.gif", "width": "133", "height": "100", "size": "2048"}, "original": {"url": "https://media.giphy.com/original.gif", "width": "480"}, "looping": {"mp4": "https://media.giphy.com/looping.mp4"}}}`
+	cursor := ""
+	for _, testCase := range generateSearchAndRandomTestCases(`{"data": [`+gifData+`]}`, `{"data": `+gifData+`}`) {
+		p := generateGiphyProviderForTest(testCase.httpResponse)
+		gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
+		assert.Nil(t, err, testCase.label)
+		assert.Equal(t, []Gif{{
+			ID:          "abc42",
+			Title:       "Grumpy cat GIF",
+			Description: "A cat frowning at the camera",
+			PageURL:     "https://giphy.com/gifs/grumpy-cat-abc42",
+			URL:         "https://media.giphy.com/small.gif",
+			Renditions: map[string]Rendition{
+				"fixed_height_small": {URL: "https://media.giphy.com/small.gif", Width: 133, Height: 100, Size: 2048},
+				"original":           {URL: "https://media.giphy.com/original.gif", Width: 480},
+			},
+			Provider: "giphy",
+		}}, gifs, testCase.label)
 	}
 }
 
@@ -124,7 +148,7 @@ func TestGiphyProviderGetGifURLShouldReturnEmptyUrlWhenSearchReturnNoResult(t *t
 
 	for _, testCase := range generateSearchAndRandomTestCases("{\"data\": [] }", "{\"data\": [] }") {
 		p := generateGiphyProviderForTest(testCase.httpResponse)
-		url, err := p.GetGifURL("cat", &cursor, testCase.random)
+		url, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
 		assert.Nil(t, err, testCase.label)
 		assert.Empty(t, url, testCase.label)
 	}
@@ -135,7 +159,7 @@ func TestGiphyProviderGetGifURLShouldFailWhenNoURLForRendition(t *testing.T) {
 	for _, testCase := range generateSearchAndRandomTestCases(defaultGiphyResponseBodyForSearch, defaultGiphyResponseBodyForRandom) {
 		p := generateGiphyProviderForTest(testCase.httpResponse)
 		p.rendition = "unknown_rendition_style"
-		url, err := p.GetGifURL("cat", &cursor, testCase.random)
+		url, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
 		assert.NotNil(t, err, testCase.label)
 		if testCase.random {
 			assert.Contains(t, err.Error(), "No URL found for display style", testCase.label)
@@ -167,7 +191,7 @@ func TestGiphyProviderGetGifURLShouldUseSearchAPIWhenNotConfiguredForRandom(t *t
 		assert.Contains(t, req.URL.RawQuery, "q=cat")
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -180,7 +204,7 @@ func TestGiphyProviderGetGifURLShouldUseRandomAPIWhenConfiguredForRandom(t *test
 		assert.Contains(t, req.URL.RawQuery, "tag=cat")
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, true)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, true)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -194,7 +218,7 @@ func TestGiphyProviderGetGifURLUsesParameterAPIKey(t *testing.T) {
 			assert.Contains(t, req.URL.RawQuery, "api_key="+testGiphyAPIKey)
 			return true
 		}
-		_, err := p.GetGifURL("cat", &cursor, testCase.random)
+		_, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
 		assert.Nil(t, err, testCase.label)
 		assert.True(t, client.lastRequestPassTest, testCase.label)
 	}
@@ -210,7 +234,7 @@ func TestGiphyProviderGetGifURLWhenNoRandomAndCursorIsEmpty(t *testing.T) {
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 	assert.Equal(t, "1", cursor)
@@ -226,7 +250,7 @@ func TestGiphyProviderGetGifURLWhenNoRandomAndCursorIsZero(t *testing.T) {
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 	assert.Equal(t, "1", cursor)
@@ -242,7 +266,7 @@ func TestGiphyProviderGetGifURLWhenNoRandomAndCursorIsNotANumber(t *testing.T) {
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 	assert.Equal(t, "1", cursor)
@@ -257,7 +281,7 @@ func TestGiphyProviderGetGifURLShouldApplyRatingFilterWhenUnset(t *testing.T) {
 			return true
 		}
 
-		_, err := p.GetGifURL("cat", &cursor, testCase.random)
+		_, err := p.GetGifs("cat", MediaTypeGif, &cursor, testCase.random)
 		assert.Nil(t, err, testCase.label)
 		assert.True(t, client.lastRequestPassTest, testCase.label)
 	}
@@ -271,7 +295,7 @@ func TestGiphyProviderGetGifURLShouldApplyRatingFilterWhenNoRandomAndRatingFilte
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -284,7 +308,7 @@ func TestGiphyProviderGetGifURLShouldNotApplyLanguageFilterWhenNoRandomAndNoLang
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -297,7 +321,159 @@ func TestGiphyProviderGetGifURLShouldApplyLanguageFilterWhenNoRandomAndLanguageS
 		return true
 	}
 
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestGiphyProviderGetSearchSuggestionsShouldReturnTags(t *testing.T) {
+	client := NewMockHTTPClient(newServerResponseOK(`{"data": [{"name": "happy"}, {"name": "happy dance"}]}`))
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/search/tags") && req.URL.Query().Get("q") == "hap"
+	}
+	provider, _ := NewGiphyProvider(client, test.MockErrorGenerator(), testGiphyAPIKey, testGiphyLanguage, testGiphyRating, testGiphyRendition, testRootURL)
+
+	suggestions, err := GetSearchSuggestions(provider, "hap")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"happy", "happy dance"}, suggestions)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestGiphyProviderGetSearchSuggestionsShouldFailWhenAPIFails(t *testing.T) {
+	p := generateGiphyProviderForTest(newServerResponseKO(429))
+	suggestions, err := p.GetSearchSuggestions("hap")
+	assert.NotNil(t, err)
+	assert.Empty(t, suggestions)
+}
+
+func TestGiphyProviderGetTrendingGifURLShouldCallTrendingEndpointWithCursor(t *testing.T) {
+	p, client, _ := generateGiphyProviderForURLBuildingTests(false)
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/trending") && req.URL.Query().Get("offset") == "25" && req.URL.Query().Get("q") == ""
+	}
+
+	cursor := "25"
+	gifs, err := p.GetTrendingGifs(&cursor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"url"}, getGifURLs(gifs))
+	assert.Equal(t, "1", cursor)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestGiphyProviderGetGifURLShouldCallStickersEndpointsForStickers(t *testing.T) {
+	for _, random := range []bool{false, true} {
+		p, client, cursor := generateGiphyProviderForURLBuildingTests(random)
+		expectedPath := "/v1/stickers/search"
+		if random {
+			expectedPath = "/v1/stickers/random"
+		}
+		client.testRequestFunc = func(req *http.Request) bool {
+			return req.URL.Path == expectedPath
+		}
+		_, err := p.GetGifs("cat", MediaTypeSticker, &cursor, random)
+		assert.Nil(t, err)
+		assert.True(t, client.lastRequestPassTest, expectedPath)
+	}
+}
+
+func TestGiphyProviderGetGifURLShouldRefuseClips(t *testing.T) {
+	p, client, cursor := generateGiphyProviderForURLBuildingTests(false)
+	gifs, err := p.GetGifs("cat", MediaTypeClip, &cursor, false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "not supported")
+	assert.Empty(t, gifs)
+	assert.False(t, client.lastRequestPassTest)
+}
+
+func TestGiphyProviderGetStillURL(t *testing.T) {
+	p := generateGiphyProviderForTest(newServerResponseOK(defaultGiphyResponseBodyForSearch))
+	testCases := []struct {
+		gifURL           string
+		expectedStillURL string
+	}{
+		{gifURL: "https://media2.giphy.com/media/abc/100.gif?cid=42", expectedStillURL: "https://media2.giphy.com/media/abc/100_s.gif?cid=42"},
+		{gifURL: "https://media.giphy.com/media/abc/giphy.gif", expectedStillURL: "https://media.giphy.com/media/abc/giphy_s.gif"},
+		{gifURL: "https://media.giphy.com/media/abc/100_s.gif", expectedStillURL: "https://media.giphy.com/media/abc/100_s.gif"},
+		{gifURL: "https://media.tenor.com/abc/cat.gif", expectedStillURL: "https://media.tenor.com/abc/cat.gif"},
+	}
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expectedStillURL, p.GetStillURL(testCase.gifURL), testCase.gifURL)
+	}
+}
+
+func TestGiphyProviderGetGifURLShouldExcludeFilteredResults(t *testing.T) {
+	body := `{"data": [
+		{"title": "Angry cat", "username": "catlover", "images": {"fixed_height_small": {"url": "url1"}}},
+		{"title": "Happy kitty", "images": {"fixed_height_small": {"url": "url2"}}}
+	], "pagination": {"offset": 0}}`
+	p := generateGiphyProviderForTest(newServerResponseOK(body))
+	var filteredTexts []string
+	p.setResultFilter(func(texts []string) bool {
+		filteredTexts = append(filteredTexts, texts...)
+		return strings.Contains(strings.Join(texts, " "), "Angry")
+	})
+	cursor := ""
+
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"url2"}, getGifURLs(gifs))
+	assert.Contains(t, filteredTexts, "catlover")
+	assert.Equal(t, "1", cursor)
+}
+
+func TestGiphyProviderGetGifURLShouldReturnNoResultWhenAllResultsAreFiltered(t *testing.T) {
+	for _, random := range []bool{false, true} {
+		body := defaultGiphyResponseBodyForSearch
+		if random {
+			body = defaultGiphyResponseBodyForRandom
+		}
+		p := generateGiphyProviderForTest(newServerResponseOK(body))
+		p.setResultFilter(func(_ []string) bool { return true })
+		cursor := ""
+
+		gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, random)
+
+		assert.Nil(t, err)
+		assert.Empty(t, gifs)
+	}
+}
+
+func TestGiphyProviderGetGifURLShouldReturnTheSentEventURL(t *testing.T) {
+	p := generateGiphyProviderForTest(newServerResponseOK(`{"data": [{"id": "abc42", "images": {"fixed_height_small": {"url": "url"}},
+		"analytics": {"onload": {"url": "https://giphy-analytics.giphy.com/onload"}, "onsent": {"url": "https://giphy-analytics.giphy.com/onsent?id=abc42"}}}]}`))
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://giphy-analytics.giphy.com/onsent?id=abc42", gifs[0].SentEventURL)
+}
+
+func TestGiphyProviderRegisterShareShouldCallTheSentEventURL(t *testing.T) {
+	p, client, _ := generateGiphyProviderForURLBuildingTests(false)
+	client.testRequestFunc = func(req *http.Request) bool {
+		return req.URL.Host == "giphy-analytics.giphy.com" && req.URL.Query().Get("id") == "abc42" && req.URL.Query().Get("ts") != ""
+	}
+
+	registered, err := p.RegisterShare(Gif{ID: "abc42", URL: "url", SentEventURL: "https://giphy-analytics.giphy.com/onsent?id=abc42"}, "cat")
+	assert.True(t, registered)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
+
+func TestGiphyProviderRegisterShareShouldIgnoreGifsWithoutSentEventURL(t *testing.T) {
+	p, client, _ := generateGiphyProviderForURLBuildingTests(false)
+	client.testRequestFunc = func(_ *http.Request) bool { return true }
+
+	registered, err := p.RegisterShare(NewGifFromURL("https://media.giphy.com/media/abc42/giphy.gif"), "cat")
+	assert.False(t, registered)
+	assert.Nil(t, err)
+	assert.False(t, client.lastRequestPassTest)
+}
+
+func TestGiphyProviderRegisterShareShouldFailWhenTheAnalyticsFail(t *testing.T) {
+	p := generateGiphyProviderForTest(newServerResponseKO(500))
+
+	registered, err := p.RegisterShare(Gif{ID: "abc42", URL: "url", SentEventURL: "https://giphy-analytics.giphy.com/onsent"}, "cat")
+	assert.True(t, registered)
+	assert.NotNil(t, err)
+}
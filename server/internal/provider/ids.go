@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"net/url"
+	"strings"
+)
+
+// gifIDHosts are the domains of the providers whose GIF URLs contain the ID of the GIF, as the folder of the file
+var gifIDHosts = map[string]string{
+	"giphy.com": "giphy",
+	"tenor.com": "tenor",
+}
+
+// GetGifKey returns an ID of the GIF that is the same for all its renditions: the name of its provider and its ID,
+// or else the ID returned by GetGifID for a GIF only known by its URL
+func GetGifKey(gif Gif) string {
+	if gif.Provider == "" || gif.ID == "" || gif.ID == gif.URL {
+		return GetGifID(gif.URL)
+	}
+	return gif.Provider + ":" + gif.ID
+}
+
+// GetGifID returns an ID of the GIF of the URL that doesn't depend on the server or the query of the URL:
+// the provider and the media ID for the GIPHY and Tenor URLs, or else the URL without its query.
+// The GIPHY media ID is the ID of the GIF, but the Tenor one only identifies the rendition of the URL.
+func GetGifID(gifURL string) string {
+	parsedURL, err := url.Parse(gifURL)
+	if err != nil {
+		return gifURL
+	}
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	for host, name := range gifIDHosts {
+		hostname := parsedURL.Hostname()
+		if (hostname == host || strings.HasSuffix(hostname, "."+host)) && len(segments) >= 2 {
+			return name + ":" + segments[len(segments)-2]
+		}
+	}
+	parsedURL.RawQuery = ""
+	parsedURL.Fragment = ""
+	return parsedURL.String()
+}
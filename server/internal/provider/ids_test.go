@@ -0,0 +1,28 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetGifID(t *testing.T) {
+	testCases := map[string]string{
+		"https://media0.giphy.com/media/v1.Y2lkPTc5/3o7TKSjRrfIPjeiVyM/giphy.gif?cid=42&rid=giphy.gif": "giphy:3o7TKSjRrfIPjeiVyM",
+		"https://media.giphy.com/media/3o7TKSjRrfIPjeiVyM/200.gif":                                     "giphy:3o7TKSjRrfIPjeiVyM",
+		"https://media.tenor.com/x8v1oNUOmg4AAAAC/rickroll.gif":                                        "tenor:x8v1oNUOmg4AAAAC",
+		"https://gifs.test/media/kitty.gif?size=small":                                                 "https://gifs.test/media/kitty.gif",
+		"https://notgiphy.com/a/b.gif":                                                                 "https://notgiphy.com/a/b.gif",
+		"/plugins/giphy/local/kitty.gif":                                                               "/plugins/giphy/local/kitty.gif",
+	}
+	for gifURL, expectedID := range testCases {
+		assert.Equal(t, expectedID, GetGifID(gifURL), gifURL)
+	}
+}
+
+func TestGetGifKey(t *testing.T) {
+	assert.Equal(t, "tenor:42", GetGifKey(Gif{ID: "42", Provider: "tenor", URL: "https://media.tenor.com/x8v1oNUOmg4AAAAC/rickroll.gif"}))
+	assert.Equal(t, "giphy:3o7TKSjRrfIPjeiVyM", GetGifKey(Gif{ID: "3o7TKSjRrfIPjeiVyM", Provider: "giphy", URL: "https://media.giphy.com/media/3o7TKSjRrfIPjeiVyM/200.gif"}))
+	assert.Equal(t, GetGifKey(Gif{ID: "3o7TKSjRrfIPjeiVyM", Provider: "giphy"}), GetGifKey(NewGifFromURL("https://media.giphy.com/media/3o7TKSjRrfIPjeiVyM/200.gif")))
+	assert.Equal(t, "https://gifs.test/media/kitty.gif", GetGifKey(Gif{ID: "https://gifs.test/media/kitty.gif?size=small", Provider: "custom", URL: "https://gifs.test/media/kitty.gif?size=small"}))
+}
@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// LocalLibraryTagsFile is the optional file of the library directory that lists additional keywords for each GIF
+	LocalLibraryTagsFile = "tags.json"
+	// URLLocalLibrary is the plugin route that serves the GIFs of the local library
+	URLLocalLibrary = "/library/"
+
+	localLibraryPageSize = 25
+)
+
+// LocalLibraryExtensions lists the file extensions that are considered as GIFs in the local library
+var LocalLibraryExtensions = map[string]string{
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+}
+
+// local finds GIFs in a directory of the Mattermost server, managed by the administrators
+type local struct {
+	abstractGifProvider
+	directory string
+	rootURL   string
+}
+
+type localGif struct {
+	name    string
+	tags    []string
+	modTime time.Time
+}
+
+// NewLocalProvider creates an instance of a GIF provider that searches the GIFs stored in a local directory.
+// Each GIF is tagged with the words of its file name and with the keywords listed for it in the optional tags.json file.
+func NewLocalProvider(errorGenerator pluginError.PluginError, directory, rootURL string) (GifProvider, *model.AppError) {
+	if errorGenerator == nil {
+		return nil, model.NewAppError("NewLocalProvider", "errorGenerator cannot be nil for Local Provider", nil, "", http.StatusInternalServerError)
+	}
+	if directory == "" {
+		return nil, errorGenerator.FromMessage("directory cannot be empty for Local Provider")
+	}
+	if rootURL == "" {
+		return nil, errorGenerator.FromMessage("internal error: rootURL must be set")
+	}
+
+	localProvider := &local{}
+	localProvider.errorGenerator = errorGenerator
+	localProvider.directory = directory
+	localProvider.rootURL = rootURL
+
+	return localProvider, nil
+}
+
+func (p *local) GetAttributionMessage() string {
+	return ""
+}
+
+// Return the library GIFs that match all the keywords of the request, or an error if the library could not be read
+func (p *local) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	if mediaType != MediaTypeGif {
+		return []Gif{}, newUnsupportedMediaTypeError(p.errorGenerator, mediaType, "local GIF library")
+	}
+	library, err := p.readLibrary()
+	if err != nil {
+		return []Gif{}, err
+	}
+
+	matches := []localGif{}
+	keywords := splitKeywords(request)
+	for _, gif := range library {
+		if gif.matches(keywords) {
+			matches = append(matches, gif)
+		}
+	}
+	if len(matches) < 1 {
+		return []Gif{}, nil
+	}
+
+	if random {
+		// #nosec G404 -- picking a GIF does not require a secure random generator
+		return []Gif{p.getGif(matches[rand.Intn(len(matches))])}, nil
+	}
+
+	return p.getPage(matches, cursor), nil
+}
+
+// Return the GIFs most recently added to the library, or an error if the library could not be read
+func (p *local) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	library, err := p.readLibrary()
+	if err != nil {
+		return []Gif{}, err
+	}
+	sort.SliceStable(library, func(i, j int) bool { return library[i].modTime.After(library[j].modTime) })
+	return p.getPage(library, cursor), nil
+}
+
+// getPage returns the page of GIFs starting at the cursor offset, and updates the cursor to the next page
+func (p *local) getPage(gifs []localGif, cursor *string) []Gif {
+	offset := 0
+	if counter, convErr := strconv.Atoi(*cursor); convErr == nil && counter > 0 {
+		offset = counter
+	}
+	if offset >= len(gifs) {
+		*cursor = ""
+		return []Gif{}
+	}
+	end := offset + localLibraryPageSize
+	if end >= len(gifs) {
+		end = len(gifs)
+		*cursor = ""
+	} else {
+		*cursor = strconv.Itoa(end)
+	}
+
+	page := []Gif{}
+	for _, gif := range gifs[offset:end] {
+		page = append(page, p.getGif(gif))
+	}
+	return page
+}
+
+// readLibrary lists the GIFs of the library directory, sorted by file name
+func (p *local) readLibrary() ([]localGif, *model.AppError) {
+	entries, err := os.ReadDir(p.directory)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Could not read the local GIF library", err)
+	}
+
+	additionalTags := map[string][]string{}
+	if content, readErr := os.ReadFile(filepath.Join(p.directory, LocalLibraryTagsFile)); readErr == nil {
+		if jsonErr := json.Unmarshal(content, &additionalTags); jsonErr != nil {
+			return nil, p.errorGenerator.FromError("Could not parse the "+LocalLibraryTagsFile+" file of the local GIF library", jsonErr)
+		}
+	}
+
+	library := []localGif{}
+	for _, entry := range entries {
+		name := entry.Name()
+		extension := strings.ToLower(filepath.Ext(name))
+		if entry.IsDir() || LocalLibraryExtensions[extension] == "" {
+			continue
+		}
+		tags := splitKeywords(strings.TrimSuffix(name, filepath.Ext(name)))
+		for _, tag := range additionalTags[name] {
+			tags = append(tags, splitKeywords(tag)...)
+		}
+		gif := localGif{name: name, tags: tags}
+		if info, infoErr := entry.Info(); infoErr == nil {
+			gif.modTime = info.ModTime()
+		}
+		library = append(library, gif)
+	}
+	sort.Slice(library, func(i, j int) bool { return library[i].name < library[j].name })
+	return library, nil
+}
+
+// getGif returns the GIF of the library file, identified and described by its file name
+func (p *local) getGif(gif localGif) Gif {
+	return Gif{
+		ID:       gif.name,
+		Title:    strings.Join(splitKeywords(strings.TrimSuffix(gif.name, filepath.Ext(gif.name))), " "),
+		URL:      fmt.Sprintf("%s%s%s", p.rootURL, URLLocalLibrary, url.PathEscape(gif.name)),
+		Provider: "local",
+	}
+}
+
+// matches returns true if each keyword is the beginning of one of the GIF tags
+func (gif localGif) matches(keywords []string) bool {
+	if len(keywords) == 0 {
+		return false
+	}
+	for _, keyword := range keywords {
+		found := false
+		for _, tag := range gif.tags {
+			if strings.HasPrefix(tag, keyword) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// splitKeywords returns the lower-case words of a text, ignoring punctuation and separators such as '-' or '_'
+func splitKeywords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
+	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func generateLocalLibraryForTest(t *testing.T, fileNames []string, tags string) string {
+	directory := t.TempDir()
+	for _, name := range fileNames {
+		assert.Nil(t, os.WriteFile(filepath.Join(directory, name), []byte("GIF89a"), 0600))
+	}
+	if tags != "" {
+		assert.Nil(t, os.WriteFile(filepath.Join(directory, LocalLibraryTagsFile), []byte(tags), 0600))
+	}
+	return directory
+}
+
+func generateLocalProviderForTest(directory string) *local {
+	provider, _ := NewLocalProvider(test.MockErrorGenerator(), directory, testRootURL)
+	return provider.(*local)
+}
+
+func TestNewLocalProvider(t *testing.T) {
+	testErrorGenerator := test.MockErrorGenerator()
+	testCases := []struct {
+		testLabel           string
+		paramErrorGenerator pluginError.PluginError
+		paramDirectory      string
+		paramRootURL        string
+		expectedError       bool
+	}{
+		{testLabel: "OK", paramErrorGenerator: testErrorGenerator, paramDirectory: "/gifs", paramRootURL: testRootURL, expectedError: false},
+		{testLabel: "KO empty directory", paramErrorGenerator: testErrorGenerator, paramDirectory: "", paramRootURL: testRootURL, expectedError: true},
+		{testLabel: "KO empty rootURL", paramErrorGenerator: testErrorGenerator, paramDirectory: "/gifs", paramRootURL: "", expectedError: true},
+		{testLabel: "KO nil errorGenerator", paramErrorGenerator: nil, paramDirectory: "/gifs", paramRootURL: testRootURL, expectedError: true},
+	}
+
+	for _, testCase := range testCases {
+		provider, err := NewLocalProvider(testCase.paramErrorGenerator, testCase.paramDirectory, testCase.paramRootURL)
+		if testCase.expectedError {
+			assert.NotNil(t, err, testCase.testLabel)
+			assert.Nil(t, provider, testCase.testLabel)
+		} else {
+			assert.Nil(t, err, testCase.testLabel)
+			assert.NotNil(t, provider, testCase.testLabel)
+			assert.Equal(t, testCase.paramDirectory, provider.(*local).directory, testCase.testLabel)
+			assert.Equal(t, testCase.paramRootURL, provider.(*local).rootURL, testCase.testLabel)
+		}
+	}
+}
+
+func TestLocalProviderGetGifURLShouldMatchFileNamesAndTags(t *testing.T) {
+	directory := generateLocalLibraryForTest(t, []string{"happy-cat.gif", "sad_cat.webp", "ship it.gif", "notes.txt"}, `{"ship it.gif": ["Deploy", "release party"]}`)
+	p := generateLocalProviderForTest(directory)
+
+	testCases := []struct {
+		keywords     string
+		expectedURLs []string
+	}{
+		{keywords: "cat", expectedURLs: []string{testRootURL + "/library/happy-cat.gif", testRootURL + "/library/sad_cat.webp"}},
+		{keywords: "Happy CAT", expectedURLs: []string{testRootURL + "/library/happy-cat.gif"}},
+		{keywords: "hap", expectedURLs: []string{testRootURL + "/library/happy-cat.gif"}},
+		{keywords: "party", expectedURLs: []string{testRootURL + "/library/ship%20it.gif"}},
+		{keywords: "deploy ship", expectedURLs: []string{testRootURL + "/library/ship%20it.gif"}},
+		{keywords: "notes", expectedURLs: []string{}},
+		{keywords: "dog", expectedURLs: []string{}},
+	}
+	for _, testCase := range testCases {
+		cursor := ""
+		gifs, err := p.GetGifs(testCase.keywords, MediaTypeGif, &cursor, false)
+		assert.Nil(t, err, testCase.keywords)
+		assert.Equal(t, testCase.expectedURLs, getGifURLs(gifs), testCase.keywords)
+	}
+}
+
+func TestLocalProviderGetGifURLShouldPaginateWithCursor(t *testing.T) {
+	fileNames := []string{}
+	for i := 0; i < localLibraryPageSize+2; i++ {
+		fileNames = append(fileNames, "cat"+string(rune('a'+i))+".gif")
+	}
+	p := generateLocalProviderForTest(generateLocalLibraryForTest(t, fileNames, ""))
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Len(t, gifs, localLibraryPageSize)
+	assert.Equal(t, "25", cursor)
+
+	gifs, err = p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Len(t, gifs, 2)
+	assert.Equal(t, "", cursor)
+}
+
+func TestLocalProviderGetGifURLShouldReturnOneGifWhenRandom(t *testing.T) {
+	p := generateLocalProviderForTest(generateLocalLibraryForTest(t, []string{"cat1.gif", "cat2.gif", "cat3.gif"}, ""))
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, true)
+	assert.Nil(t, err)
+	assert.Len(t, gifs, 1)
+	assert.Contains(t, gifs[0].URL, testRootURL+"/library/cat")
+}
+
+func TestLocalProviderGetGifURLShouldFailWhenLibraryCannotBeRead(t *testing.T) {
+	p := generateLocalProviderForTest(filepath.Join(t.TempDir(), "missing"))
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.NotNil(t, err)
+	assert.Empty(t, gifs)
+}
+
+func TestLocalProviderGetGifURLShouldFailWhenTagsFileIsInvalid(t *testing.T) {
+	p := generateLocalProviderForTest(generateLocalLibraryForTest(t, []string{"cat.gif"}, "not JSON"))
+
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), LocalLibraryTagsFile)
+	assert.Empty(t, gifs)
+}
+
+func TestLocalProviderGetTrendingGifURLShouldReturnNewestGifsFirst(t *testing.T) {
+	directory := generateLocalLibraryForTest(t, []string{"old.gif", "new.gif", "older.gif"}, "")
+	now := time.Now()
+	assert.Nil(t, os.Chtimes(filepath.Join(directory, "older.gif"), now, now.Add(-2*time.Hour)))
+	assert.Nil(t, os.Chtimes(filepath.Join(directory, "old.gif"), now, now.Add(-time.Hour)))
+	assert.Nil(t, os.Chtimes(filepath.Join(directory, "new.gif"), now, now))
+	p := generateLocalProviderForTest(directory)
+
+	cursor := ""
+	gifs, err := p.GetTrendingGifs(&cursor)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{testRootURL + "/library/new.gif", testRootURL + "/library/old.gif", testRootURL + "/library/older.gif"}, getGifURLs(gifs))
+	assert.Equal(t, "", cursor)
+}
+
+func TestLocalProviderGetGifURLShouldRefuseStickersAndClips(t *testing.T) {
+	p := generateLocalProviderForTest(generateLocalLibraryForTest(t, []string{"cat.gif"}, ""))
+	for _, mediaType := range []MediaType{MediaTypeSticker, MediaTypeClip} {
+		cursor := ""
+		gifs, err := p.GetGifs("cat", mediaType, &cursor, false)
+		assert.NotNil(t, err, mediaType)
+		assert.Empty(t, gifs, mediaType)
+	}
+}
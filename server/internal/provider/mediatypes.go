@@ -0,0 +1,14 @@
+package provider
+
+// MediaTypeProvider is implemented by GIF providers that can search for other types of media than GIFs
+type MediaTypeProvider interface {
+	SupportsMediaType(mediaType MediaType) bool
+}
+
+// SupportsMediaType returns true if the provider can search for this type of media. All the providers can search for GIFs.
+func SupportsMediaType(gifProvider GifProvider, mediaType MediaType) bool {
+	if mediaTypeProvider, ok := gifProvider.(MediaTypeProvider); ok {
+		return mediaTypeProvider.SupportsMediaType(mediaType)
+	}
+	return mediaType == MediaTypeGif
+}
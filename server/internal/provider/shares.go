@@ -0,0 +1,22 @@
+package provider
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// ShareReporter is implemented by GIF providers that ask to be told when one of their GIFs is posted,
+// to improve the ranking of their results
+type ShareReporter interface {
+	// RegisterShare reports that the GIF found with the query was posted. It returns false if the GIF
+	// doesn't come from the provider, and an error if the provider couldn't be told.
+	RegisterShare(gif Gif, query string) (bool, *model.AppError)
+}
+
+// RegisterShare reports that the GIF found with the query was posted to the provider of the GIF.
+// It returns false if the provider doesn't register the shares of this GIF.
+func RegisterShare(gifProvider GifProvider, gif Gif, query string) (bool, *model.AppError) {
+	if shareReporter, ok := gifProvider.(ShareReporter); ok {
+		return shareReporter.RegisterShare(gif, query)
+	}
+	return false, nil
+}
@@ -0,0 +1,24 @@
+package provider
+
+// StillProvider is implemented by GIF providers that can give a still image of their GIFs,
+// so that several GIFs can be displayed as lightweight thumbnails
+type StillProvider interface {
+	GetStillURL(gifURL string) string
+}
+
+// GetStillURL returns the URL of a still image of the GIF, or the URL of the GIF itself
+// if the provider doesn't have still images
+func GetStillURL(gifProvider GifProvider, gifURL string) string {
+	if stillProvider, ok := gifProvider.(StillProvider); ok {
+		return stillProvider.GetStillURL(gifURL)
+	}
+	return gifURL
+}
+
+// GetGifStillURL returns the still image given with the GIF by its provider, or else the one returned by GetStillURL
+func GetGifStillURL(gifProvider GifProvider, gif Gif) string {
+	if gif.StillURL != "" {
+		return gif.StillURL
+	}
+	return GetStillURL(gifProvider, gif.URL)
+}
@@ -0,0 +1,19 @@
+package provider
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// SuggestionProvider is implemented by GIF providers that can suggest search keywords from the beginning of a search
+type SuggestionProvider interface {
+	GetSearchSuggestions(query string) ([]string, *model.AppError)
+}
+
+// GetSearchSuggestions returns the keywords suggested by the provider for the query,
+// or no suggestion if the provider doesn't support it
+func GetSearchSuggestions(gifProvider GifProvider, query string) ([]string, *model.AppError) {
+	if suggestionProvider, ok := gifProvider.(SuggestionProvider); ok && query != "" {
+		return suggestionProvider.GetSearchSuggestions(query)
+	}
+	return []string{}, nil
+}
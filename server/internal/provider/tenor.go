@@ -3,7 +3,10 @@ package provider
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 
 	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
 
@@ -44,15 +47,37 @@ type tenor struct {
 
 const (
 	baseURLTenor = "https://tenor.googleapis.com/v2"
+	// tenorClipRendition is the format of the clips, as they are short videos rather than GIFs
+	tenorClipRendition = "mp4"
+	// tenorStillRendition is the still image of the first frame of the media, displayed instead of the clips
+	// where a video can't be displayed
+	tenorStillRendition = "gifpreview"
 )
 
 type tenorSearchResult struct {
-	Next    string `json:"next"`
-	Results []struct {
-		Media map[string]struct {
-			URL string `json:"url"`
-		} `json:"media_formats"`
-	} `json:"results"`
+	Next    string        `json:"next"`
+	Results []tenorResult `json:"results"`
+}
+
+type tenorResult struct {
+	ID                 string                      `json:"id"`
+	Media              map[string]tenorMediaFormat `json:"media_formats"`
+	Title              string                      `json:"title"`
+	ContentDescription string                      `json:"content_description"`
+	Tags               []string                    `json:"tags"`
+	// ItemURL is the page of the GIF on the Tenor website
+	ItemURL string `json:"itemurl"`
+}
+
+type tenorMediaFormat struct {
+	URL string `json:"url"`
+	// Dims are the width and height of the media
+	Dims []int `json:"dims"`
+	Size int   `json:"size"`
+}
+
+type tenorAutocompleteResult struct {
+	Results []string `json:"results"`
 }
 
 type tenorSearchError struct {
@@ -60,41 +85,163 @@ type tenorSearchError struct {
 	Code  string `json:"code"`
 }
 
+func (p *tenor) setResultFilter(resultFilter ResultFilter) {
+	p.resultFilter = resultFilter
+}
+
 func (p *tenor) GetAttributionMessage() string {
 	return "Via Tenor"
 }
 
-// Return the URL of a GIF that matches the query, or an empty string if no GIF matches the query, or an error if the search failed
-func (p *tenor) GetGifURL(request string, cursor *string, random bool) ([]string, *model.AppError) {
-	req, err := http.NewRequest("GET", baseURLTenor+"/search", nil)
-	if err != nil {
-		return []string{}, p.errorGenerator.FromError("Could not generate URL", err)
+// Return true for the GIFs, the stickers and the clips
+func (p *tenor) SupportsMediaType(mediaType MediaType) bool {
+	return mediaType == MediaTypeGif || mediaType == MediaTypeSticker || mediaType == MediaTypeClip
+}
+
+// Return the GIFs that match the query, or an empty list if no GIF matches the query, or an error if the search failed
+func (p *tenor) GetGifs(request string, mediaType MediaType, cursor *string, random bool) ([]Gif, *model.AppError) {
+	parameters := map[string]string{"q": request, "ar_range": "all"}
+	if cursor != nil && *cursor != "" {
+		parameters["pos"] = *cursor
+	}
+	// if random, we need to have several results because tenor applies tne random=true parameter only to the result list of this query
+	parameters["contentfilter"] = p.rating
+	parameters["media_filter"] = p.rendition
+	switch mediaType {
+	case MediaTypeGif:
+	case MediaTypeSticker:
+		parameters["searchfilter"] = "sticker"
+	case MediaTypeClip:
+		parameters["media_filter"] = tenorClipRendition + "," + tenorStillRendition
+	default:
+		return []Gif{}, newUnsupportedMediaTypeError(p.errorGenerator, mediaType, "Tenor")
+	}
+	if random {
+		parameters["random"] = "true"
 	}
 
-	q := req.URL.Query()
+	return p.getGifsFromEndpoint("search", parameters, cursor)
+}
 
-	q.Add("key", p.apiKey)
-	q.Add("q", request)
-	q.Add("ar_range", "all")
+// Return the featured GIFs of Tenor, or an error if the search failed
+func (p *tenor) GetTrendingGifs(cursor *string) ([]Gif, *model.AppError) {
+	parameters := map[string]string{"ar_range": "all", "contentfilter": p.rating, "media_filter": p.rendition}
 	if cursor != nil && *cursor != "" {
-		q.Add("pos", *cursor)
+		parameters["pos"] = *cursor
 	}
+	return p.getGifsFromEndpoint("featured", parameters, cursor)
+}
 
-	// if random, we need to have several results because tenor applies tne random=true parameter only to the result list of this query
-	q.Add("contentfilter", p.rating)
-	q.Add("media_filter", p.rendition)
+// Return the GIFs listed by a paginated endpoint, and update the cursor to the next page
+func (p *tenor) getGifsFromEndpoint(endpoint string, parameters map[string]string, cursor *string) ([]Gif, *model.AppError) {
+	body, err := p.callTenorEndpoint(endpoint, parameters)
+	if err != nil {
+		return []Gif{}, err
+	}
+
+	var response tenorSearchResult
+	if decodeErr := json.Unmarshal(body, &response); decodeErr != nil {
+		return []Gif{}, p.errorGenerator.FromError("Could not parse Tenor response body", decodeErr)
+	}
+
+	if len(response.Results) < 1 {
+		return []Gif{}, nil
+	}
+
+	// The first requested format is the one of the results, the next ones come with it
+	rendition, _, _ := strings.Cut(parameters["media_filter"], ",")
+	gifs := []Gif{}
+	excluded := 0
+	for i := range response.Results {
+		result := response.Results[i]
+		if p.isExcluded(append([]string{result.Title, result.ContentDescription}, result.Tags...)...) {
+			excluded++
+			continue
+		}
+		url := result.Media[rendition].URL
+		if len(url) > 0 {
+			gifs = append(gifs, result.toGif(url))
+		}
+	}
+
+	if len(gifs) < 1 && excluded < len(response.Results) {
+		return []Gif{}, p.errorGenerator.FromMessage("No gifs found for display style \"" + rendition + "\" in the response")
+	}
+
+	*cursor = response.Next
+
+	return gifs, nil
+}
+
+// toGif returns the GIF of the result, with the URL of the requested rendition
+func (result tenorResult) toGif(url string) Gif {
+	gif := Gif{ID: result.ID, Title: result.Title, Description: result.ContentDescription, PageURL: result.ItemURL, URL: url, Renditions: map[string]Rendition{}, Provider: "tenor"}
+	if gif.ID == "" {
+		gif.ID = url
+	}
+	for name, media := range result.Media {
+		rendition := Rendition{URL: media.URL, Size: media.Size}
+		if len(media.Dims) == 2 {
+			rendition.Width, rendition.Height = media.Dims[0], media.Dims[1]
+		}
+		gif.Renditions[name] = rendition
+	}
+	if media, ok := result.Media[tenorStillRendition]; ok && media.URL != url {
+		gif.StillURL = media.URL
+	}
+	return gif
+}
+
+// Register the share of a Tenor GIF with the search query, so that Tenor can improve the results of the next searches.
+// The GIFs that are not hosted by Tenor, or that Tenor didn't identify, are not registered.
+func (p *tenor) RegisterShare(gif Gif, query string) (bool, *model.AppError) {
+	parsedURL, err := url.Parse(gif.URL)
+	if err != nil || !strings.HasSuffix(parsedURL.Hostname(), "tenor.com") || gif.ID == "" || gif.ID == gif.URL {
+		return false, nil
+	}
+	parameters := map[string]string{"id": gif.ID}
+	if query != "" {
+		parameters["q"] = query
+	}
+	_, appErr := p.callTenorEndpoint("registershare", parameters)
+	return true, appErr
+}
+
+// Return the terms suggested by the Tenor autocomplete for the beginning of a search
+func (p *tenor) GetSearchSuggestions(query string) ([]string, *model.AppError) {
+	body, err := p.callTenorEndpoint("autocomplete", map[string]string{"q": query})
+	if err != nil {
+		return []string{}, err
+	}
+
+	var response tenorAutocompleteResult
+	if decodeErr := json.Unmarshal(body, &response); decodeErr != nil {
+		return []string{}, p.errorGenerator.FromError("Could not parse Tenor autocomplete response body", decodeErr)
+	}
+	return response.Results, nil
+}
+
+func (p *tenor) callTenorEndpoint(endpoint string, customParameters map[string]string) ([]byte, *model.AppError) {
+	req, err := http.NewRequest("GET", baseURLTenor+"/"+endpoint, nil)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Could not generate URL", err)
+	}
+
+	q := req.URL.Query()
+
+	q.Add("key", p.apiKey)
 	if len(p.language) > 0 {
 		q.Add("locale", p.language)
 	}
-	if random {
-		q.Add("random", "true")
+	for key, value := range customParameters {
+		q.Add(key, value)
 	}
 
 	req.URL.RawQuery = q.Encode()
 
 	r, err := p.httpClient.Do(req)
 	if err != nil {
-		return []string{}, p.errorGenerator.FromError("Error calling the Tenor API", err)
+		return nil, p.errorGenerator.FromError("Error calling the Tenor API", err)
 	}
 	if r != nil && r.Body != nil {
 		defer r.Body.Close()
@@ -110,38 +257,17 @@ func (p *tenor) GetGifURL(request string, cursor *string, random bool) ([]string
 			}
 		}
 		errorDetails += ")"
-		return []string{}, p.errorGenerator.FromMessage(errorDetails)
+		return nil, p.errorGenerator.FromMessage(errorDetails)
 	}
-
-	var response tenorSearchResult
 	if r.Body == nil {
-		return []string{}, p.errorGenerator.FromMessage("Tenor search response body is empty")
-	}
-
-	decoder := json.NewDecoder(r.Body)
-	if err = decoder.Decode(&response); err != nil {
-		return []string{}, p.errorGenerator.FromError("Could not parse Tenor search response body", err)
-	}
-
-	if len(response.Results) < 1 {
-		return []string{}, nil
-	}
-
-	urls := []string{}
-	for i := range response.Results {
-		url := response.Results[i].Media[p.rendition].URL
-		if len(url) > 0 {
-			urls = append(urls, url)
-		}
+		return nil, p.errorGenerator.FromMessage("Tenor response body is empty")
 	}
 
-	if len(urls) < 1 {
-		return []string{}, p.errorGenerator.FromMessage("No gifs found for display style \"" + p.rendition + "\" in the response")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to read response body", err)
 	}
-
-	*cursor = response.Next
-
-	return urls, nil
+	return body, nil
 }
 
 func convertRatingToContentFilter(rating string) string {
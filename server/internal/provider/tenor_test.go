@@ -2,6 +2,7 @@ package provider
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	pluginError "github.com/moussetc/mattermost-plugin-giphy/server/internal/error"
@@ -158,6 +159,7 @@ const defaultTenorResponseBody = `{
 		  }
 		},
 		"content_description": "some content description",
+		"itemurl": "https://tenor.com/view/fake-gif-4242424242",
 		"url": "https://fakeurl/fake.gif",
 		"tags": [],
 		"flags": [],
@@ -231,16 +233,36 @@ func TestTenorProviderGetGifURLShouldReturnUrlWhenSearchSucceeds(t *testing.T) {
 	p := generateTenorProviderForTest(newServerResponseOK(defaultTenorResponseBody))
 	p.rendition = "tinygif"
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.NotEmpty(t, url)
-	assert.Equal(t, url, []string{"https://fakeurl/tinygif"})
+	assert.Equal(t, []string{"https://fakeurl/tinygif"}, getGifURLs(url))
+}
+
+func TestTenorProviderGetGifURLShouldReturnTheMetadataOfTheGifs(t *testing.T) {
+	p := generateTenorProviderForTest(newServerResponseOK(`{"results": [{"id": "42", "title": "Grumpy cat", "content_description": "A cat frowning at the camera", "itemurl": "https://tenor.com/view/grumpy-cat-42",
+		"media_formats": {"mediumgif": {"url": "https://fakeurl/mediumgif", "dims": [320, 240], "size": 1024}, "nanogif": {"url": "https://fakeurl/nanogif", "dims": [90]}}}]}`))
+	cursor := ""
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []Gif{{
+		ID:          "42",
+		Title:       "Grumpy cat",
+		Description: "A cat frowning at the camera",
+		PageURL:     "https://tenor.com/view/grumpy-cat-42",
+		URL:         "https://fakeurl/mediumgif",
+		Renditions: map[string]Rendition{
+			"mediumgif": {URL: "https://fakeurl/mediumgif", Width: 320, Height: 240, Size: 1024},
+			"nanogif":   {URL: "https://fakeurl/nanogif"},
+		},
+		Provider: "tenor",
+	}}, gifs)
 }
 
 func TestTenorProviderGetGifURLShouldFailIfSearchBodyIsEmpty(t *testing.T) {
 	p := generateTenorProviderForTest(newServerResponseOK(""))
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "empty")
 	assert.Empty(t, url)
@@ -249,7 +271,7 @@ func TestTenorProviderGetGifURLShouldFailIfSearchBodyIsEmpty(t *testing.T) {
 func TestTenorProviderGetGifURLShouldFailWhenParseError(t *testing.T) {
 	p := generateTenorProviderForTest(newServerResponseOK("This is not a valid JSON response"))
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.NotNil(t, err)
 	assert.Empty(t, url)
 }
@@ -257,7 +279,7 @@ func TestTenorProviderGetGifURLShouldFailWhenParseError(t *testing.T) {
 func TestTenorProviderGetGifURLShouldReturnEmptyUrlWhenSearchReturnNoResult(t *testing.T) {
 	p := generateTenorProviderForTest(newServerResponseOK("{ \"weburl\": \"https://fakeurl/casdfsdfsdfsdfsdfst-gifs\", \"results\": [], \"next\": \"0\" }"))
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.Empty(t, url)
 }
@@ -266,7 +288,7 @@ func TestTenorProviderGetGifURLShouldFailWhenNoURLForRendition(t *testing.T) {
 	p := generateTenorProviderForTest(newServerResponseOK(defaultTenorResponseBody))
 	p.rendition = "NotExistingDisplayStyle"
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "No gifs found for display style")
 	assert.Contains(t, err.Error(), p.rendition)
@@ -277,7 +299,7 @@ func TestTenorProviderGetGifURLShouldFailWhenSearchBadStatusWithoutMessage(t *te
 	serverResponse := newServerResponseKO(400)
 	p := generateTenorProviderForTest(serverResponse)
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), serverResponse.Status)
 	assert.Empty(t, url)
@@ -287,7 +309,7 @@ func TestTenorProviderGetGifURLShouldFailWhenSearchBadStatusWithMessage(t *testi
 	serverResponse := newServerResponseKOWithBody(429, "{ \"error\": \"Please use a registered API Key\" }")
 	p := generateTenorProviderForTest(serverResponse)
 	cursor := ""
-	url, err := p.GetGifURL("cat", &cursor, false)
+	url, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), serverResponse.Status)
 	assert.Contains(t, err.Error(), "Please use a registered API Key")
@@ -307,7 +329,7 @@ func TestTenorProviderGetGifURLShouldApplyRatingFilterWhenSet(t *testing.T) {
 		assert.Contains(t, req.URL.RawQuery, "contentfilter=off")
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -319,7 +341,7 @@ func TestTenorProviderGetGifURLShouldApplyLanguageFilterWhenUnset(t *testing.T)
 		assert.NotContains(t, req.URL.RawQuery, "locale")
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -331,7 +353,7 @@ func TestTenorProviderGetGifURLShouldApplyLanguageFilterWhenSet(t *testing.T) {
 		assert.Contains(t, req.URL.RawQuery, "locale="+p.language)
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, false)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
 	assert.Nil(t, err)
 	assert.True(t, client.lastRequestPassTest)
 }
@@ -343,7 +365,109 @@ func TestTenorProviderGetGifURLShouldAddRandomOptionWhenRequired(t *testing.T) {
 		assert.NotContains(t, req.URL.RawQuery, "limit=1")
 		return true
 	}
-	_, err := p.GetGifURL("cat", &cursor, true)
+	_, err := p.GetGifs("cat", MediaTypeGif, &cursor, true)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestTenorProviderGetSearchSuggestionsShouldReturnAutocompleteResults(t *testing.T) {
+	p, client, _ := generateTenorProviderForURLBuildingTests()
+	client.response = newServerResponseOK(`{"results": ["happy", "happy birthday"]}`)
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/autocomplete") && req.URL.Query().Get("q") == "hap" && req.URL.Query().Get("locale") == testTenorLanguage
+	}
+
+	suggestions, err := GetSearchSuggestions(p, "hap")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"happy", "happy birthday"}, suggestions)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestTenorProviderGetSearchSuggestionsShouldFailWhenParseError(t *testing.T) {
+	p := generateTenorProviderForTest(newServerResponseOK("This is not a valid JSON response"))
+	suggestions, err := p.GetSearchSuggestions("hap")
+	assert.NotNil(t, err)
+	assert.Empty(t, suggestions)
+}
+
+func TestTenorProviderGetTrendingGifURLShouldCallFeaturedEndpointWithCursor(t *testing.T) {
+	p, client, _ := generateTenorProviderForURLBuildingTests()
+	p.rendition = "tinygif"
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/featured") && req.URL.Query().Get("pos") == "next" && req.URL.Query().Get("contentfilter") == "off"
+	}
+
+	cursor := "next"
+	gifs, err := p.GetTrendingGifs(&cursor)
 	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://fakeurl/tinygif"}, getGifURLs(gifs))
 	assert.True(t, client.lastRequestPassTest)
 }
+
+func TestTenorProviderGetGifURLShouldFilterStickers(t *testing.T) {
+	p, client, cursor := generateTenorProviderForURLBuildingTests()
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/search") && req.URL.Query().Get("searchfilter") == "sticker"
+	}
+	_, err := p.GetGifs("cat", MediaTypeSticker, &cursor, false)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestTenorProviderGetGifURLShouldReturnVideoURLsForClips(t *testing.T) {
+	p, client, cursor := generateTenorProviderForURLBuildingTests()
+	client.testRequestFunc = func(req *http.Request) bool {
+		return req.URL.Query().Get("media_filter") == "mp4,gifpreview"
+	}
+	gifs, err := p.GetGifs("cat", MediaTypeClip, &cursor, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://fakeurl/mp4"}, getGifURLs(gifs))
+	assert.Equal(t, "https://fakeurl/gifpreview", gifs[0].StillURL)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestTenorProviderGetGifURLShouldExcludeFilteredResults(t *testing.T) {
+	body := `{"results": [
+		{"title": "", "content_description": "Angry cat", "tags": ["cat"], "media_formats": {"mediumgif": {"url": "url1"}}},
+		{"title": "", "content_description": "Happy kitty", "tags": ["kitty", "rude"], "media_formats": {"mediumgif": {"url": "url2"}}},
+		{"title": "", "content_description": "Sleepy kitty", "tags": ["kitty"], "media_formats": {"mediumgif": {"url": "url3"}}}
+	], "next": "42"}`
+	p := generateTenorProviderForTest(newServerResponseOK(body))
+	p.setResultFilter(func(texts []string) bool {
+		joined := strings.Join(texts, " ")
+		return strings.Contains(joined, "Angry") || strings.Contains(joined, "rude")
+	})
+	cursor := ""
+
+	gifs, err := p.GetGifs("cat", MediaTypeGif, &cursor, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"url3"}, getGifURLs(gifs))
+	assert.Equal(t, "42", cursor)
+}
+
+func TestTenorProviderRegisterShareShouldCallRegisterShareEndpoint(t *testing.T) {
+	p, client, _ := generateTenorProviderForURLBuildingTests()
+	client.response = newServerResponseOK(`{"status": "ok"}`)
+	client.testRequestFunc = func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/registershare") && req.URL.Query().Get("id") == "4242" &&
+			req.URL.Query().Get("q") == "cat" && req.URL.Query().Get("key") == testTenorAPIKey
+	}
+
+	registered, err := RegisterShare(p, Gif{ID: "4242", URL: "https://media.tenor.com/abc/cat.gif"}, "cat")
+	assert.True(t, registered)
+	assert.Nil(t, err)
+	assert.True(t, client.lastRequestPassTest)
+}
+
+func TestTenorProviderRegisterShareShouldIgnoreOtherGifs(t *testing.T) {
+	p, client, _ := generateTenorProviderForURLBuildingTests()
+	client.testRequestFunc = func(_ *http.Request) bool { return true }
+
+	for _, gif := range []Gif{{ID: "abc42", URL: "https://media.giphy.com/media/abc42/giphy.gif"}, NewGifFromURL("https://media.tenor.com/abc/cat.gif")} {
+		registered, err := p.RegisterShare(gif, "cat")
+		assert.False(t, registered, gif.URL)
+		assert.Nil(t, err, gif.URL)
+	}
+	assert.False(t, client.lastRequestPassTest)
+}
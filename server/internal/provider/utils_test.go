@@ -54,3 +54,12 @@ func newServerResponseKOWithBody(statusCode int, body string) *http.Response {
 		Body:       io.NopCloser(bytes.NewBufferString(body)),
 	}
 }
+
+// getGifURLs returns the URLs of the GIFs, to compare the search results
+func getGifURLs(gifs []Gif) []string {
+	urls := []string{}
+	for _, gif := range gifs {
+		urls = append(urls, gif.URL)
+	}
+	return urls
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+)
+
+// Contains what's related to serving the GIFs through the plugin: the posts point to the media route
+// of the plugin instead of the GIF provider, and the media of the posted GIFs are stored in the KV store
+// on their first display, within the configured quota
+
+const (
+	// URLMedia is the plugin route that serves the GIFs proxied by the plugin
+	URLMedia = "/media/"
+
+	mediaKeyPrefix        = "media_"
+	mediaContentKeyPrefix = "mediacontent_"
+	mediaUsageKey         = "media_usage"
+	mediaIDLength         = 32
+	mediaDownloadTimeout  = 30 * time.Second
+	bytesPerMB            = 1024 * 1024
+
+	// previewedMediaTTL is how long the media of a GIF that is only previewed can be displayed, like its preview
+	previewedMediaTTL = previewSessionTTL
+)
+
+// allowedMediaContentTypes are the types of media that the plugin accepts to download, with their file extension
+var allowedMediaContentTypes = map[string]string{
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// mediaHTTPClient only connects to public addresses, checked when the connection is made so that a host
+// can't resolve to a public address when the URL is checked and to a private one when it is downloaded
+var mediaHTTPClient = &http.Client{
+	Timeout: mediaDownloadTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: mediaDownloadTimeout,
+			Control: func(_, address string, _ syscall.RawConn) error {
+				return checkMediaAddress(address)
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: mediaDownloadTimeout,
+	},
+}
+
+// isAllowedMediaIP returns true if the plugin may download media from the IP address.
+// It is replaced by the tests, which download the media from a local server.
+var isAllowedMediaIP = isPublicIP
+
+// isPublicIP returns false for the loopback, private, link-local and other reserved addresses, which
+// would let the users make the Mattermost server download from its own network
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) || ip.Equal(net.IPv4bcast))
+}
+
+// sharedAddressSpace is the range of addresses used by the carrier-grade NATs (RFC 6598)
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// checkMediaAddress returns an error if the host:port address is not an allowed IP address
+func checkMediaAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isAllowedMediaIP(ip) {
+		return fmt.Errorf("the media address %s is not allowed", host)
+	}
+	return nil
+}
+
+// privateMediaHTTPClient downloads the media of the private hosts allowed by the administrators, without checking
+// their addresses: it refuses the redirections to the other hosts
+func privateMediaHTTPClient(allowedPrivateHosts []string) *http.Client {
+	return &http.Client{
+		Timeout:   mediaDownloadTimeout,
+		Transport: &http.Transport{TLSHandshakeTimeout: mediaDownloadTimeout},
+		CheckRedirect: func(request *http.Request, _ []*http.Request) error {
+			if !isAllowedPrivateMediaHost(request.URL.Hostname(), allowedPrivateHosts) {
+				return fmt.Errorf("the redirection to the media host %s is not allowed", request.URL.Hostname())
+			}
+			return nil
+		},
+	}
+}
+
+// isAllowedPrivateMediaHost returns true if the host is one of the private hosts allowed by the administrators
+func isAllowedPrivateMediaHost(host string, allowedPrivateHosts []string) bool {
+	for _, allowedHost := range allowedPrivateHosts {
+		if strings.EqualFold(host, allowedHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMediaURL returns the media URL if it is an HTTP(S) URL
+func parseMediaURL(mediaURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(mediaURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsedURL.Scheme != "https" && parsedURL.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported media URL scheme %q", parsedURL.Scheme)
+	}
+	return parsedURL, nil
+}
+
+// checkMediaURL returns an error if the host of the media URL doesn't resolve to allowed addresses only
+func checkMediaURL(parsedURL *url.URL) error {
+	addresses, err := net.DefaultResolver.LookupIPAddr(context.Background(), parsedURL.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if !isAllowedMediaIP(address.IP) {
+			return fmt.Errorf("the media host %s resolves to the address %s, which is not allowed (add the host to the private hosts of the GIFs in the plugin configuration to allow it)", parsedURL.Hostname(), address.IP)
+		}
+	}
+	return nil
+}
+
+// proxiedMedia is what the KV store knows about a media served by the plugin
+type proxiedMedia struct {
+	URL string `json:"url"`
+	// Store is true if the media has been posted, so it should be kept after its first display
+	Store       bool   `json:"store"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size,omitempty"`
+}
+
+// getMediaID returns the ID of the media route for the URL, the same URL always having the same ID
+func getMediaID(mediaURL string) string {
+	hash := sha256.Sum256([]byte(mediaURL))
+	return hex.EncodeToString(hash[:])[:mediaIDLength]
+}
+
+// getProxiedGif returns the GIF with the URLs to display it and its still image, as returned by getProxiedMediaURL
+func (p *Plugin) getProxiedGif(gif provider.Gif, store bool) provider.Gif {
+	gif.URL = p.getProxiedMediaURL(gif.URL, store)
+	if gif.StillURL != "" {
+		gif.StillURL = p.getProxiedMediaURL(gif.StillURL, store)
+	}
+	return gif
+}
+
+// getProxiedMediaURL returns the URL of the plugin media route for the media URL, or the media URL itself if the
+// media are not proxied by the plugin. The media are only stored if store is true, for example when they are posted,
+// otherwise the media route expires with the preview.
+func (p *Plugin) getProxiedMediaURL(mediaURL string, store bool) string {
+	if !p.getConfiguration().ProxyMedia || strings.HasPrefix(mediaURL, p.rootURL+"/") ||
+		!(strings.HasPrefix(mediaURL, "https://") || strings.HasPrefix(mediaURL, "http://")) {
+		return mediaURL
+	}
+
+	mediaID := getMediaID(mediaURL)
+	var media proxiedMedia
+	if err := p.pluginClient.KV.Get(mediaKeyPrefix+mediaID, &media); err != nil {
+		p.API.LogWarn("Unable to read the proxied media", "mediaId", mediaID, "error", err.Error())
+		return mediaURL
+	}
+	if media.URL == "" || !media.Store {
+		media.URL = mediaURL
+		media.Store = store
+		var options []pluginapi.KVSetOption
+		if !store {
+			options = append(options, pluginapi.SetExpiry(previewedMediaTTL))
+		}
+		if _, err := p.pluginClient.KV.Set(mediaKeyPrefix+mediaID, media, options...); err != nil {
+			p.API.LogWarn("Unable to save the proxied media", "mediaId", mediaID, "error", err.Error())
+			return mediaURL
+		}
+	}
+	return p.rootURL + URLMedia + mediaID
+}
+
+// Serve a media proxied by the plugin, downloading it on its first display
+func (p *Plugin) handleMedia(w http.ResponseWriter, r *http.Request) {
+	mediaID := strings.TrimPrefix(r.URL.Path, URLMedia)
+	if len(mediaID) != mediaIDLength {
+		http.NotFound(w, r)
+		return
+	}
+	var media proxiedMedia
+	if err := p.pluginClient.KV.Get(mediaKeyPrefix+mediaID, &media); err != nil {
+		p.API.LogWarn("Unable to read the proxied media", "mediaId", mediaID, "error", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if media.URL == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var content []byte
+	if media.ContentType != "" {
+		if err := p.pluginClient.KV.Get(mediaContentKeyPrefix+mediaID, &content); err != nil {
+			p.API.LogWarn("Unable to read the content of the proxied media", "mediaId", mediaID, "error", err.Error())
+		}
+	}
+	if len(content) == 0 {
+		var contentType string
+		var err error
+		config := p.getConfiguration()
+		content, contentType, err = downloadMedia(media.URL, config.ProxyMediaMaxSizeMB*bytesPerMB, config.GetAllowedPrivateMediaHosts())
+		if err != nil {
+			p.API.LogWarn("Unable to download the proxied media", "mediaId", mediaID, "url", media.URL, "error", err.Error())
+			http.Error(w, "Unable to download the GIF", http.StatusBadGateway)
+			return
+		}
+		media.ContentType = contentType
+		if media.Store {
+			p.storeMedia(mediaID, media, content)
+		}
+	}
+
+	w.Header().Set("Content-Type", media.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, mediaID, time.Time{}, bytes.NewReader(content))
+}
+
+// storeMedia keeps the content of the media in the KV store, unless the storage quota is reached
+func (p *Plugin) storeMedia(mediaID string, media proxiedMedia, content []byte) {
+	if !p.reserveMediaStorage(len(content)) {
+		p.API.LogWarn("The storage quota of the proxied media is reached, the media will not be stored", "mediaId", mediaID)
+		return
+	}
+	media.Size = len(content)
+	if _, err := p.pluginClient.KV.Set(mediaContentKeyPrefix+mediaID, content); err != nil {
+		p.API.LogWarn("Unable to store the content of the proxied media", "mediaId", mediaID, "error", err.Error())
+		p.reserveMediaStorage(-len(content))
+		return
+	}
+	if _, err := p.pluginClient.KV.Set(mediaKeyPrefix+mediaID, media); err != nil {
+		p.API.LogWarn("Unable to save the proxied media", "mediaId", mediaID, "error", err.Error())
+	}
+}
+
+// reserveMediaStorage adds the size to the storage used by the proxied media, and returns false
+// without changing it if this would exceed the configured quota. A negative size releases storage.
+func (p *Plugin) reserveMediaStorage(size int) bool {
+	quota := p.getConfiguration().ProxyMediaQuotaMB * bytesPerMB
+	errQuotaReached := errors.New("quota reached")
+	err := p.pluginClient.KV.SetAtomicWithRetries(mediaUsageKey, func(oldValue []byte) (interface{}, error) {
+		usage := 0
+		if len(oldValue) > 0 {
+			usage, _ = strconv.Atoi(string(oldValue))
+		}
+		if size > 0 && quota > 0 && usage+size > quota {
+			return nil, errQuotaReached
+		}
+		if usage += size; usage < 0 {
+			usage = 0
+		}
+		return []byte(strconv.Itoa(usage)), nil
+	})
+	if err != nil && !errors.Is(err, errQuotaReached) {
+		p.API.LogWarn("Unable to update the storage used by the proxied media", "error", err.Error())
+	}
+	return err == nil
+}
+
+// downloadMedia returns the content and the content type of the media, if its type is allowed and its size is below maxSize.
+// Only the media of public addresses, or of the allowed private hosts, are downloaded.
+func downloadMedia(mediaURL string, maxSize int, allowedPrivateHosts []string) ([]byte, string, error) {
+	parsedURL, err := parseMediaURL(mediaURL)
+	if err != nil {
+		return nil, "", err
+	}
+	client := mediaHTTPClient
+	if isAllowedPrivateMediaHost(parsedURL.Hostname(), allowedPrivateHosts) {
+		client = privateMediaHTTPClient(allowedPrivateHosts)
+	} else if err = checkMediaURL(parsedURL); err != nil {
+		return nil, "", err
+	}
+	response, err := client.Get(mediaURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected HTTP status %d", response.StatusCode)
+	}
+	contentType, _, err := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if err != nil || allowedMediaContentTypes[contentType] == "" {
+		return nil, "", fmt.Errorf("unsupported content type %q", response.Header.Get("Content-Type"))
+	}
+	if response.ContentLength > int64(maxSize) {
+		return nil, "", fmt.Errorf("the media size %d is larger than the maximum size %d", response.ContentLength, maxSize)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(response.Body, int64(maxSize)+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(content) > maxSize {
+		return nil, "", fmt.Errorf("the media is larger than the maximum size %d", maxSize)
+	}
+	return content, contentType, nil
+}
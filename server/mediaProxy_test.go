@@ -0,0 +1,220 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+const testMediaContent = "GIF89a-fake-content"
+
+// allowLocalMedia lets the plugin download the media of the local test servers during the test
+func allowLocalMedia(t *testing.T) {
+	isAllowedMediaIP = func(net.IP) bool { return true }
+	t.Cleanup(func() { isAllowedMediaIP = isPublicIP })
+}
+
+func initMediaProxyTest(t *testing.T, contentType string) (*plugintest.API, *Plugin, *httptest.Server, *int) {
+	allowLocalMedia(t)
+	api, p := initMockAPI()
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything).Return(nil).Maybe()
+	p.rootURL = "https://mattermost.example.com/plugins/giphy"
+	p.configuration.ProxyMedia = true
+	p.configuration.ProxyMediaMaxSizeMB = 1
+	p.configuration.ProxyMediaQuotaMB = 10
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(testMediaContent))
+	}))
+	t.Cleanup(server.Close)
+	return api, p, server, &downloads
+}
+
+func requestMedia(p *Plugin, proxiedURL string) *http.Response {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", strings.TrimPrefix(proxiedURL, p.rootURL), nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+	return w.Result()
+}
+
+func TestGetProxiedMediaURLShouldNotRewriteWhenDisabled(t *testing.T) {
+	_, p := initMockAPI()
+	assert.Equal(t, testGifURL, p.getProxiedMediaURL(testGifURL, true))
+}
+
+func TestGetProxiedMediaURLShouldNotRewritePluginURLs(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+	localURL := p.rootURL + "/library/ship%20it.gif"
+	assert.Equal(t, localURL, p.getProxiedMediaURL(localURL, true))
+}
+
+func TestGetProxiedMediaURLShouldRewriteToMediaRoute(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+
+	proxiedURL := p.getProxiedMediaURL(testGifURL, true)
+
+	assert.Equal(t, p.rootURL+URLMedia+getMediaID(testGifURL), proxiedURL)
+	assert.Equal(t, proxiedURL, p.getProxiedMediaURL(testGifURL, false))
+}
+
+func TestGetProxiedMediaURLShouldOnlyKeepTheStoredMedia(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+	kv := p.pluginClient.KV.(*mockKVStore)
+
+	p.getProxiedMediaURL(testGifURL, false)
+	assert.Equal(t, int64(previewedMediaTTL/time.Second), kv.expiries[mediaKeyPrefix+getMediaID(testGifURL)])
+
+	p.getProxiedMediaURL(testGifURL, true)
+	assert.Zero(t, kv.expiries[mediaKeyPrefix+getMediaID(testGifURL)])
+
+	p.getProxiedMediaURL(testGifURL, false)
+	assert.Zero(t, kv.expiries[mediaKeyPrefix+getMediaID(testGifURL)])
+}
+
+func TestHandleMediaShouldDownloadAndStorePostedMedia(t *testing.T) {
+	_, p, server, downloads := initMediaProxyTest(t, "image/gif")
+	proxiedURL := p.getProxiedMediaURL(server.URL+"/kitty.gif", true)
+
+	for i := 0; i < 2; i++ {
+		result := requestMedia(p, proxiedURL)
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "image/gif", result.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(result.Body)
+		assert.Equal(t, testMediaContent, string(body))
+	}
+	assert.Equal(t, 1, *downloads)
+}
+
+func TestHandleMediaShouldNotStorePreviewedMedia(t *testing.T) {
+	_, p, server, downloads := initMediaProxyTest(t, "image/gif")
+	proxiedURL := p.getProxiedMediaURL(server.URL+"/kitty.gif", false)
+
+	requestMedia(p, proxiedURL)
+	requestMedia(p, proxiedURL)
+
+	assert.Equal(t, 2, *downloads)
+}
+
+func TestHandleMediaShouldNotStoreMediaOverQuota(t *testing.T) {
+	_, p, server, downloads := initMediaProxyTest(t, "image/gif")
+	_, _ = p.pluginClient.KV.Set(mediaUsageKey, []byte("10485750"))
+	proxiedURL := p.getProxiedMediaURL(server.URL+"/kitty.gif", true)
+
+	assert.Equal(t, http.StatusOK, requestMedia(p, proxiedURL).StatusCode)
+	assert.Equal(t, http.StatusOK, requestMedia(p, proxiedURL).StatusCode)
+
+	assert.Equal(t, 2, *downloads)
+}
+
+func TestHandleMediaShouldRefuseUnsupportedContentType(t *testing.T) {
+	_, p, server, _ := initMediaProxyTest(t, "text/html")
+	proxiedURL := p.getProxiedMediaURL(server.URL+"/page.html", true)
+
+	assert.Equal(t, http.StatusBadGateway, requestMedia(p, proxiedURL).StatusCode)
+}
+
+func TestHandleMediaShouldRefuseMediaLargerThanMaxSize(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write(make([]byte, bytesPerMB+1))
+	}))
+	defer server.Close()
+	proxiedURL := p.getProxiedMediaURL(server.URL+"/huge.gif", true)
+
+	assert.Equal(t, http.StatusBadGateway, requestMedia(p, proxiedURL).StatusCode)
+}
+
+func TestHandleMediaShouldReturnNotFoundForUnknownMedia(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+
+	assert.Equal(t, http.StatusNotFound, requestMedia(p, p.rootURL+URLMedia+getMediaID("unknown")).StatusCode)
+	assert.Equal(t, http.StatusNotFound, requestMedia(p, p.rootURL+URLMedia+"../secret").StatusCode)
+}
+
+func TestExecuteCommandShouldPostProxiedMediaURL(t *testing.T) {
+	_, p, _, _ := initMediaProxyTest(t, "image/gif")
+	p.gifProvider = &mockGifProvider{testGifURL}
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif kitty", UserId: testUserID, ChannelId: testChannelID})
+
+	assert.Nil(t, err)
+	assert.Contains(t, response.Text, p.rootURL+URLMedia+getMediaID(testGifURL))
+	assert.NotContains(t, response.Text, testGifURL)
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "fe80::1", "fc00::1", "0.0.0.0", "::", "100.64.0.1", "224.0.0.1", "255.255.255.255"} {
+		assert.False(t, isPublicIP(net.ParseIP(address)), address)
+	}
+	for _, address := range []string{"8.8.8.8", "151.101.1.1", "2606:4700::1"} {
+		assert.True(t, isPublicIP(net.ParseIP(address)), address)
+	}
+}
+
+func TestDownloadMediaShouldRefusePrivateAddresses(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		downloads++
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write([]byte(testMediaContent))
+	}))
+	t.Cleanup(server.Close)
+
+	for _, mediaURL := range []string{server.URL + "/kitty.gif", strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/kitty.gif", "file:///etc/passwd"} {
+		_, _, err := downloadMedia(mediaURL, bytesPerMB, nil)
+		assert.Error(t, err, mediaURL)
+	}
+	assert.Zero(t, downloads)
+}
+
+func TestDownloadMediaShouldDownloadFromTheAllowedPrivateHosts(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect.gif" {
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+"/kitty.gif", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write([]byte(testMediaContent))
+	}))
+	t.Cleanup(server.Close)
+
+	content, contentType, err := downloadMedia(server.URL+"/kitty.gif", bytesPerMB, []string{"gifs.example.com", "127.0.0.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "image/gif", contentType)
+	assert.Equal(t, testMediaContent, string(content))
+
+	_, _, err = downloadMedia(server.URL+"/redirect.gif", bytesPerMB, []string{"127.0.0.1"})
+	assert.ErrorContains(t, err, "redirection to the media host localhost is not allowed")
+
+	_, _, err = downloadMedia(server.URL+"/kitty.gif", bytesPerMB, []string{"gifs.example.com"})
+	assert.ErrorContains(t, err, "private hosts of the GIFs")
+}
+
+func TestDownloadMediaShouldCheckTheAddressWhenConnecting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/gif")
+		_, _ = w.Write([]byte(testMediaContent))
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := mediaHTTPClient.Get(server.URL + "/kitty.gif")
+
+	assert.ErrorContains(t, err, "is not allowed")
+}
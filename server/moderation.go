@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the keywords blocked by the administrators, in the searches and captions
+// of the users and optionally in the descriptions of the GIFs returned by the providers
+
+// checkBlockedKeywords returns a message explaining that the search can't be made, or an empty string if the
+// keywords and the caption don't contain any blocked keyword. The blocked attempts are logged for the administrators.
+func (p *Plugin) checkBlockedKeywords(keywords, caption, altText string, args *model.CommandArgs) string {
+	patterns, err := p.getConfiguration().GetBlockedKeywordPatterns()
+	if err != nil {
+		p.API.LogWarn("Unable to read the blocked keywords", "error", err.Error())
+		return ""
+	}
+	match := findBlockedKeyword(patterns, keywords, caption, altText)
+	if match == "" {
+		return ""
+	}
+	p.API.LogWarn("Blocked a GIF command containing a blocked keyword", "userId", args.UserId, "channelId", args.ChannelId, "keywords", keywords, "caption", caption, "altText", altText, "match", match)
+	return "Your search, caption or description contains words that are not allowed on this server."
+}
+
+// findBlockedKeyword returns the first text matching a blocked keyword pattern, or an empty string if there is none
+func findBlockedKeyword(patterns []*regexp.Regexp, texts ...string) string {
+	for _, text := range texts {
+		for _, pattern := range patterns {
+			if match := pattern.FindString(text); match != "" {
+				return match
+			}
+		}
+	}
+	return ""
+}
+
+// newResultFilter returns the filter excluding the GIFs whose descriptions contain blocked keywords,
+// or nil if the results are not filtered
+func (p *Plugin) newResultFilter(configuration *pluginConf.Configuration) provider.ResultFilter {
+	if !configuration.FilterResultMetadata {
+		return nil
+	}
+	patterns, err := configuration.GetBlockedKeywordPatterns()
+	if err != nil || len(patterns) == 0 {
+		return nil
+	}
+	return func(texts []string) bool {
+		match := findBlockedKeyword(patterns, texts...)
+		if match == "" {
+			return false
+		}
+		p.API.LogInfo("Excluded a GIF whose description contains a blocked keyword", "match", match)
+		return true
+	}
+}
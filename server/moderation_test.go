@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+// initModerationTest returns a plugin without GIF provider, so that any search fails the test
+func initModerationTest() (*plugintest.API, *Plugin, *string) {
+	api, p, message := initTestPlugin()
+	p.configuration.BlockedKeywords = "damn\n\n  /kitt(y|en)s?/  \nbad word"
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return api, p, message
+}
+
+func TestExecuteCommandShouldRefuseBlockedKeywords(t *testing.T) {
+	for _, command := range []string{"/gif DAMN", "/gif happy kittens", "/gif cat \"what a bad word\"", "/gif trending \"damn\"", "/gif :shipit: \"kitty\"", "/gif cat --alt \"A damn cat\""} {
+		api, p, message := initModerationTest()
+
+		_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: command, UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+		assert.Nil(t, err, command)
+		assert.Equal(t, "Your search, caption or description contains words that are not allowed on this server.", *message, command)
+		api.AssertCalled(t, "LogWarn", "Blocked a GIF command containing a blocked keyword", "userId", testUserID, "channelId", testChannelID, "keywords", mock.Anything, "caption", mock.Anything, "altText", mock.Anything, "match", mock.Anything)
+	}
+}
+
+func TestExecuteCommandShouldAllowKeywordsContainingBlockedWords(t *testing.T) {
+	_, p, _ := initModerationTest()
+	p.gifProvider = newMockGifProvider()
+	p.configuration.DisablePostingWithoutPreview = false
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif damnation \"bad words\"", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+}
+
+func TestNewResultFilterShouldExcludeResultsWithBlockedKeywords(t *testing.T) {
+	api, p, _ := initModerationTest()
+	api.On("LogInfo", mock.AnythingOfType("string"), "match", "Kitten").Return(nil)
+
+	assert.Nil(t, p.newResultFilter(p.configuration))
+
+	p.configuration.FilterResultMetadata = true
+	filter := p.newResultFilter(p.configuration)
+
+	assert.NotNil(t, filter)
+	assert.True(t, filter([]string{"Happy", "Kitten"}))
+	assert.False(t, filter([]string{"Happy cat", ""}))
+	api.AssertNumberOfCalls(t, "LogInfo", 1)
+}
+
+func TestGetCacheKeyPrefixShouldDependOnBlockedKeywordsWhenResultsAreFiltered(t *testing.T) {
+	config := generateMockPluginConfig()
+	prefix := config.GetCacheKeyPrefix()
+
+	config.BlockedKeywords = "damn"
+	assert.Equal(t, prefix, config.GetCacheKeyPrefix())
+
+	config.FilterResultMetadata = true
+	assert.NotEqual(t, prefix, config.GetCacheKeyPrefix())
+}
@@ -17,12 +17,9 @@ import (
 )
 
 const (
-	contextKeywords     = "keywords"
-	contextCaption      = "caption"
-	contextGifURLs      = "gifURLs"
+	contextSessionID    = "sessionId"
 	contextCurrentIndex = "currentGifIndex"
-	contextAPICursor    = "searchCursor"
-	contextRootID       = "rootId"
+	contextSignature    = "signature"
 )
 
 // Plugin is a Mattermost plugin that adds a /gif slash command
@@ -37,9 +34,16 @@ type Plugin struct {
 
 	errorGenerator pluginError.PluginError
 	gifProvider    provider.GifProvider
+	gifCache       *provider.GifCache
 	httpHandler    pluginHTTPHandler
 	botID          string
 	rootURL        string
+	// contextSecret signs the action contexts of the previews
+	contextSecret []byte
+
+	// overriddenGifProviders are the GIF providers of the team and channel settings, by cache key prefix
+	overriddenGifProvidersLock sync.Mutex
+	overriddenGifProviders     map[string]provider.GifProvider
 }
 
 // OnActivate register the plugin commands
@@ -54,6 +58,10 @@ func (p *Plugin) OnActivate() error {
 
 	p.httpHandler = &defaultHTTPHandler{}
 
+	if err := p.ensureContextSecret(); err != nil {
+		return errors.Wrap(err, "Could not load the secret signing the action requests")
+	}
+
 	if err := p.RegisterCommands(); err != nil {
 		return errors.Wrap(err, "Could not define plugin slash commands")
 	}
@@ -69,19 +77,42 @@ func (p *Plugin) OnActivate() error {
 func (p *Plugin) ExecuteCommand(_ *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
 	config := p.getConfiguration()
 
+	if message := p.checkUserRateLimit(args.UserId); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+
+	for _, trigger := range []string{config.CommandTriggerGifWithPreview, config.CommandTriggerGif} {
+		if trigger == "" || !strings.HasPrefix(args.Command, "/"+trigger) {
+			continue
+		}
+		if subcommand, arguments, ok := findSubcommand(args.Command, trigger); ok {
+			if message := p.checkSubcommandAllowed(subcommand, args); message != "" {
+				return p.sendEphemeralBotMessage(args, message)
+			}
+			return subcommand.execute(p, arguments, args)
+		}
+	}
+
+	if message := p.checkGifsAllowed(args.TeamId, args.ChannelId); message != "" {
+		return p.sendEphemeralBotMessage(args, message)
+	}
+
 	if strings.HasPrefix(args.Command, "/"+config.CommandTriggerGifWithPreview) {
-		keywords, caption, parseErr := parseCommandLine(args.Command, config.CommandTriggerGifWithPreview)
+		keywords, caption, altText, mediaType, parseErr := parseSearchCommandLine(args.Command, config.CommandTriggerGifWithPreview)
 		if parseErr != nil {
 			return nil, p.errorGenerator.FromMessage(parseErr.Error())
 		}
-		return p.executeCommandGifWithPreview(keywords, caption, args)
+		return p.executeCommandGifWithPreview(keywords, caption, altText, mediaType, args)
 	}
 	if strings.HasPrefix(args.Command, "/"+config.CommandTriggerGif) {
-		keywords, caption, parseErr := parseCommandLine(args.Command, config.CommandTriggerGif)
+		keywords, caption, altText, mediaType, parseErr := parseSearchCommandLine(args.Command, config.CommandTriggerGif)
 		if parseErr != nil {
 			return nil, p.errorGenerator.FromMessage(parseErr.Error())
 		}
-		return p.executeCommandGif(keywords, caption, args)
+		if p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId).DisablePostingWithoutPreview {
+			return p.executeCommandGifWithPreview(keywords, caption, altText, mediaType, args)
+		}
+		return p.executeCommandGif(keywords, caption, altText, mediaType, args)
 	}
 
 	return nil, p.errorGenerator.FromMessage("Command trigger " + args.Command + "is not supported by this plugin.")
@@ -1,16 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	manifest "github.com/moussetc/mattermost-plugin-giphy"
 	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
 	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
 	mock_pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi/mock_pluginapi"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
 	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
 	"github.com/stretchr/testify/assert"
 
@@ -18,6 +21,7 @@ import (
 	"github.com/mattermost/mattermost/server/public/plugin"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+	mmPluginapi "github.com/mattermost/mattermost/server/public/pluginapi"
 )
 
 func generateMockPluginConfig() pluginConf.Configuration {
@@ -55,6 +59,9 @@ func (h *mockHTTPHandler) handlePrevious(_ *Plugin, w http.ResponseWriter, _ *in
 func (h *mockHTTPHandler) handleSend(_ *Plugin, w http.ResponseWriter, _ *integrationRequest) {
 	w.WriteHeader(http.StatusOK)
 }
+func (h *mockHTTPHandler) handleFavorite(_ *Plugin, w http.ResponseWriter, _ *integrationRequest) {
+	w.WriteHeader(http.StatusOK)
+}
 
 func initMockAPI() (api *plugintest.API, p *Plugin) {
 	api = &plugintest.API{}
@@ -67,9 +74,118 @@ func initMockAPI() (api *plugintest.API, p *Plugin) {
 	p.botID = "botId42"
 	p.httpHandler = &mockHTTPHandler{}
 	p.errorGenerator = test.MockErrorGenerator()
+	p.pluginClient = &pluginapi.Client{KV: newMockKVStore()}
+	p.contextSecret = testContextSecret
 	return api, p
 }
 
+// initTestPlugin returns a plugin with a mocked API, and the message of the last ephemeral post sent to the test user
+func initTestPlugin() (*plugintest.API, *Plugin, *string) {
+	api, p := initMockAPI()
+	return api, p, captureEphemeral(api)
+}
+
+// captureEphemeral returns the message of the last ephemeral post sent to the test user
+func captureEphemeral(api *plugintest.API) *string {
+	message := new(string)
+	api.On("SendEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		*message = args.Get(1).(*model.Post).Message
+	}).Return(nil).Maybe()
+	return message
+}
+
+// captureNotifications returns the messages sent to the user of the action requests, in order
+func captureNotifications(t *testing.T) *[]string {
+	notifications := &[]string{}
+	previousNotifyUserOfError := notifyUserOfError
+	notifyUserOfError = func(_ plugin.API, _ string, message string, _ *model.AppError, _ *model.PostActionIntegrationRequest) {
+		*notifications = append(*notifications, message)
+	}
+	t.Cleanup(func() { notifyUserOfError = previousNotifyUserOfError })
+	return notifications
+}
+
+// setNow sets the current time of the plugin for the duration of the test
+func setNow(t *testing.T, current time.Time) {
+	previousNow := now
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = previousNow })
+}
+
+// settingsKeyMatcher matches the KV keys of the settings overridden for a team or a channel, or by the preferences of a user,
+// and of the blocked GIFs, that are read by every search
+type settingsKeyMatcher struct{}
+
+func (settingsKeyMatcher) Matches(x interface{}) bool {
+	key, ok := x.(string)
+	return ok && (strings.HasPrefix(key, settingsKeyPrefix) || strings.HasPrefix(key, preferencesKeyPrefix) || key == blockedGifsKey)
+}
+
+func (settingsKeyMatcher) String() string {
+	return "is a settings key"
+}
+
+// expectNoSettingsOverrides lets the KV mock answer that no setting is overridden for the teams, channels and users,
+// and accept the GIFs added to the history of the test user
+func expectNoSettingsOverrides(kv *mock_pluginapi.MockKVService) {
+	kv.EXPECT().Get(settingsKeyMatcher{}, gomock.Any()).AnyTimes().Return(nil)
+	kv.EXPECT().SetAtomicWithRetries(historyKeyPrefix+testUserID, gomock.Any()).AnyTimes().Return(nil)
+}
+
+// mockKVStore is an in-memory KV store, for tests that only care about what is stored
+type mockKVStore struct {
+	values   map[string][]byte
+	expiries map[string]int64
+}
+
+func newMockKVStore() *mockKVStore {
+	return &mockKVStore{values: map[string][]byte{}, expiries: map[string]int64{}}
+}
+
+func (s *mockKVStore) Get(key string, o interface{}) error {
+	data, ok := s.values[key]
+	if !ok {
+		return nil
+	}
+	// Like the real KV store, byte slices are stored as is
+	if bytesOut, isBytes := o.(*[]byte); isBytes {
+		*bytesOut = data
+		return nil
+	}
+	return json.Unmarshal(data, o)
+}
+
+func (s *mockKVStore) Set(key string, value interface{}, options ...mmPluginapi.KVSetOption) (bool, error) {
+	if value == nil {
+		delete(s.values, key)
+		delete(s.expiries, key)
+		return true, nil
+	}
+	opts := mmPluginapi.KVSetOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	s.expiries[key] = opts.ExpireInSeconds
+	data, isBytes := value.([]byte)
+	if !isBytes {
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return false, err
+		}
+	}
+	s.values[key] = data
+	return true, nil
+}
+
+func (s *mockKVStore) SetAtomicWithRetries(key string, valueFunc func(oldValue []byte) (interface{}, error)) error {
+	value, err := valueFunc(s.values[key])
+	if err != nil {
+		return err
+	}
+	_, err = s.Set(key, value)
+	return err
+}
+
 func TestGeneratedManifestShouldBeValid(t *testing.T) {
 	assert.Nil(t, manifest.Manifest.IsValid())
 }
@@ -114,7 +230,7 @@ func TestOnActivateOK(t *testing.T) {
 	defer mockCtrl.Finish()
 	mockBot := mock_pluginapi.NewMockBotService(mockCtrl)
 	mockBot.EXPECT().EnsureBot(gomock.Any(), gomock.Any())
-	p.pluginClient = &pluginapi.Client{Bot: mockBot}
+	p.pluginClient = &pluginapi.Client{Bot: mockBot, KV: newMockKVStore()}
 
 	assert.Nil(t, p.OnActivate())
 }
@@ -183,8 +299,12 @@ type mockGifProviderFail struct {
 	errorMessage string
 }
 
-func (m *mockGifProviderFail) GetGifURL(_ string, _ *string, _ bool) ([]string, *model.AppError) {
-	return []string{""}, (test.MockErrorGenerator()).FromError(m.errorMessage, errors.New(m.errorMessage))
+func (m *mockGifProviderFail) GetGifs(_ string, _ provider.MediaType, _ *string, _ bool) ([]provider.Gif, *model.AppError) {
+	return []provider.Gif{}, (test.MockErrorGenerator()).FromError(m.errorMessage, errors.New(m.errorMessage))
+}
+
+func (m *mockGifProviderFail) GetTrendingGifs(_ *string) ([]provider.Gif, *model.AppError) {
+	return []provider.Gif{}, (test.MockErrorGenerator()).FromError(m.errorMessage, errors.New(m.errorMessage))
 }
 
 func (m *mockGifProviderFail) GetAttributionMessage() string {
@@ -195,8 +315,12 @@ func (m *mockGifProviderFail) GetAttributionMessage() string {
 type emptyGifProvider struct {
 }
 
-func (m *emptyGifProvider) GetGifURL(_ string, _ *string, _ bool) ([]string, *model.AppError) {
-	return []string{}, nil
+func (m *emptyGifProvider) GetGifs(_ string, _ provider.MediaType, _ *string, _ bool) ([]provider.Gif, *model.AppError) {
+	return []provider.Gif{}, nil
+}
+
+func (m *emptyGifProvider) GetTrendingGifs(_ *string) ([]provider.Gif, *model.AppError) {
+	return []provider.Gif{}, nil
 }
 
 func (m *emptyGifProvider) GetAttributionMessage() string {
@@ -212,8 +336,21 @@ func newMockGifProvider() *mockGifProvider {
 	return &mockGifProvider{"fakeURL"}
 }
 
-func (m *mockGifProvider) GetGifURL(_ string, _ *string, _ bool) ([]string, *model.AppError) {
-	return []string{m.mockURL}, nil
+func (m *mockGifProvider) GetGifs(_ string, _ provider.MediaType, _ *string, _ bool) ([]provider.Gif, *model.AppError) {
+	return newTestGifs(m.mockURL), nil
+}
+
+func (m *mockGifProvider) GetTrendingGifs(_ *string) ([]provider.Gif, *model.AppError) {
+	return newTestGifs(m.mockURL), nil
+}
+
+// newTestGifs returns GIFs only known by their URL
+func newTestGifs(urls ...string) []provider.Gif {
+	gifs := []provider.Gif{}
+	for _, url := range urls {
+		gifs = append(gifs, provider.NewGifFromURL(url))
+	}
+	return gifs
 }
 
 func (m *mockGifProvider) GetAttributionMessage() string {
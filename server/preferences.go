@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the preferences of the users, managed with /gif prefs. The preferences change the
+// settings of the channel for the GIFs searched by the user, without loosening the limits set by the administrators.
+
+const (
+	commandPreferences = "prefs"
+
+	preferencesKeyPrefix = "prefs_"
+
+	// ratingNone is the rating value that doesn't filter the GIFs
+	ratingNone = "none"
+)
+
+// userPreferences are the values of the preferences of a user, by setting name
+type userPreferences map[string]string
+
+// preferenceSettingNames are the settings that the users can change for themselves. The provider needs the API keys
+// of the administrators, and the time zone of the quiet hours is a limit of the administrators.
+var preferenceSettingNames = map[string]bool{
+	settingRating:      true,
+	settingLanguage:    true,
+	settingDisplayMode: true,
+	settingPreview:     true,
+}
+
+// getPreferenceSettings returns the settings that can be changed by the preferences of the users, in the order they are listed
+func getPreferenceSettings() []overridableSetting {
+	settings := []overridableSetting{}
+	for _, setting := range getOverridableSettings() {
+		if preferenceSettingNames[setting.name] {
+			settings = append(settings, setting)
+		}
+	}
+	return settings
+}
+
+// getPreferenceSetting returns the setting with this name, or nil if it can't be changed by a preference
+func getPreferenceSetting(name string) *overridableSetting {
+	for _, setting := range getPreferenceSettings() {
+		if setting.name == strings.ToLower(name) {
+			return &setting
+		}
+	}
+	return nil
+}
+
+// apply changes the settings of the configuration with the preferences that don't loosen its limits:
+// the rating can't be looser, and the preview can't be turned off when it's required
+func (prefs userPreferences) apply(c *pluginConf.Configuration) {
+	for _, setting := range getPreferenceSettings() {
+		value, ok := prefs[setting.name]
+		if !ok || !isPreferenceApplicable(c, setting.name, value) {
+			continue
+		}
+		setting.set(c, value)
+	}
+}
+
+// isPreferenceApplicable returns true if the value of the preference doesn't loosen the setting of the configuration
+func isPreferenceApplicable(c *pluginConf.Configuration, name, value string) bool {
+	switch name {
+	case settingRating:
+		return !isRatingStricter(c.Rating, value)
+	case settingPreview:
+		return value == settingPreviewOn || !c.DisablePostingWithoutPreview
+	default:
+		return true
+	}
+}
+
+// isRatingStricter returns true if the rating filters more GIFs than the other rating.
+// The ratings of the manifest are ordered from the strictest to the loosest, after the value without filter.
+func isRatingStricter(rating, other string) bool {
+	return getRatingStrictness(rating) > getRatingStrictness(other)
+}
+
+func getRatingStrictness(rating string) int {
+	if rating == ratingNone {
+		return 0
+	}
+	ratings := getManifestSettingOptions("Rating")
+	for i, value := range ratings {
+		if value == rating {
+			return len(ratings) - i
+		}
+	}
+	return 0
+}
+
+func getPreferencesKey(userID string) string {
+	return preferencesKeyPrefix + userID
+}
+
+func (p *Plugin) getUserPreferences(userID string) (userPreferences, error) {
+	prefs := userPreferences{}
+	if userID == "" {
+		return prefs, nil
+	}
+	if err := p.pluginClient.KV.Get(getPreferencesKey(userID), &prefs); err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+func (p *Plugin) updateUserPreferences(userID string, update func(prefs userPreferences) userPreferences) error {
+	return p.pluginClient.KV.SetAtomicWithRetries(getPreferencesKey(userID), func(oldValue []byte) (interface{}, error) {
+		prefs := userPreferences{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &prefs); err != nil {
+				return nil, err
+			}
+		}
+		if prefs = update(prefs); len(prefs) == 0 {
+			return nil, nil
+		}
+		return prefs, nil
+	})
+}
+
+// getUserConfiguration returns the configuration of the channel changed by the preferences of the user.
+// The configuration of the channel is returned if the preferences can't be read or are not valid with it.
+func (p *Plugin) getUserConfiguration(userID, teamID, channelID string) *pluginConf.Configuration {
+	config := p.getChannelConfiguration(teamID, channelID)
+	prefs, err := p.getUserPreferences(userID)
+	if err != nil {
+		p.API.LogWarn("Unable to read the GIF preferences of the user", "userId", userID, "error", err.Error())
+		return config
+	}
+	preferred, err := applyUserPreferences(config, prefs)
+	if err != nil {
+		p.API.LogWarn("The GIF preferences of the user are not valid in the channel, the settings of the channel are used", "userId", userID, "channelId", channelID, "error", err.Error())
+		return config
+	}
+	return preferred
+}
+
+// applyUserPreferences returns a copy of the configuration with the preferences applied,
+// or an error if the resulting configuration is not valid
+func applyUserPreferences(config *pluginConf.Configuration, prefs userPreferences) (*pluginConf.Configuration, error) {
+	if len(prefs) == 0 {
+		return config, nil
+	}
+	config = config.Clone()
+	prefs.apply(config)
+	if err := config.IsValid(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// executeCommandPreferences lists the preferences of the user, or changes one of them
+func (p *Plugin) executeCommandPreferences(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(arguments)
+	if len(fields) == 0 {
+		return p.executeCommandPreferencesList(args)
+	}
+	if len(fields) != 2 {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Could not read the preference, try `/%s %s [preference] [value|%s]`.", triggerGif, commandPreferences, settingsValueDefault))
+	}
+	return p.executeCommandPreferencesSet(fields[0], fields[1], args)
+}
+
+func (p *Plugin) executeCommandPreferencesList(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	prefs, err := p.getUserPreferences(args.UserId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load your GIF preferences", err)
+	}
+	channelConfig := p.getChannelConfiguration(args.TeamId, args.ChannelId)
+	config := p.getUserConfiguration(args.UserId, args.TeamId, args.ChannelId)
+
+	lines := []string{"Your GIF preferences in this channel:"}
+	for _, setting := range getPreferenceSettings() {
+		origin := "channel setting"
+		if value, ok := prefs[setting.name]; ok && isPreferenceApplicable(channelConfig, setting.name, value) {
+			origin = "your preference"
+		} else if ok {
+			origin = fmt.Sprintf("channel setting, your preference %s would loosen it", value)
+		}
+		lines = append(lines, fmt.Sprintf("- %s (`%s`): **%s** (%s)", setting.description, setting.name, setting.get(config), origin))
+	}
+	lines = append(lines, fmt.Sprintf("Change them with `/%s %s [preference] [value|%s]`. Your preferences can't loosen the settings of the channel: the rating can only be stricter, and the preview can only be required.",
+		triggerGif, commandPreferences, settingsValueDefault))
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+func (p *Plugin) executeCommandPreferencesSet(name, value string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	setting := getPreferenceSetting(name)
+	if setting == nil {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown preference %s, the preferences are: %s.", name, strings.Join(getPreferenceSettingNames(), ", ")))
+	}
+	if value != settingsValueDefault {
+		value = setting.normalize(value)
+		if value == "" {
+			return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown value for the preference %s, the values are: %s.", setting.name, setting.describeValues()))
+		}
+	}
+
+	update := func(prefs userPreferences) userPreferences {
+		if value == settingsValueDefault {
+			delete(prefs, setting.name)
+		} else {
+			prefs[setting.name] = value
+		}
+		return prefs
+	}
+
+	// Check that the preference works with the settings of the channel before saving it
+	prefs, err := p.getUserPreferences(args.UserId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load your GIF preferences", err)
+	}
+	channelConfig := p.getChannelConfiguration(args.TeamId, args.ChannelId)
+	if _, err = applyUserPreferences(channelConfig, update(prefs)); err != nil {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("The preference %s can't be changed: %s.", setting.name, err.Error()))
+	}
+
+	if err = p.updateUserPreferences(args.UserId, update); err != nil {
+		return nil, p.errorGenerator.FromError("Unable to save your GIF preferences", err)
+	}
+	if value == settingsValueDefault {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("You use the setting %s of the channels again.", setting.name))
+	}
+	message := fmt.Sprintf("Your preference %s is now **%s**.", setting.name, value)
+	if !isPreferenceApplicable(channelConfig, setting.name, value) {
+		message += " It doesn't apply in this channel, as it would loosen the setting of the channel."
+	}
+	return p.sendEphemeralBotMessage(args, message)
+}
+
+func getPreferenceSettingNames() []string {
+	names := []string{}
+	for _, setting := range getPreferenceSettings() {
+		names = append(names, setting.name)
+	}
+	return names
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func initPreferencesTest() (*plugintest.API, *Plugin, *string) {
+	api, p, message := initTestPlugin()
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return api, p, message
+}
+
+func TestIsRatingStricter(t *testing.T) {
+	assert.True(t, isRatingStricter("g", "pg"))
+	assert.True(t, isRatingStricter("pg-13", "r"))
+	assert.True(t, isRatingStricter("r", "none"))
+	assert.False(t, isRatingStricter("none", "r"))
+	assert.False(t, isRatingStricter("pg", "pg"))
+	assert.False(t, isRatingStricter("pg-13", "g"))
+}
+
+func TestGetUserConfigurationShouldApplyPreferences(t *testing.T) {
+	_, p, _ := initPreferencesTest()
+	_, _ = p.pluginClient.KV.Set(getPreferencesKey(testUserID), userPreferences{settingLanguage: "ja", settingRating: "pg", settingPreview: settingPreviewOn})
+
+	config := p.getUserConfiguration(testUserID, testTeamID, testChannelID)
+
+	assert.Equal(t, "ja", config.Language)
+	assert.Equal(t, "pg", config.Rating)
+	assert.True(t, config.DisablePostingWithoutPreview)
+	assert.Equal(t, "fr", p.getUserConfiguration("another-user", testTeamID, testChannelID).Language)
+	assert.Equal(t, "fr", p.getChannelConfiguration(testTeamID, testChannelID).Language)
+}
+
+func TestGetUserConfigurationShouldNotLoosenChannelSettings(t *testing.T) {
+	_, p, _ := initPreferencesTest()
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeChannel, testChannelID), settingsOverrides{settingRating: "g", settingPreview: settingPreviewOn})
+	_, _ = p.pluginClient.KV.Set(getPreferencesKey(testUserID), userPreferences{settingRating: "r", settingPreview: settingPreviewOff})
+
+	config := p.getUserConfiguration(testUserID, testTeamID, testChannelID)
+
+	assert.Equal(t, "g", config.Rating)
+	assert.True(t, config.DisablePostingWithoutPreview)
+}
+
+func TestExecuteCommandShouldPreviewWhenUserPrefersPreview(t *testing.T) {
+	api, p, _ := initPreferencesTest()
+	p.gifProvider = newMockGifProvider()
+	executeSettingsCommand(t, p, "/gif prefs preview on")
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif kitty", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	api.AssertCalled(t, "SendEphemeralPost", testUserID, mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == p.botID && len(post.Attachments()) > 0
+	}))
+}
+
+func TestExecuteCommandPreferencesShouldSaveAndResetPreference(t *testing.T) {
+	_, p, message := initPreferencesTest()
+
+	executeSettingsCommand(t, p, "/gif prefs display FULL_URL")
+	assert.Contains(t, *message, "now **full_url**")
+	prefs, _ := p.getUserPreferences(testUserID)
+	assert.Equal(t, userPreferences{settingDisplayMode: "full_url"}, prefs)
+
+	executeSettingsCommand(t, p, "/gif prefs display default")
+	assert.Contains(t, *message, "setting display of the channels again")
+	prefs, _ = p.getUserPreferences(testUserID)
+	assert.Empty(t, prefs)
+}
+
+func TestExecuteCommandPreferencesShouldRefuseInvalidPreferences(t *testing.T) {
+	_, p, message := initPreferencesTest()
+
+	executeSettingsCommand(t, p, "/gif prefs provider tenor")
+	assert.Contains(t, *message, "Unknown preference provider")
+
+	executeSettingsCommand(t, p, "/gif prefs language klingon")
+	assert.Contains(t, *message, "Unknown value")
+
+	executeSettingsCommand(t, p, "/gif prefs language")
+	assert.Contains(t, *message, "Could not read the preference")
+
+	p.configuration.AttachmentMaxSizeMB = 0
+	executeSettingsCommand(t, p, "/gif prefs display attachment")
+	assert.Contains(t, *message, "can't be changed")
+
+	prefs, _ := p.getUserPreferences(testUserID)
+	assert.Empty(t, prefs)
+}
+
+func TestExecuteCommandPreferencesShouldWarnWhenPreferenceLoosensChannelSetting(t *testing.T) {
+	_, p, message := initPreferencesTest()
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeTeam, testTeamID), settingsOverrides{settingRating: "pg"})
+
+	executeSettingsCommand(t, p, "/gif prefs rating r")
+	assert.Contains(t, *message, "doesn't apply in this channel")
+
+	executeSettingsCommand(t, p, "/gif prefs language ja")
+	executeSettingsCommand(t, p, "/gif prefs")
+	assert.Contains(t, *message, "(`rating`): **pg** (channel setting, your preference r would loosen it)")
+	assert.Contains(t, *message, "(`language`): **ja** (your preference)")
+	assert.Contains(t, *message, "(`display`): **embedded** (channel setting)")
+}
+
+func TestHandleAutocompleteShouldSuggestPreferences(t *testing.T) {
+	_, p := initMockAPI()
+
+	assert.Equal(t, []string{settingRating, settingLanguage, settingDisplayMode, settingPreview}, getAutocompleteItemNames(requestAutocomplete(p, "/gif prefs ", "")))
+	assert.Equal(t, []string{settingPreviewOn, settingPreviewOff}, getAutocompleteItemNames(requestAutocomplete(p, "/gif prefs preview ", "o")))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the ephemeral preview post: one GIF at a time, or a grid of GIFs to pick from
+
+// previewState is what the buttons of a preview need to display, shuffle and send its GIFs.
+// It is stored in the KV store as a preview session, except for the index of the GIF displayed by each button.
+type previewState struct {
+	SessionID       string         `json:"-"`
+	UserID          string         `json:"userId"`
+	Keywords        string         `json:"keywords"`
+	Caption         string         `json:"caption"`
+	AltText         string         `json:"altText,omitempty"`
+	Gifs            []provider.Gif `json:"gifs"`
+	CurrentGifIndex int            `json:"-"`
+	SearchCursor    string         `json:"searchCursor"`
+	RootID          string         `json:"rootId"`
+	MediaType       string         `json:"mediaType"`
+	Trending        bool           `json:"trending"`
+	// Saved is true when the GIF was not searched, like a favorite or the GIF of an alias, so it can't be shuffled
+	Saved bool `json:"saved,omitempty"`
+}
+
+// toContext returns the action context of the buttons of the preview, signed with the secret
+func (s previewState) toContext(secret []byte) map[string]interface{} {
+	return map[string]interface{}{
+		contextSessionID:    s.SessionID,
+		contextCurrentIndex: s.CurrentGifIndex,
+		contextSignature:    signContext(secret, s.SessionID, s.CurrentGifIndex),
+	}
+}
+
+// getCurrentGif returns the GIF displayed by the preview, with the description typed by the user
+func (s previewState) getCurrentGif() provider.Gif {
+	return describeGif(s.Gifs[s.CurrentGifIndex], s.AltText)
+}
+
+// getPreviewPageSize returns the number of GIFs displayed at once by the preview
+func (p *Plugin) getPreviewPageSize() int {
+	config := p.getConfiguration()
+	if config.PreviewMode != pluginConf.PreviewModeGrid {
+		return 1
+	}
+	return config.PreviewGridSize
+}
+
+// setPreviewContent sets the message and the buttons of the preview post, for the GIF or the page of GIFs
+// starting at the current index of the state
+func (p *Plugin) setPreviewContent(config *pluginConf.Configuration, post *model.Post, state previewState) {
+	attributionMessage := provider.GetAttributionMessageForGif(p.getGifProvider(config), state.Gifs[state.CurrentGifIndex])
+	if p.getPreviewPageSize() == 1 {
+		// Only embedded display mode works inside an ephemeral post
+		post.Message = generateGifCaption(pluginConf.DisplayModeEmbedded, state.Keywords, state.Caption, p.getProxiedGif(state.getCurrentGif(), false), attributionMessage, config.IncludeGifDescription)
+		post.SetProps(map[string]interface{}{
+			"attachments": generatePreviewPostAttachments(state, p.contextSecret),
+		})
+		return
+	}
+
+	lastGifIndex := p.getGridPageEnd(state)
+	post.Message = fmt.Sprintf("Pick a GIF for **%s** (%d to %d)", state.Keywords, state.CurrentGifIndex+1, lastGifIndex)
+	if attributionMessage != "" {
+		post.Message += "\n*" + attributionMessage + "*"
+	}
+	post.SetProps(map[string]interface{}{
+		"attachments": p.generateGridPreviewPostAttachments(config, state),
+	})
+}
+
+// getGridPageEnd returns the index following the last GIF of the current page of the grid
+func (p *Plugin) getGridPageEnd(state previewState) int {
+	end := state.CurrentGifIndex + p.getPreviewPageSize()
+	if end > len(state.Gifs) {
+		end = len(state.Gifs)
+	}
+	return end
+}
+
+// generateGridPreviewPostAttachments returns one attachment for each GIF of the page, with a still thumbnail
+// and a button to post it, followed by the buttons to browse the pages
+func (p *Plugin) generateGridPreviewPostAttachments(config *pluginConf.Configuration, state previewState) []*model.SlackAttachment {
+	attachments := []*model.SlackAttachment{}
+	for i := state.CurrentGifIndex; i < p.getGridPageEnd(state); i++ {
+		number := strconv.Itoa(i + 1)
+		pickState := state
+		pickState.CurrentGifIndex = i
+		attachments = append(attachments, &model.SlackAttachment{
+			Text:     "#" + number,
+			ThumbURL: p.getProxiedMediaURL(provider.GetGifStillURL(p.getGifProvider(config), state.Gifs[i]), false),
+			Actions:  []*model.PostAction{generateButton("Pick #"+number, URLSend, "good", pickState.toContext(p.contextSecret))},
+		})
+	}
+
+	actionContext := state.toContext(p.contextSecret)
+	actions := []*model.PostAction{generateButton("Cancel", URLCancel, "default", actionContext)}
+	if state.CurrentGifIndex > 0 {
+		actions = append(actions, generateButton("Previous page", URLPrevious, "default", actionContext))
+	}
+	actions = append(actions, generateButton("Next page", URLShuffle, "primary", actionContext))
+	return append(attachments, &model.SlackAttachment{Actions: actions})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	mmPluginapi "github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+// Contains what's related to the preview sessions: the state of each preview is kept in the KV store,
+// so that the buttons of the preview only carry a random session ID that can't be tampered with
+
+const (
+	previewSessionKeyPrefix = "preview_"
+	// previewSessionTTL is how long a preview can be used after its last update
+	previewSessionTTL = 24 * time.Hour
+)
+
+var errPreviewSessionNotFound = errors.New("the preview session does not exist or has expired")
+
+// createPreviewSession stores a new preview, and sets the session ID of the state
+func (p *Plugin) createPreviewSession(state *previewState) error {
+	state.SessionID = model.NewId()
+	return p.savePreviewSession(*state)
+}
+
+// savePreviewSession stores the preview, and restarts its time to live
+func (p *Plugin) savePreviewSession(state previewState) error {
+	_, err := p.pluginClient.KV.Set(previewSessionKeyPrefix+state.SessionID, state, mmPluginapi.SetExpiry(previewSessionTTL))
+	return err
+}
+
+// loadPreviewSession returns the preview stored for the session ID, or errPreviewSessionNotFound if it has expired
+func (p *Plugin) loadPreviewSession(sessionID string) (previewState, error) {
+	var state previewState
+	if err := p.pluginClient.KV.Get(previewSessionKeyPrefix+sessionID, &state); err != nil {
+		return state, err
+	}
+	if len(state.Gifs) == 0 {
+		return state, errPreviewSessionNotFound
+	}
+	state.SessionID = sessionID
+	return state, nil
+}
+
+// deletePreviewSession removes the preview once it can no longer be used
+func (p *Plugin) deletePreviewSession(sessionID string) {
+	if _, err := p.pluginClient.KV.Set(previewSessionKeyPrefix+sessionID, nil); err != nil {
+		p.API.LogWarn("Unable to delete the preview session", "sessionId", sessionID, "error", err.Error())
+	}
+}
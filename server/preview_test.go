@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func initGridPreviewTest(gridSize int) (*plugintest.API, *Plugin, **model.Post) {
+	api, p := initMockAPI()
+	p.configuration.PreviewMode = pluginConf.PreviewModeGrid
+	p.configuration.PreviewGridSize = gridSize
+	p.gifProvider = newMockGifProvider()
+	updatedPost := new(*model.Post)
+	api.On("UpdateEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		*updatedPost = args.Get(1).(*model.Post)
+	}).Return(nil)
+	return api, p, updatedPost
+}
+
+func getPickedGifIndexes(post *model.Post) []interface{} {
+	indexes := []interface{}{}
+	for _, attachment := range post.Attachments() {
+		for _, action := range attachment.Actions {
+			if strings.HasPrefix(action.Name, "Pick #") {
+				indexes = append(indexes, action.Integration.Context[contextCurrentIndex])
+			}
+		}
+	}
+	return indexes
+}
+
+func TestExecuteCommandGifWithPreviewShouldShowGridOfGifs(t *testing.T) {
+	api, p, _ := initGridPreviewTest(2)
+	var previewPost *model.Post
+	api.On("SendEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		previewPost = args.Get(1).(*model.Post)
+	}).Return(nil)
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gifs " + testKeywords, UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.NotNil(t, previewPost)
+	assert.Contains(t, previewPost.Message, "Pick a GIF for **"+testKeywords+"** (1 to 1)")
+	attachments := previewPost.Attachments()
+	assert.Len(t, attachments, 2)
+	assert.Equal(t, "fakeURL", attachments[0].ThumbURL)
+	assert.Equal(t, "Pick #1", attachments[0].Actions[0].Name)
+	assert.Equal(t, []string{"Cancel", "Next page"}, []string{attachments[1].Actions[0].Name, attachments[1].Actions[1].Name})
+}
+
+func TestHandleShuffleShouldShowNextPageOfTheGrid(t *testing.T) {
+	_, p, updatedPost := initGridPreviewTest(2)
+	request := generateTestIntegrationRequest(0)
+	request.Gifs = newTestGifs("url1", "url2", "url3", "url4", "url5")
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, (*updatedPost).Message, "(3 to 4)")
+	assert.Equal(t, []interface{}{2, 3}, getPickedGifIndexes(*updatedPost))
+}
+
+func TestHandleShuffleShouldLoadMoreGifsAfterTheLastPageOfTheGrid(t *testing.T) {
+	_, p, updatedPost := initGridPreviewTest(2)
+	request := generateTestIntegrationRequest(2)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleShuffle(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Contains(t, (*updatedPost).Message, "(4 to 4)")
+	assert.Equal(t, []interface{}{3}, getPickedGifIndexes(*updatedPost))
+}
+
+func TestHandlePreviousShouldShowPreviousPageOfTheGrid(t *testing.T) {
+	_, p, updatedPost := initGridPreviewTest(2)
+	request := generateTestIntegrationRequest(1)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handlePrevious(p, w, request)
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assert.Equal(t, []interface{}{0, 1}, getPickedGifIndexes(*updatedPost))
+}
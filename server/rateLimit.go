@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/pluginapi"
+)
+
+// Contains what's related to limiting the number of GIF commands by user and by channel
+
+const (
+	rateLimitKeyPrefix     = "ratelimit_"
+	rateLimitUserWindow    = time.Minute
+	rateLimitChannelWindow = time.Hour
+	rateLimitMaxRetries    = 5
+)
+
+var now = time.Now
+
+// checkUserRateLimit counts a GIF command for the user, and returns a message explaining when the
+// user can try again if the configured limit of commands per minute is reached, or an empty string otherwise
+func (p *Plugin) checkUserRateLimit(userID string) string {
+	limit := p.getConfiguration().RateLimitUserPerMinute
+	retryIn := p.checkRateLimit("user_"+userID, limit, rateLimitUserWindow)
+	if retryIn == 0 {
+		return ""
+	}
+	return fmt.Sprintf("You have reached the limit of %d GIF commands per minute, please try again in %s.", limit, formatRetryDelay(retryIn))
+}
+
+// checkChannelRateLimit counts a GIF posted in the channel, and returns a message explaining when a GIF
+// can be posted again if the configured limit of GIFs per hour is reached, or an empty string otherwise
+func (p *Plugin) checkChannelRateLimit(channelID string) string {
+	limit := p.getConfiguration().RateLimitChannelPerHour
+	retryIn := p.checkRateLimit("channel_"+channelID, limit, rateLimitChannelWindow)
+	if retryIn == 0 {
+		return ""
+	}
+	return fmt.Sprintf("The limit of %d GIFs posted per hour in this channel has been reached, please try again in %s.", limit, formatRetryDelay(retryIn))
+}
+
+// checkRateLimit increments the counter of the current time window for the key, shared between the servers
+// of a cluster through the KV store. It returns how long to wait before the next action is allowed,
+// or 0 if the action is allowed. A limit lower or equal to 0 means that there is no limit.
+func (p *Plugin) checkRateLimit(key string, limit int, window time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+
+	current := now()
+	windowStart := current.Truncate(window)
+	kvKey := rateLimitKeyPrefix + key + "_" + strconv.FormatInt(windowStart.Unix(), 10)
+	for i := 0; i < rateLimitMaxRetries; i++ {
+		var oldValue []byte
+		if err := p.pluginClient.KV.Get(kvKey, &oldValue); err != nil {
+			p.API.LogWarn("Unable to read the rate limit counter", "key", kvKey, "error", err.Error())
+			return 0
+		}
+		count := 0
+		if len(oldValue) > 0 {
+			count, _ = strconv.Atoi(string(oldValue))
+		}
+		if count >= limit {
+			return windowStart.Add(window).Sub(current)
+		}
+
+		saved, err := p.pluginClient.KV.Set(kvKey, []byte(strconv.Itoa(count+1)), pluginapi.SetAtomic(oldValue), pluginapi.SetExpiry(2*window))
+		if err != nil {
+			p.API.LogWarn("Unable to update the rate limit counter", "key", kvKey, "error", err.Error())
+			return 0
+		}
+		if saved {
+			return 0
+		}
+		// Another request updated the counter in the meantime: try again with its new value
+	}
+	p.API.LogWarn("Unable to update the rate limit counter after several attempts", "key", kvKey)
+	return 0
+}
+
+func formatRetryDelay(delay time.Duration) string {
+	if delay < time.Minute {
+		return fmt.Sprintf("%d seconds", int(math.Ceil(delay.Seconds())))
+	}
+	return fmt.Sprintf("%d minutes", int(math.Ceil(delay.Minutes())))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi"
+	mock_pluginapi "github.com/moussetc/mattermost-plugin-giphy/server/internal/pluginapi/mock_pluginapi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func mockRateLimitCounter(kv *mock_pluginapi.MockKVService, key string, value string) {
+	kv.EXPECT().Get(key, gomock.Any()).DoAndReturn(func(_ string, o interface{}) error {
+		if value != "" {
+			*o.(*[]byte) = []byte(value)
+		}
+		return nil
+	})
+}
+
+func initRateLimitTest(t *testing.T) (*plugintest.API, *Plugin, *mock_pluginapi.MockKVService) {
+	api, p := initMockAPI()
+	mockCtrl := gomock.NewController(t)
+	t.Cleanup(mockCtrl.Finish)
+	kv := mock_pluginapi.NewMockKVService(mockCtrl)
+	p.pluginClient = &pluginapi.Client{KV: kv}
+	expectNoSettingsOverrides(kv)
+
+	setNow(t, time.Unix(3600+45, 0))
+	return api, p, kv
+}
+
+func TestCheckRateLimitShouldIgnoreDisabledLimit(t *testing.T) {
+	_, p, _ := initRateLimitTest(t)
+	// No KV call expected
+	assert.Empty(t, p.checkUserRateLimit("userId"))
+	assert.Empty(t, p.checkChannelRateLimit("channelId"))
+}
+
+func TestCheckRateLimitShouldIncrementCounterBelowLimit(t *testing.T) {
+	_, p, kv := initRateLimitTest(t)
+	p.configuration.RateLimitUserPerMinute = 3
+
+	mockRateLimitCounter(kv, "ratelimit_user_userId_3600", "2")
+	kv.EXPECT().Set("ratelimit_user_userId_3600", []byte("3"), gomock.Any(), gomock.Any()).Return(true, nil)
+	assert.Empty(t, p.checkUserRateLimit("userId"))
+}
+
+func TestCheckRateLimitShouldRefuseWhenLimitIsReached(t *testing.T) {
+	_, p, kv := initRateLimitTest(t)
+	p.configuration.RateLimitUserPerMinute = 3
+	p.configuration.RateLimitChannelPerHour = 10
+
+	mockRateLimitCounter(kv, "ratelimit_user_userId_3600", "3")
+	message := p.checkUserRateLimit("userId")
+	assert.Contains(t, message, "3 GIF commands per minute")
+	assert.Contains(t, message, "15 seconds")
+
+	mockRateLimitCounter(kv, "ratelimit_channel_channelId_3600", "10")
+	message = p.checkChannelRateLimit("channelId")
+	assert.Contains(t, message, "10 GIFs posted per hour")
+	assert.Contains(t, message, "60 minutes")
+}
+
+func TestCheckRateLimitShouldRetryWhenCounterIsUpdatedConcurrently(t *testing.T) {
+	_, p, kv := initRateLimitTest(t)
+	p.configuration.RateLimitUserPerMinute = 3
+
+	gomock.InOrder(
+		kv.EXPECT().Get("ratelimit_user_userId_3600", gomock.Any()).Return(nil),
+		kv.EXPECT().Set("ratelimit_user_userId_3600", []byte("1"), gomock.Any(), gomock.Any()).Return(false, nil),
+		kv.EXPECT().Get("ratelimit_user_userId_3600", gomock.Any()).DoAndReturn(func(_ string, o interface{}) error {
+			*o.(*[]byte) = []byte("1")
+			return nil
+		}),
+		kv.EXPECT().Set("ratelimit_user_userId_3600", []byte("2"), gomock.Any(), gomock.Any()).Return(true, nil),
+	)
+	assert.Empty(t, p.checkUserRateLimit("userId"))
+}
+
+func TestCheckRateLimitShouldAllowWhenKVStoreFails(t *testing.T) {
+	api, p, kv := initRateLimitTest(t)
+	p.configuration.RateLimitUserPerMinute = 3
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	kv.EXPECT().Get("ratelimit_user_userId_3600", gomock.Any()).Return(errors.New("KV failure"))
+	assert.Empty(t, p.checkUserRateLimit("userId"))
+}
+
+func TestExecuteCommandShouldRefuseWhenUserRateLimitIsReached(t *testing.T) {
+	api, p, kv := initRateLimitTest(t)
+	p.configuration.RateLimitUserPerMinute = 1
+	var sentMessage string
+	api.On("SendEphemeralPost", "userId", mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		sentMessage = args.Get(1).(*model.Post).Message
+	}).Return(nil)
+
+	mockRateLimitCounter(kv, "ratelimit_user_userId_3600", "1")
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif cat", UserId: "userId", ChannelId: "channelId"})
+	assert.Nil(t, err)
+	assert.NotNil(t, response)
+	assert.Contains(t, sentMessage, "limit of 1 GIF commands per minute")
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	manifest "github.com/moussetc/mattermost-plugin-giphy"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mitchellh/mapstructure"
+)
+
+// Contains what's related to the reports of the posted GIFs: any user can report a GIF post with a reason,
+// and the bot sends the report to the administrators' channel, with buttons to delete the post and
+// to block the GIF so that the searches never return it again
+
+const (
+	URLReport       = "/report"
+	URLReportSubmit = "/report/submit"
+	URLReportDelete = "/report/delete"
+	URLReportBlock  = "/report/block"
+
+	reportKeyPrefix       = "report_"
+	blockedGifsKey        = "blocked_gifs"
+	reportDialogCallback  = "report"
+	reportReasonElement   = "reason"
+	reportReasonMaxLength = 500
+
+	contextGifURL      = "gifUrl"
+	contextGifID       = "gifId"
+	contextGifProvider = "gifProvider"
+	contextPostID      = "postId"
+)
+
+// reportContext is the action context of the report buttons, and the state of the report dialog.
+// The Report button of a GIF post doesn't know its post, that is given by the action request.
+type reportContext struct {
+	PostID string `mapstructure:"postId" json:"postId"`
+	GifURL string `mapstructure:"gifUrl" json:"gifUrl"`
+	// GifID and GifProvider identify the reported GIF for its provider, to block all its renditions
+	GifID       string `mapstructure:"gifId" json:"gifId"`
+	GifProvider string `mapstructure:"gifProvider" json:"gifProvider"`
+	Signature   string `mapstructure:"signature" json:"signature"`
+}
+
+// newReportContext returns the context of the reported GIF, signed with the secret. The post ID is empty for the
+// Report button of a GIF post, as the button is created with the post.
+func newReportContext(secret []byte, postID string, gif provider.Gif) reportContext {
+	context := reportContext{PostID: postID, GifURL: gif.URL, GifID: gif.ID, GifProvider: gif.Provider}
+	context.Signature = signValues(secret, context.signedValues()...)
+	return context
+}
+
+func (c reportContext) signedValues() []string {
+	return []string{c.PostID, c.GifURL, c.GifID, c.GifProvider}
+}
+
+// getGif returns the reported GIF
+func (c reportContext) getGif() provider.Gif {
+	return provider.Gif{ID: c.GifID, Provider: c.GifProvider, URL: c.GifURL}
+}
+
+// toActionContext returns the context of the buttons of the report
+func (c reportContext) toActionContext() map[string]interface{} {
+	return map[string]interface{}{
+		contextPostID:      c.PostID,
+		contextGifURL:      c.GifURL,
+		contextGifID:       c.GifID,
+		contextGifProvider: c.GifProvider,
+		contextSignature:   c.Signature,
+	}
+}
+
+// gifReport contains the reports of a GIF post
+type gifReport struct {
+	GifURL  string       `json:"gifUrl"`
+	Reports []userReport `json:"reports"`
+}
+
+type userReport struct {
+	UserID    string `json:"userId"`
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// blockedGif is a GIF that the searches never return, by GIF key (see provider.GetGifKey)
+type blockedGif struct {
+	GifURL      string `json:"gifUrl"`
+	GifID       string `json:"gifId,omitempty"`
+	GifProvider string `json:"gifProvider,omitempty"`
+	UserID      string `json:"userId"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+// generateReportAttachments returns the attachment with the Report button of a GIF post,
+// or nil if there is no channel to send the reports to
+func (p *Plugin) generateReportAttachments(gif provider.Gif) []*model.SlackAttachment {
+	if p.getConfiguration().ReportChannelID == "" {
+		return nil
+	}
+	context := newReportContext(p.contextSecret, "", gif).toActionContext()
+	return []*model.SlackAttachment{{Actions: []*model.PostAction{generateButton("Report", URLReport, "default", context)}}}
+}
+
+// handleReportRequest serves the Report button, the report dialog and the buttons of the reports sent to the administrators
+func (p *Plugin) handleReportRequest(w http.ResponseWriter, r *http.Request, userID string) {
+	if r.URL.Path == URLReportSubmit {
+		p.handleReportSubmit(w, r, userID)
+		return
+	}
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogWarn("Could not parse PostActionIntegrationRequest", "error", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if userID != request.UserId {
+		http.Error(w, "The user of the request should match the authenticated user", http.StatusBadRequest)
+		return
+	}
+	var context reportContext
+	if err := mapstructure.Decode(request.Context, &context); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The Report button of a GIF post only signs the GIF, so its post is checked afterwards.
+	// The buttons of a report sign the reported post too.
+	signedContext := context
+	if r.URL.Path == URLReport {
+		signedContext.PostID = ""
+	}
+	if err := verifySignature(p.contextSecret, context.Signature, signedContext.signedValues()...); err != nil {
+		p.rejectTamperedRequest(w, r, userID, err)
+		return
+	}
+	if r.URL.Path == URLReport {
+		if err := p.checkReportedPost(request.PostId, context); err != nil {
+			p.rejectTamperedRequest(w, r, userID, err)
+			return
+		}
+	}
+
+	switch r.URL.Path {
+	case URLReport:
+		p.openReportDialog(w, &request, context.getGif())
+	case URLReportDelete:
+		p.handleReportDelete(w, &request, context)
+	case URLReportBlock:
+		p.handleReportBlock(w, &request, context)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// checkReportedPost returns an error unless the post of the action request is the GIF post of the Report button,
+// as the post isn't signed: it must have this Report button, for the same GIF and with the same signature
+func (p *Plugin) checkReportedPost(postID string, context reportContext) error {
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil {
+		return fmt.Errorf("unable to load the reported post %s: %w", postID, appErr)
+	}
+	for _, attachment := range post.Attachments() {
+		for _, action := range attachment.Actions {
+			if action.Integration == nil || !strings.HasSuffix(action.Integration.URL, URLReport) {
+				continue
+			}
+			if action.Integration.Context[contextGifURL] == context.GifURL && action.Integration.Context[contextSignature] == context.Signature {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("the post %s doesn't have the Report button of the GIF", postID)
+}
+
+// openReportDialog asks the user why the GIF post is reported
+func (p *Plugin) openReportDialog(w http.ResponseWriter, request *model.PostActionIntegrationRequest, gif provider.Gif) {
+	state, err := json.Marshal(newReportContext(p.contextSecret, request.PostId, gif))
+	if err != nil {
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+	appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
+		TriggerId: request.TriggerId,
+		URL:       fmt.Sprintf("/plugins/%s%s", manifest.Manifest.Id, URLReportSubmit),
+		Dialog: model.Dialog{
+			CallbackId:       reportDialogCallback,
+			Title:            "Report this GIF",
+			IntroductionText: "The administrators will review the GIF and can remove it.",
+			Elements: []model.DialogElement{{
+				DisplayName: "Reason",
+				Name:        reportReasonElement,
+				Type:        "textarea",
+				Placeholder: "Why is this GIF not appropriate?",
+				MaxLength:   reportReasonMaxLength,
+			}},
+			SubmitLabel: "Report",
+			State:       string(state),
+		},
+	})
+	if appErr != nil {
+		notifyUserOfError(p.API, p.botID, "Unable to open the report dialog", appErr, request)
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+	writeResponse(http.StatusOK, w)
+}
+
+// handleReportSubmit saves the report of the user and sends it to the administrators' channel
+func (p *Plugin) handleReportSubmit(w http.ResponseWriter, r *http.Request, userID string) {
+	var request model.SubmitDialogRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		p.API.LogWarn("Could not parse SubmitDialogRequest", "error", err.Error())
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if userID != request.UserId {
+		http.Error(w, "The user of the request should match the authenticated user", http.StatusBadRequest)
+		return
+	}
+	if request.Cancelled {
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	var context reportContext
+	if err := json.Unmarshal([]byte(request.State), &context); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if err := verifySignature(p.contextSecret, context.Signature, context.signedValues()...); err != nil {
+		p.rejectTamperedRequest(w, r, userID, err)
+		return
+	}
+
+	reason, _ := request.Submission[reportReasonElement].(string)
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		writeDialogResponse(w, &model.SubmitDialogResponse{Errors: map[string]string{reportReasonElement: "Please explain why you report this GIF."}})
+		return
+	}
+	post, appErr := p.API.GetPost(context.PostID)
+	if appErr != nil {
+		p.sendReportMessage(userID, request.ChannelId, "This GIF post doesn't exist anymore.")
+		writeDialogResponse(w, &model.SubmitDialogResponse{})
+		return
+	}
+	if !p.API.HasPermissionToChannel(userID, post.ChannelId, model.PermissionReadChannel) {
+		http.Error(w, "The user is not allowed to read this channel", http.StatusForbidden)
+		return
+	}
+
+	alreadyReported, err := p.saveReport(post.Id, context.GifURL, userReport{UserID: userID, Reason: reason, Timestamp: now().UnixMilli()})
+	if err != nil {
+		p.API.LogWarn("Unable to save the GIF report", "error", err.Error())
+		writeDialogResponse(w, &model.SubmitDialogResponse{Error: "Unable to save the report, please try again later."})
+		return
+	}
+	if alreadyReported {
+		p.sendReportMessage(userID, request.ChannelId, "You already reported this GIF.")
+		writeDialogResponse(w, &model.SubmitDialogResponse{})
+		return
+	}
+	p.recordAuditEntry(auditEntry{Action: auditActionReport, UserID: userID, ChannelID: post.ChannelId, GifURL: context.GifURL, PostID: post.Id, Details: reason})
+	if err := p.sendReportToAdministrators(userID, post, context.getGif(), reason); err != nil {
+		p.API.LogWarn("Unable to send the GIF report to the administrators", "error", err.Error())
+	}
+	p.sendReportMessage(userID, request.ChannelId, "Thank you, the GIF was reported to the administrators.")
+	writeDialogResponse(w, &model.SubmitDialogResponse{})
+}
+
+// saveReport adds the report of the user to the reports of the post, unless the user already reported it
+func (p *Plugin) saveReport(postID, gifURL string, report userReport) (alreadyReported bool, err error) {
+	err = p.pluginClient.KV.SetAtomicWithRetries(reportKeyPrefix+postID, func(oldValue []byte) (interface{}, error) {
+		reports := gifReport{GifURL: gifURL}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &reports); err != nil {
+				return nil, err
+			}
+		}
+		alreadyReported = false
+		for _, existingReport := range reports.Reports {
+			if existingReport.UserID == report.UserID {
+				alreadyReported = true
+				return reports, nil
+			}
+		}
+		reports.Reports = append(reports.Reports, report)
+		return reports, nil
+	})
+	return alreadyReported, err
+}
+
+// sendReportToAdministrators posts the report in the administrators' channel, with the buttons to delete the post and to block the GIF
+func (p *Plugin) sendReportToAdministrators(userID string, post *model.Post, gif provider.Gif, reason string) error {
+	reportChannelID := p.getConfiguration().ReportChannelID
+	if reportChannelID == "" {
+		return errors.New("no channel is configured for the reports")
+	}
+	names := p.newAuditNameResolver()
+	context := newReportContext(p.contextSecret, post.Id, gif).toActionContext()
+	reportPost := &model.Post{
+		UserId:    p.botID,
+		ChannelId: reportChannelID,
+		Message: fmt.Sprintf("%s reported [a GIF](%s) posted by %s in %s: %s\n%s", names.user(userID), p.getPermalink(post.Id),
+			names.user(post.UserId), names.channel(post.ChannelId), reason, gif.URL),
+	}
+	reportPost.AddProp("attachments", []*model.SlackAttachment{{
+		Actions: []*model.PostAction{
+			generateButton("Delete the post", URLReportDelete, "danger", context),
+			generateButton("Block the GIF", URLReportBlock, "danger", context),
+		},
+	}})
+	if _, appErr := p.API.CreatePost(reportPost); appErr != nil {
+		return appErr
+	}
+	return nil
+}
+
+// handleReportDelete deletes the reported post, if the user is allowed to delete the posts of others in its channel
+func (p *Plugin) handleReportDelete(w http.ResponseWriter, request *model.PostActionIntegrationRequest, context reportContext) {
+	post, appErr := p.API.GetPost(context.PostID)
+	if appErr != nil {
+		notifyUserOfError(p.API, p.botID, "The reported post was already deleted.", nil, request)
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	if !p.API.HasPermissionToChannel(request.UserId, post.ChannelId, model.PermissionDeleteOthersPosts) {
+		notifyUserOfError(p.API, p.botID, "You are not allowed to delete the posts of this channel.", nil, request)
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	if appErr := p.API.DeletePost(post.Id); appErr != nil {
+		notifyUserOfError(p.API, p.botID, "Unable to delete the post", appErr, request)
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+	p.recordAuditEntry(auditEntry{Action: auditActionDeletePost, UserID: request.UserId, ChannelID: post.ChannelId, GifURL: context.GifURL, PostID: post.Id})
+	p.markReportHandled(request, URLReportDelete, "The post was deleted by")
+	writeResponse(http.StatusOK, w)
+}
+
+// handleReportBlock adds the reported GIF to the GIFs blocked on the whole server, if the user is a system administrator
+func (p *Plugin) handleReportBlock(w http.ResponseWriter, request *model.PostActionIntegrationRequest, context reportContext) {
+	if !p.API.HasPermissionTo(request.UserId, model.PermissionManageSystem) {
+		notifyUserOfError(p.API, p.botID, "Only the system administrators can block a GIF.", nil, request)
+		writeResponse(http.StatusOK, w)
+		return
+	}
+	if err := p.blockGif(context.getGif(), request.UserId); err != nil {
+		notifyUserOfError(p.API, p.botID, "Unable to block the GIF", p.errorGenerator.FromError("Unable to block the GIF", err), request)
+		writeResponse(http.StatusInternalServerError, w)
+		return
+	}
+	p.recordAuditEntry(auditEntry{Action: auditActionBlockGif, UserID: request.UserId, GifURL: context.GifURL, PostID: context.PostID})
+	p.markReportHandled(request, URLReportBlock, "The GIF was blocked by")
+	writeResponse(http.StatusOK, w)
+}
+
+// markReportHandled adds the action of the administrator to the report post, and removes its button
+func (p *Plugin) markReportHandled(request *model.PostActionIntegrationRequest, actionURL, message string) {
+	reportPost, appErr := p.API.GetPost(request.PostId)
+	if appErr != nil {
+		p.API.LogWarn("Unable to update the GIF report", "error", appErr.Error())
+		return
+	}
+	reportPost.Message += fmt.Sprintf("\n*%s %s.*", message, p.newAuditNameResolver().user(request.UserId))
+	attachments := reportPost.Attachments()
+	for _, attachment := range attachments {
+		actions := []*model.PostAction{}
+		for _, action := range attachment.Actions {
+			if action.Integration == nil || !strings.HasSuffix(action.Integration.URL, actionURL) {
+				actions = append(actions, action)
+			}
+		}
+		attachment.Actions = actions
+	}
+	reportPost.AddProp("attachments", attachments)
+	if _, appErr := p.API.UpdatePost(reportPost); appErr != nil {
+		p.API.LogWarn("Unable to update the GIF report", "error", appErr.Error())
+	}
+}
+
+// blockGif adds the GIF to the GIFs blocked on the whole server
+func (p *Plugin) blockGif(gif provider.Gif, userID string) error {
+	return p.pluginClient.KV.SetAtomicWithRetries(blockedGifsKey, func(oldValue []byte) (interface{}, error) {
+		blockedGifs := map[string]blockedGif{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &blockedGifs); err != nil {
+				return nil, err
+			}
+		}
+		blockedGifs[provider.GetGifKey(gif)] = blockedGif{GifURL: gif.URL, GifID: gif.ID, GifProvider: gif.Provider, UserID: userID, Timestamp: now().UnixMilli()}
+		return blockedGifs, nil
+	})
+}
+
+// removeBlockedGifs returns the GIFs that are not blocked on the server. If the blocked GIFs can't be read, all the GIFs are returned.
+// The GIFs are identified by their provider and their ID, so that all the renditions of a blocked GIF are removed.
+// The GIFs only known by their URL, like the favorites, are also compared with the URL of the blocked GIFs.
+func (p *Plugin) removeBlockedGifs(gifs []provider.Gif) []provider.Gif {
+	blockedGifs := map[string]blockedGif{}
+	if err := p.pluginClient.KV.Get(blockedGifsKey, &blockedGifs); err != nil {
+		p.API.LogWarn("Unable to read the blocked GIFs", "error", err.Error())
+		return gifs
+	}
+	if len(blockedGifs) == 0 {
+		return gifs
+	}
+	blockedURLs := map[string]bool{}
+	for _, blocked := range blockedGifs {
+		blockedURLs[provider.GetGifID(blocked.GifURL)] = true
+	}
+	allowedGifs := []provider.Gif{}
+	for _, gif := range gifs {
+		if _, blocked := blockedGifs[provider.GetGifKey(gif)]; !blocked && !blockedURLs[provider.GetGifID(gif.URL)] {
+			allowedGifs = append(allowedGifs, gif)
+		}
+	}
+	return allowedGifs
+}
+
+// getPermalink returns the link to the post
+func (p *Plugin) getPermalink(postID string) string {
+	return strings.TrimSuffix(p.rootURL, "/plugins/"+manifest.Manifest.Id) + "/_redirect/pl/" + postID
+}
+
+// sendReportMessage informs the user of the result of the report with an ephemeral message of the bot
+func (p *Plugin) sendReportMessage(userID, channelID, message string) {
+	p.API.SendEphemeralPost(userID, &model.Post{
+		Message:   message,
+		UserId:    p.botID,
+		ChannelId: channelID,
+	})
+}
+
+// writeDialogResponse returns the errors of the dialog submission, if any, as the MM server expects them
+func writeDialogResponse(w http.ResponseWriter, response *model.SubmitDialogResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json, jsonErr := json.Marshal(response)
+	if jsonErr == nil {
+		_, _ = w.Write(json)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	manifest "github.com/moussetc/mattermost-plugin-giphy"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+const (
+	testReportChannelID = "report-channel"
+	testReportPostID    = "report-post"
+	testReportedGifURL  = "https://media.giphy.com/media/kitty42/giphy.gif"
+)
+
+var testReportedGif = provider.Gif{ID: "kitty42", Provider: "giphy", URL: testReportedGifURL}
+
+func initReportTest(t *testing.T) (*plugintest.API, *Plugin, *[]string) {
+	api, p := initMockAPI()
+	p.configuration.ReportChannelID = testReportChannelID
+	p.rootURL = "https://chat.test/plugins/" + manifest.Manifest.Id
+	api.On("GetUser", testUserID).Return(&model.User{Id: testUserID, Username: "gifuser"}, nil).Maybe()
+	api.On("GetChannel", testChannelID).Return(&model.Channel{Id: testChannelID, Name: "town-square"}, nil).Maybe()
+
+	return api, p, captureNotifications(t)
+}
+
+func sendReportRequest(p *Plugin, url string, body interface{}) *http.Response {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", url, bytes.NewBuffer(data))
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	p.handleHTTPRequest(w, r)
+	return w.Result()
+}
+
+func generateReportActionRequest(p *Plugin, postID string) model.PostActionIntegrationRequest {
+	return model.PostActionIntegrationRequest{
+		UserId:    testUserID,
+		ChannelId: testReportChannelID,
+		PostId:    testReportPostID,
+		Context:   newReportContext(p.contextSecret, postID, testReportedGif).toActionContext(),
+	}
+}
+
+// generateReportButtonRequest returns the request of the Report button of the GIF post testPostID
+func generateReportButtonRequest(p *Plugin) model.PostActionIntegrationRequest {
+	return model.PostActionIntegrationRequest{
+		UserId:    testUserID,
+		ChannelId: testChannelID,
+		PostId:    testPostID,
+		TriggerId: "trigger",
+		Context:   p.generateReportAttachments(testReportedGif)[0].Actions[0].Integration.Context,
+	}
+}
+
+func generateReportSubmitRequest(p *Plugin, reason string) model.SubmitDialogRequest {
+	state, _ := json.Marshal(newReportContext(p.contextSecret, testPostID, testReportedGif))
+	return model.SubmitDialogRequest{
+		UserId:     testUserID,
+		ChannelId:  testChannelID,
+		CallbackId: reportDialogCallback,
+		State:      string(state),
+		Submission: map[string]any{reportReasonElement: reason},
+	}
+}
+
+func TestGenerateReportAttachmentsShouldBeEmptyWithoutReportChannel(t *testing.T) {
+	_, p := initMockAPI()
+	assert.Nil(t, p.generateReportAttachments(testReportedGif))
+}
+
+func TestRespondWithGifShouldAddReportButton(t *testing.T) {
+	_, p, _ := initReportTest(t)
+
+	response, err := p.respondWithGif(p.configuration, &model.CommandArgs{UserId: testUserID, ChannelId: testChannelID}, "kitty", "", provider.NewGifFromURL(testReportedGifURL), "")
+
+	assert.Nil(t, err)
+	assert.Len(t, response.Attachments, 1)
+	action := response.Attachments[0].Actions[0]
+	assert.Equal(t, "Report", action.Name)
+	assert.Equal(t, "/plugins/"+manifest.Manifest.Id+URLReport, action.Integration.URL)
+	assert.Equal(t, testReportedGifURL, action.Integration.Context[contextGifURL])
+	assert.Nil(t, verifySignature(p.contextSecret, action.Integration.Context[contextSignature].(string), "", testReportedGifURL, testReportedGifURL, ""))
+}
+
+func TestHandleReportShouldOpenDialogWithSignedState(t *testing.T) {
+	api, p, _ := initReportTest(t)
+	var dialog model.OpenDialogRequest
+	api.On("OpenInteractiveDialog", mock.AnythingOfType("model.OpenDialogRequest")).Run(func(args mock.Arguments) {
+		dialog = args.Get(0).(model.OpenDialogRequest)
+	}).Return(nil)
+	gifPost := &model.Post{Id: testPostID, ChannelId: testChannelID}
+	gifPost.AddProp("attachments", p.generateReportAttachments(testReportedGif))
+	api.On("GetPost", testPostID).Return(gifPost, nil)
+	request := generateReportButtonRequest(p)
+
+	result := sendReportRequest(p, URLReport, request)
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "trigger", dialog.TriggerId)
+	var state reportContext
+	assert.Nil(t, json.Unmarshal([]byte(dialog.Dialog.State), &state))
+	assert.Equal(t, testPostID, state.PostID)
+	assert.Equal(t, newReportContext(p.contextSecret, testPostID, testReportedGif), state)
+}
+
+func TestHandleReportShouldRejectPostsWithoutTheReportButton(t *testing.T) {
+	api, p, _ := initReportTest(t)
+	api.On("LogError", mock.AnythingOfType("string"), "userId", testUserID, "url", URLReport, "error", mock.Anything).Return(nil)
+	otherGifPost := &model.Post{Id: "other-gif-post", ChannelId: testChannelID}
+	otherGifPost.AddProp("attachments", p.generateReportAttachments(provider.NewGifFromURL("https://media.giphy.com/media/other/giphy.gif")))
+	api.On("GetPost", "other-gif-post").Return(otherGifPost, nil)
+	api.On("GetPost", "text-post").Return(&model.Post{Id: "text-post", ChannelId: testChannelID, Message: testReportedGifURL}, nil)
+	api.On("GetPost", "deleted-post").Return(nil, &model.AppError{Message: "not found"})
+
+	for _, postID := range []string{"other-gif-post", "text-post", "deleted-post"} {
+		request := generateReportButtonRequest(p)
+		request.PostId = postID
+		assert.Equal(t, http.StatusForbidden, sendReportRequest(p, URLReport, request).StatusCode, postID)
+	}
+	api.AssertNotCalled(t, "OpenInteractiveDialog", mock.Anything)
+}
+
+func TestHandleReportShouldRejectTamperedRequests(t *testing.T) {
+	api, p, _ := initReportTest(t)
+	api.On("LogError", mock.AnythingOfType("string"), "userId", testUserID, "url", mock.Anything, "error", mock.Anything).Return(nil)
+	request := generateReportActionRequest(p, testPostID)
+	request.Context[contextGifURL] = "https://media.giphy.com/media/other/giphy.gif"
+
+	for _, url := range []string{URLReport, URLReportDelete, URLReportBlock} {
+		assert.Equal(t, http.StatusForbidden, sendReportRequest(p, url, request).StatusCode, url)
+	}
+	submit := generateReportSubmitRequest(p, "not funny")
+	submit.State = `{"postId":"other-post","gifUrl":"` + testReportedGifURL + `","signature":"42"}`
+	assert.Equal(t, http.StatusForbidden, sendReportRequest(p, URLReportSubmit, submit).StatusCode)
+}
+
+func TestHandleReportSubmitShouldSendTheReportToTheAdministratorsOnce(t *testing.T) {
+	api, p, _ := initReportTest(t)
+	api.On("GetPost", testPostID).Return(&model.Post{Id: testPostID, UserId: testUserID, ChannelId: testChannelID}, nil)
+	api.On("HasPermissionToChannel", testUserID, testChannelID, model.PermissionReadChannel).Return(true)
+	var reportPost *model.Post
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		reportPost = args.Get(0).(*model.Post)
+	}).Return(&model.Post{}, nil).Once()
+	messages := []string{}
+	api.On("SendEphemeralPost", testUserID, mock.AnythingOfType("*model.Post")).Run(func(args mock.Arguments) {
+		messages = append(messages, args.Get(1).(*model.Post).Message)
+	}).Return(nil)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, sendReportRequest(p, URLReportSubmit, generateReportSubmitRequest(p, " not funny ")).StatusCode)
+	}
+
+	assert.Equal(t, []string{"Thank you, the GIF was reported to the administrators.", "You already reported this GIF."}, messages)
+	assert.Equal(t, testReportChannelID, reportPost.ChannelId)
+	assert.Equal(t, p.botID, reportPost.UserId)
+	assert.Equal(t, "@gifuser reported [a GIF](https://chat.test/_redirect/pl/"+testPostID+") posted by @gifuser in ~town-square: not funny\n"+testReportedGifURL, reportPost.Message)
+	actions := reportPost.Attachments()[0].Actions
+	assert.Len(t, actions, 2)
+	assert.Equal(t, newReportContext(p.contextSecret, testPostID, testReportedGif).toActionContext(), actions[1].Integration.Context)
+
+	var reports gifReport
+	assert.Nil(t, p.pluginClient.KV.Get(reportKeyPrefix+testPostID, &reports))
+	assert.Equal(t, testReportedGifURL, reports.GifURL)
+	assert.Len(t, reports.Reports, 1)
+	assert.Equal(t, "not funny", reports.Reports[0].Reason)
+}
+
+func TestHandleReportSubmitShouldRequireReason(t *testing.T) {
+	_, p, _ := initReportTest(t)
+
+	result := sendReportRequest(p, URLReportSubmit, generateReportSubmitRequest(p, "  "))
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	var response model.SubmitDialogResponse
+	assert.Nil(t, json.NewDecoder(result.Body).Decode(&response))
+	assert.NotEmpty(t, response.Errors[reportReasonElement])
+}
+
+func mockReportPost(api *plugintest.API, p *Plugin) *model.Post {
+	reportPost := &model.Post{Id: testReportPostID, Message: "Reported"}
+	request := generateReportActionRequest(p, testPostID)
+	reportPost.AddProp("attachments", []*model.SlackAttachment{{Actions: []*model.PostAction{
+		generateButton("Delete the post", URLReportDelete, "danger", request.Context),
+		generateButton("Block the GIF", URLReportBlock, "danger", request.Context),
+	}}})
+	api.On("GetPost", testReportPostID).Return(reportPost, nil)
+	api.On("UpdatePost", mock.AnythingOfType("*model.Post")).Return(reportPost, nil)
+	return reportPost
+}
+
+func TestHandleReportDeleteShouldDeleteThePost(t *testing.T) {
+	api, p, notifications := initReportTest(t)
+	reportPost := mockReportPost(api, p)
+	api.On("GetPost", testPostID).Return(&model.Post{Id: testPostID, ChannelId: testChannelID}, nil)
+	api.On("HasPermissionToChannel", testUserID, testChannelID, model.PermissionDeleteOthersPosts).Return(true)
+	api.On("DeletePost", testPostID).Return(nil)
+
+	result := sendReportRequest(p, URLReportDelete, generateReportActionRequest(p, testPostID))
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, *notifications)
+	api.AssertCalled(t, "DeletePost", testPostID)
+	assert.Equal(t, "Reported\n*The post was deleted by @gifuser.*", reportPost.Message)
+	actions := reportPost.Attachments()[0].Actions
+	assert.Len(t, actions, 1)
+	assert.Equal(t, "Block the GIF", actions[0].Name)
+}
+
+func TestHandleReportDeleteShouldRequirePermission(t *testing.T) {
+	api, p, notifications := initReportTest(t)
+	api.On("GetPost", testPostID).Return(&model.Post{Id: testPostID, ChannelId: testChannelID}, nil)
+	api.On("HasPermissionToChannel", testUserID, testChannelID, model.PermissionDeleteOthersPosts).Return(false)
+
+	result := sendReportRequest(p, URLReportDelete, generateReportActionRequest(p, testPostID))
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, []string{"You are not allowed to delete the posts of this channel."}, *notifications)
+	api.AssertNotCalled(t, "DeletePost", mock.Anything)
+}
+
+func TestHandleReportBlockShouldRemoveTheGifFromTheSearches(t *testing.T) {
+	api, p, notifications := initReportTest(t)
+	reportPost := mockReportPost(api, p)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(true)
+	otherGifURL := "https://media.giphy.com/media/other/giphy.gif"
+	// The same GIF may be served by another server of the provider
+	sameGifURL := "https://media3.giphy.com/media/kitty42/giphy.gif?cid=42"
+	assert.Equal(t, newTestGifs(sameGifURL, otherGifURL), p.removeBlockedGifs(newTestGifs(sameGifURL, otherGifURL)))
+
+	result := sendReportRequest(p, URLReportBlock, generateReportActionRequest(p, testPostID))
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Empty(t, *notifications)
+	assert.Equal(t, newTestGifs(otherGifURL), p.removeBlockedGifs(newTestGifs(sameGifURL, otherGifURL)))
+	assert.Equal(t, "Reported\n*The GIF was blocked by @gifuser.*", reportPost.Message)
+}
+
+func TestBlockGifShouldRemoveAllTheRenditionsOfTheGif(t *testing.T) {
+	_, p, _ := initReportTest(t)
+	blockedURL := "https://media.tenor.com/AAAA/kitty.gif"
+	assert.Nil(t, p.blockGif(provider.Gif{ID: "tenor42", Provider: "tenor", URL: blockedURL}, testUserID))
+
+	otherRendition := provider.Gif{ID: "tenor42", Provider: "tenor", URL: "https://media.tenor.com/BBBB/kitty.mp4"}
+	otherGif := provider.Gif{ID: "tenor43", Provider: "tenor", URL: "https://media.tenor.com/CCCC/puppy.gif"}
+	otherProvider := provider.Gif{ID: "tenor42", Provider: "giphy", URL: "https://media.giphy.com/media/tenor42/giphy.gif"}
+	savedGif := provider.NewGifFromURL(blockedURL + "?cid=42")
+
+	assert.Equal(t, []provider.Gif{otherGif, otherProvider}, p.removeBlockedGifs([]provider.Gif{otherRendition, otherGif, otherProvider, savedGif}))
+}
+
+func TestHandleReportBlockShouldBeRefusedToOtherUsers(t *testing.T) {
+	api, p, notifications := initReportTest(t)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+
+	result := sendReportRequest(p, URLReportBlock, generateReportActionRequest(p, testPostID))
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, []string{"Only the system administrators can block a GIF."}, *notifications)
+	assert.Equal(t, newTestGifs(testReportedGifURL), p.removeBlockedGifs(newTestGifs(testReportedGifURL)))
+}
+
+func TestSearchGifsShouldNotReturnBlockedGifs(t *testing.T) {
+	_, p, _ := initReportTest(t)
+	p.gifProvider = newMockGifProvider()
+	assert.Nil(t, p.blockGif(provider.NewGifFromURL("fakeURL"), testUserID))
+
+	cursor := ""
+	gifs, err := p.searchGifs(p.configuration, "kitty", "gif", false, &cursor)
+
+	assert.Nil(t, err)
+	assert.Empty(t, gifs)
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	manifest "github.com/moussetc/mattermost-plugin-giphy"
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the settings overridden for a team or a channel, managed with /gif settings
+
+const (
+	commandSettings = "settings"
+
+	settingsKeyPrefix    = "settings_"
+	settingsScopeTeam    = "team"
+	settingsScopeChannel = "channel"
+	settingsValueDefault = "default"
+
+	settingProvider    = "provider"
+	settingRating      = "rating"
+	settingLanguage    = "language"
+	settingDisplayMode = "display"
+	settingPreview     = "preview"
+	settingTimezone    = "timezone"
+
+	settingPreviewOn  = "on"
+	settingPreviewOff = "off"
+)
+
+// settingsOverrides are the values of the settings overridden for a team or a channel, by setting name
+type settingsOverrides map[string]string
+
+// overridableSetting is a setting of the configuration that can be overridden for a team or a channel
+type overridableSetting struct {
+	name        string
+	description string
+	// values returns the allowed values of the setting
+	values func() []string
+	// parse returns the value of a setting that accepts other values than the listed values,
+	// described by format, or an empty string if the value is not valid
+	parse  func(value string) string
+	format string
+	// get returns the value of the setting in the configuration
+	get func(c *pluginConf.Configuration) string
+	// set changes the value of the setting in the configuration
+	set func(c *pluginConf.Configuration, value string)
+	// teamOnly is true for the settings that can only be overridden for a team, by its administrators,
+	// like the time zone of the quiet hours that channel administrators must not move
+	teamOnly bool
+}
+
+// getOverridableSettings returns the settings that can be overridden, in the order they are listed
+func getOverridableSettings() []overridableSetting {
+	return []overridableSetting{
+		{
+			name:        settingProvider,
+			description: "GIF provider",
+			values:      func() []string { return getManifestSettingOptions("Provider") },
+			get:         func(c *pluginConf.Configuration) string { return c.Provider },
+			set:         func(c *pluginConf.Configuration, value string) { c.SetProvider(value) },
+		},
+		{
+			name:        settingRating,
+			description: "Content rating",
+			values:      func() []string { return getManifestSettingOptions("Rating") },
+			get:         func(c *pluginConf.Configuration) string { return c.Rating },
+			set:         func(c *pluginConf.Configuration, value string) { c.Rating = value },
+		},
+		{
+			name:        settingLanguage,
+			description: "Language of the searches",
+			values:      func() []string { return getManifestSettingOptions("Language") },
+			get:         func(c *pluginConf.Configuration) string { return c.Language },
+			set:         func(c *pluginConf.Configuration, value string) { c.Language = value },
+		},
+		{
+			name:        settingDisplayMode,
+			description: "Display of the posted GIFs",
+			values:      func() []string { return getManifestSettingOptions("DisplayMode") },
+			get:         func(c *pluginConf.Configuration) string { return c.DisplayMode },
+			set:         func(c *pluginConf.Configuration, value string) { c.DisplayMode = value },
+		},
+		{
+			name:        settingPreview,
+			description: "Preview required before posting",
+			values:      func() []string { return []string{settingPreviewOn, settingPreviewOff} },
+			get: func(c *pluginConf.Configuration) string {
+				if c.DisablePostingWithoutPreview {
+					return settingPreviewOn
+				}
+				return settingPreviewOff
+			},
+			set: func(c *pluginConf.Configuration, value string) {
+				c.DisablePostingWithoutPreview = value == settingPreviewOn
+			},
+		},
+		{
+			name:        settingTimezone,
+			description: "Time zone of the quiet hours",
+			values:      func() []string { return []string{} },
+			parse: func(value string) string {
+				if location, err := pluginConf.LoadTimezone(value); err == nil {
+					return location.String()
+				}
+				return ""
+			},
+			format: "a time zone name like Europe/Paris",
+			get: func(c *pluginConf.Configuration) string {
+				if c.QuietHoursTimezone == "" {
+					return "UTC"
+				}
+				return c.QuietHoursTimezone
+			},
+			set:      func(c *pluginConf.Configuration, value string) { c.QuietHoursTimezone = value },
+			teamOnly: true,
+		},
+	}
+}
+
+// normalize returns the allowed value of the setting matching the typed value, or an empty string if it is not valid
+func (s *overridableSetting) normalize(value string) string {
+	if s.parse != nil {
+		return s.parse(value)
+	}
+	return findSettingValue(s.values(), value)
+}
+
+// describeValues explains the allowed values of the setting, including the value resetting it
+func (s *overridableSetting) describeValues() string {
+	if s.format != "" {
+		return s.format + " or " + settingsValueDefault
+	}
+	return strings.Join(append(s.values(), settingsValueDefault), ", ")
+}
+
+// getOverridableSetting returns the setting with this name, or nil if it can't be overridden
+func getOverridableSetting(name string) *overridableSetting {
+	for _, setting := range getOverridableSettings() {
+		if setting.name == strings.ToLower(name) {
+			return &setting
+		}
+	}
+	return nil
+}
+
+// getManifestSettingOptions returns the values of the options of a setting of the plugin manifest
+func getManifestSettingOptions(key string) []string {
+	values := []string{}
+	if manifest.Manifest.SettingsSchema == nil {
+		return values
+	}
+	for _, setting := range manifest.Manifest.SettingsSchema.Settings {
+		if setting.Key != key {
+			continue
+		}
+		for _, option := range setting.Options {
+			values = append(values, option.Value)
+		}
+	}
+	return values
+}
+
+// apply overrides the settings of the configuration
+func (o settingsOverrides) apply(c *pluginConf.Configuration) {
+	for _, setting := range getOverridableSettings() {
+		if value, ok := o[setting.name]; ok {
+			setting.set(c, value)
+		}
+	}
+}
+
+func getSettingsKey(scope, id string) string {
+	return settingsKeyPrefix + scope + "_" + id
+}
+
+func (p *Plugin) getSettingsOverrides(scope, id string) (settingsOverrides, error) {
+	overrides := settingsOverrides{}
+	if id == "" {
+		return overrides, nil
+	}
+	if err := p.pluginClient.KV.Get(getSettingsKey(scope, id), &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+func (p *Plugin) updateSettingsOverrides(scope, id string, update func(overrides settingsOverrides) settingsOverrides) error {
+	return p.pluginClient.KV.SetAtomicWithRetries(getSettingsKey(scope, id), func(oldValue []byte) (interface{}, error) {
+		overrides := settingsOverrides{}
+		if len(oldValue) > 0 {
+			if err := json.Unmarshal(oldValue, &overrides); err != nil {
+				return nil, err
+			}
+		}
+		if overrides = update(overrides); len(overrides) == 0 {
+			return nil, nil
+		}
+		return overrides, nil
+	})
+}
+
+// getChannelConfiguration returns the configuration with the settings overridden for the team, then for the channel.
+// The configuration of the server is returned if the overridden settings can't be read or are no longer valid.
+func (p *Plugin) getChannelConfiguration(teamID, channelID string) *pluginConf.Configuration {
+	teamOverrides, channelOverrides, err := p.getTeamAndChannelOverrides(teamID, channelID)
+	if err != nil {
+		p.API.LogWarn("Unable to read the GIF settings of the channel", "channelId", channelID, "error", err.Error())
+		return p.getConfiguration()
+	}
+	config, err := p.overrideConfiguration(teamOverrides, channelOverrides)
+	if err != nil {
+		p.API.LogWarn("The GIF settings of the channel are not valid anymore, the settings of the server are used", "channelId", channelID, "error", err.Error())
+		return p.getConfiguration()
+	}
+	return config
+}
+
+func (p *Plugin) getTeamAndChannelOverrides(teamID, channelID string) (settingsOverrides, settingsOverrides, error) {
+	teamOverrides, err := p.getSettingsOverrides(settingsScopeTeam, teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	channelOverrides, err := p.getSettingsOverrides(settingsScopeChannel, channelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The team settings may have been saved for a channel before they were restricted to the teams
+	for _, setting := range getOverridableSettings() {
+		if setting.teamOnly {
+			delete(channelOverrides, setting.name)
+		}
+	}
+	return teamOverrides, channelOverrides, nil
+}
+
+// overrideConfiguration returns the configuration of the server with the overridden settings applied in order,
+// or an error if the resulting configuration is not valid
+func (p *Plugin) overrideConfiguration(overrides ...settingsOverrides) (*pluginConf.Configuration, error) {
+	config := p.getConfiguration()
+	overridden := false
+	for _, o := range overrides {
+		overridden = overridden || len(o) > 0
+	}
+	if !overridden {
+		return config, nil
+	}
+
+	config = config.Clone()
+	for _, o := range overrides {
+		o.apply(config)
+	}
+	if err := config.IsValid(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// getGifProvider returns the GIF provider of the configuration, which may have overridden settings
+func (p *Plugin) getGifProvider(config *pluginConf.Configuration) provider.GifProvider {
+	key := config.GetCacheKeyPrefix()
+	if config == p.getConfiguration() || key == p.getConfiguration().GetCacheKeyPrefix() {
+		return p.gifProvider
+	}
+
+	p.overriddenGifProvidersLock.Lock()
+	defer p.overriddenGifProvidersLock.Unlock()
+	if gifProvider, ok := p.overriddenGifProviders[key]; ok {
+		return gifProvider
+	}
+	gifProvider, err := p.newGifProvider(config)
+	if err != nil {
+		p.API.LogWarn("Unable to create the GIF provider of the overridden settings, the provider of the server is used", "error", err.Error())
+		return p.gifProvider
+	}
+	if p.overriddenGifProviders == nil {
+		p.overriddenGifProviders = map[string]provider.GifProvider{}
+	}
+	p.overriddenGifProviders[key] = gifProvider
+	return gifProvider
+}
+
+// resetOverriddenGifProviders removes the GIF providers of the overridden settings, built from an older configuration
+func (p *Plugin) resetOverriddenGifProviders() {
+	p.overriddenGifProvidersLock.Lock()
+	defer p.overriddenGifProvidersLock.Unlock()
+	p.overriddenGifProviders = nil
+}
+
+// executeCommandSettings lists the settings of the channel, or overrides a setting for the channel or the team
+func (p *Plugin) executeCommandSettings(arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(arguments)
+	if len(fields) == 0 {
+		return p.executeCommandSettingsList(args)
+	}
+	if len(fields) != 3 || (fields[0] != settingsScopeChannel && fields[0] != settingsScopeTeam) {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Could not read the setting, try `/%s %s %s|%s [setting] [value|%s]`.", triggerGif, commandSettings, settingsScopeChannel, settingsScopeTeam, settingsValueDefault))
+	}
+	return p.executeCommandSettingsSet(fields[0], fields[1], fields[2], args)
+}
+
+func (p *Plugin) executeCommandSettingsList(args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	teamOverrides, channelOverrides, err := p.getTeamAndChannelOverrides(args.TeamId, args.ChannelId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load the GIF settings of the channel", err)
+	}
+	config := p.getChannelConfiguration(args.TeamId, args.ChannelId)
+
+	lines := []string{"GIF settings of this channel:"}
+	for _, setting := range getOverridableSettings() {
+		origin := "server"
+		if _, ok := channelOverrides[setting.name]; ok {
+			origin = settingsScopeChannel
+		} else if _, ok := teamOverrides[setting.name]; ok {
+			origin = settingsScopeTeam
+		}
+		lines = append(lines, fmt.Sprintf("- %s (`%s`): **%s** (%s setting)", setting.description, setting.name, setting.get(config), origin))
+	}
+	lines = append(lines, fmt.Sprintf("Channel administrators can change them with `/%s %s %s [setting] [value|%s]`, team administrators with `/%s %s %s [setting] [value|%s]`.",
+		triggerGif, commandSettings, settingsScopeChannel, settingsValueDefault, triggerGif, commandSettings, settingsScopeTeam, settingsValueDefault))
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+func (p *Plugin) executeCommandSettingsSet(scope, name, value string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	if !p.canManageSettings(scope, args) {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Only the %s administrators can change the GIF settings of the %s.", scope, scope))
+	}
+	setting := getOverridableSetting(name)
+	if setting == nil {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown setting %s, the settings are: %s.", name, strings.Join(getOverridableSettingNames(), ", ")))
+	}
+	if setting.teamOnly && scope != settingsScopeTeam {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("The setting %s can only be changed for the whole team by its administrators, with `/%s %s %s %s [value|%s]`.", setting.name, triggerGif, commandSettings, settingsScopeTeam, setting.name, settingsValueDefault))
+	}
+	if value != settingsValueDefault {
+		value = setting.normalize(value)
+		if value == "" {
+			return p.sendEphemeralBotMessage(args, fmt.Sprintf("Unknown value for the setting %s, the values are: %s.", setting.name, setting.describeValues()))
+		}
+	}
+	if setting.name == settingPreview && value == settingPreviewOff && p.getConfiguration().DisablePostingWithoutPreview {
+		return p.sendEphemeralBotMessage(args, "The preview is required on the whole server by the System Console, it can't be turned off for a team or a channel.")
+	}
+
+	id := args.ChannelId
+	if scope == settingsScopeTeam {
+		id = args.TeamId
+	}
+	update := func(overrides settingsOverrides) settingsOverrides {
+		if value == settingsValueDefault {
+			delete(overrides, setting.name)
+		} else {
+			overrides[setting.name] = value
+		}
+		return overrides
+	}
+
+	// Check that the setting works with the other settings of the channel before saving it
+	teamOverrides, channelOverrides, err := p.getTeamAndChannelOverrides(args.TeamId, args.ChannelId)
+	if err != nil {
+		return nil, p.errorGenerator.FromError("Unable to load the GIF settings of the channel", err)
+	}
+	if scope == settingsScopeTeam {
+		teamOverrides = update(teamOverrides)
+	} else {
+		channelOverrides = update(channelOverrides)
+	}
+	if _, err = p.overrideConfiguration(teamOverrides, channelOverrides); err != nil {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("The setting %s can't be changed: %s.", setting.name, err.Error()))
+	}
+
+	if err = p.updateSettingsOverrides(scope, id, update); err != nil {
+		return nil, p.errorGenerator.FromError("Unable to save the GIF settings", err)
+	}
+	if value == settingsValueDefault {
+		return p.sendEphemeralBotMessage(args, fmt.Sprintf("The %s uses the default value of the setting %s again.", scope, setting.name))
+	}
+	return p.sendEphemeralBotMessage(args, fmt.Sprintf("The setting %s of the %s is now **%s**.", setting.name, scope, value))
+}
+
+// canManageSettings returns true if the user is an administrator of the channel or of the team, depending on the scope
+func (p *Plugin) canManageSettings(scope string, args *model.CommandArgs) bool {
+	if scope == settingsScopeChannel && p.API.HasPermissionToChannel(args.UserId, args.ChannelId, model.PermissionManageChannelRoles) {
+		return true
+	}
+	return p.API.HasPermissionToTeam(args.UserId, args.TeamId, model.PermissionManageTeam) ||
+		p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem)
+}
+
+func getOverridableSettingNames() []string {
+	names := []string{}
+	for _, setting := range getOverridableSettings() {
+		names = append(names, setting.name)
+	}
+	return names
+}
+
+// findSettingValue returns the allowed value matching the value (ignoring case), or an empty string if there is none
+func findSettingValue(values []string, value string) string {
+	for _, allowed := range values {
+		if strings.EqualFold(allowed, value) {
+			return allowed
+		}
+	}
+	return ""
+}
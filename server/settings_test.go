@@ -0,0 +1,204 @@
+package main
+
+import (
+	"testing"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+func initSettingsTest(isChannelAdmin, isTeamAdmin bool) (*plugintest.API, *Plugin, *string) {
+	api, p := initMockAPI()
+	p.rootURL = "https://mattermost.example.com/plugins/giphy"
+	api.On("HasPermissionToChannel", testUserID, testChannelID, model.PermissionManageChannelRoles).Return(isChannelAdmin)
+	api.On("HasPermissionToTeam", testUserID, testTeamID, model.PermissionManageTeam).Return(isTeamAdmin)
+	api.On("HasPermissionTo", testUserID, model.PermissionManageSystem).Return(false)
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	return api, p, captureEphemeral(api)
+}
+
+func executeSettingsCommand(t *testing.T, p *Plugin, command string) {
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: command, UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+	assert.Nil(t, err)
+}
+
+func TestGetChannelConfigurationShouldReturnServerConfigurationWithoutOverrides(t *testing.T) {
+	_, p := initMockAPI()
+	assert.Same(t, p.configuration, p.getChannelConfiguration(testTeamID, testChannelID))
+}
+
+func TestGetChannelConfigurationShouldApplyTeamThenChannelOverrides(t *testing.T) {
+	_, p := initMockAPI()
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeTeam, testTeamID), settingsOverrides{settingRating: "pg", settingLanguage: "ja"})
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeChannel, testChannelID), settingsOverrides{settingRating: "g", settingPreview: settingPreviewOn})
+
+	config := p.getChannelConfiguration(testTeamID, testChannelID)
+
+	assert.Equal(t, "g", config.Rating)
+	assert.Equal(t, "ja", config.Language)
+	assert.True(t, config.DisablePostingWithoutPreview)
+	assert.Equal(t, pluginConf.DisplayModeEmbedded, config.DisplayMode)
+	assert.Equal(t, "none", p.getConfiguration().Rating)
+	assert.Equal(t, "pg", p.getChannelConfiguration(testTeamID, "another-channel").Rating)
+}
+
+func TestGetChannelConfigurationShouldIgnoreOverridesNoLongerValid(t *testing.T) {
+	api, p := initMockAPI()
+	api.On("LogWarn", mock.AnythingOfType("string"), mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeChannel, testChannelID), settingsOverrides{settingProvider: "tenor"})
+
+	assert.Same(t, p.configuration, p.getChannelConfiguration(testTeamID, testChannelID))
+}
+
+func TestSetProviderShouldKeepTheAPIKeyOfThePreviousProvider(t *testing.T) {
+	config := generateMockPluginConfig()
+	config.FallbackProviders = "giphy"
+	config.TenorAPIKey = "tenorKey"
+
+	config.SetProvider("tenor")
+
+	assert.Equal(t, "tenorKey", config.GetAPIKey("tenor"))
+	assert.Equal(t, "defaultAPIKey", config.GetAPIKey("giphy"))
+	assert.Nil(t, config.IsValid())
+}
+
+func TestGetGifProviderShouldCreateProviderForOverriddenSettings(t *testing.T) {
+	_, p := initMockAPI()
+	p.rootURL = "https://mattermost.example.com/plugins/giphy"
+	p.gifProvider = newMockGifProvider()
+	config := p.configuration.Clone()
+	config.Rating = "g"
+
+	gifProvider := p.getGifProvider(config)
+
+	assert.NotEqual(t, p.gifProvider, gifProvider)
+	assert.Same(t, gifProvider, p.getGifProvider(config))
+	assert.Equal(t, p.gifProvider, p.getGifProvider(p.configuration))
+	config.DisplayMode = pluginConf.DisplayModeFullURL
+	config.Rating = p.configuration.Rating
+	assert.Equal(t, p.gifProvider, p.getGifProvider(config))
+}
+
+func TestExecuteCommandSettingsShouldOverrideChannelSetting(t *testing.T) {
+	_, p, message := initSettingsTest(true, false)
+
+	executeSettingsCommand(t, p, "/gif settings channel rating G")
+
+	assert.Contains(t, *message, "now **g**")
+	assert.Equal(t, "g", p.getChannelConfiguration(testTeamID, testChannelID).Rating)
+}
+
+func TestExecuteCommandSettingsShouldResetSettingToDefault(t *testing.T) {
+	_, p, message := initSettingsTest(false, true)
+	executeSettingsCommand(t, p, "/gif settings team language ja")
+
+	executeSettingsCommand(t, p, "/gif settings team language default")
+
+	assert.Contains(t, *message, "default value")
+	assert.Equal(t, "fr", p.getChannelConfiguration(testTeamID, testChannelID).Language)
+	overrides, _ := p.getSettingsOverrides(settingsScopeTeam, testTeamID)
+	assert.Empty(t, overrides)
+}
+
+func TestExecuteCommandSettingsShouldRefuseUsersWhoAreNotAdministrators(t *testing.T) {
+	_, p, message := initSettingsTest(true, false)
+
+	executeSettingsCommand(t, p, "/gif settings team rating g")
+
+	assert.Contains(t, *message, "Only the team administrators")
+	assert.Equal(t, "none", p.getChannelConfiguration(testTeamID, testChannelID).Rating)
+}
+
+func TestExecuteCommandSettingsShouldRefuseInvalidSettings(t *testing.T) {
+	_, p, message := initSettingsTest(true, true)
+
+	executeSettingsCommand(t, p, "/gif settings channel color blue")
+	assert.Contains(t, *message, "Unknown setting color")
+
+	executeSettingsCommand(t, p, "/gif settings channel rating nc-17")
+	assert.Contains(t, *message, "Unknown value")
+
+	executeSettingsCommand(t, p, "/gif settings channel provider tenor")
+	assert.Contains(t, *message, "can't be changed")
+
+	executeSettingsCommand(t, p, "/gif settings team timezone Mars/Olympus_Mons")
+	assert.Contains(t, *message, "a time zone name like Europe/Paris or default")
+
+	p.configuration.DisablePostingWithoutPreview = true
+	executeSettingsCommand(t, p, "/gif settings channel preview off")
+	assert.Contains(t, *message, "required on the whole server")
+
+	overrides, _ := p.getSettingsOverrides(settingsScopeChannel, testChannelID)
+	assert.Empty(t, overrides)
+}
+
+func TestExecuteCommandSettingsShouldOnlyChangeTheTimezoneForTheTeam(t *testing.T) {
+	_, p, message := initSettingsTest(true, true)
+
+	executeSettingsCommand(t, p, "/gif settings channel timezone Asia/Tokyo")
+	assert.Contains(t, *message, "can only be changed for the whole team")
+	overrides, _ := p.getSettingsOverrides(settingsScopeChannel, testChannelID)
+	assert.Empty(t, overrides)
+
+	executeSettingsCommand(t, p, "/gif settings team timezone Asia/Tokyo")
+	assert.Contains(t, *message, "now **Asia/Tokyo**")
+	assert.Equal(t, "Asia/Tokyo", p.getChannelConfiguration(testTeamID, testChannelID).QuietHoursTimezone)
+}
+
+func TestExecuteCommandSettingsShouldRefuseTheTimezoneToChannelAdministrators(t *testing.T) {
+	_, p, message := initSettingsTest(true, false)
+
+	executeSettingsCommand(t, p, "/gif settings team timezone Asia/Tokyo")
+
+	assert.Contains(t, *message, "Only the team administrators")
+	assert.Equal(t, "", p.getChannelConfiguration(testTeamID, testChannelID).QuietHoursTimezone)
+}
+
+func TestGetChannelConfigurationShouldIgnoreTheTimezoneOfTheChannel(t *testing.T) {
+	_, p := initMockAPI()
+	_, _ = p.pluginClient.KV.Set(getSettingsKey(settingsScopeChannel, testChannelID), settingsOverrides{settingTimezone: "Asia/Tokyo", settingRating: "g"})
+
+	config := p.getChannelConfiguration(testTeamID, testChannelID)
+
+	assert.Equal(t, "", config.QuietHoursTimezone)
+	assert.Equal(t, "g", config.Rating)
+}
+
+func TestExecuteCommandSettingsShouldListSettingsWithTheirOrigin(t *testing.T) {
+	_, p, message := initSettingsTest(true, true)
+	executeSettingsCommand(t, p, "/gif settings team rating pg")
+	executeSettingsCommand(t, p, "/gif settings channel language ja")
+
+	executeSettingsCommand(t, p, "/gif settings")
+
+	assert.Contains(t, *message, "(`rating`): **pg** (team setting)")
+	assert.Contains(t, *message, "(`language`): **ja** (channel setting)")
+	assert.Contains(t, *message, "(`provider`): **giphy** (server setting)")
+	assert.Contains(t, *message, "(`timezone`): **UTC** (server setting)")
+}
+
+func TestExecuteCommandShouldPreviewWhenChannelRequiresPreview(t *testing.T) {
+	api, p, _ := initSettingsTest(true, false)
+	p.gifProvider = newMockGifProvider()
+	executeSettingsCommand(t, p, "/gif settings channel preview on")
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif kitty", UserId: testUserID, ChannelId: testChannelID, TeamId: testTeamID})
+
+	assert.Nil(t, err)
+	assert.NotEqual(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	api.AssertCalled(t, "SendEphemeralPost", testUserID, mock.MatchedBy(func(post *model.Post) bool {
+		return post.UserId == p.botID && len(post.Attachments()) > 0
+	}))
+}
+
+func TestHandleAutocompleteShouldSuggestSettings(t *testing.T) {
+	_, p := initMockAPI()
+
+	assert.Equal(t, []string{settingsScopeChannel, settingsScopeTeam}, getAutocompleteItemNames(requestAutocomplete(p, "/gif settings ", "")))
+	assert.Equal(t, []string{settingRating}, getAutocompleteItemNames(requestAutocomplete(p, "/gif settings channel ", "ra")))
+	assert.Equal(t, []string{"pg", "pg-13"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif settings channel rating ", "pg")))
+}
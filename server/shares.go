@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	pluginConf "github.com/moussetc/mattermost-plugin-giphy/server/internal/configuration"
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+)
+
+// Contains what's related to telling the GIF providers which of their GIFs are posted, as their terms ask
+
+// shareRegistrationAttempts is the number of times the registration of a share is tried before giving up
+const shareRegistrationAttempts = 3
+
+// shareRegistrationRetryDelay is the delay before the first retry of a failed registration, doubled for each next retry
+var shareRegistrationRetryDelay = 2 * time.Second
+
+// registerGifShare tells the provider of the GIF that it was posted after a search for the query (empty for the
+// trending GIFs). The registration runs in the background and is retried when the provider fails, so that the post
+// is never delayed by the provider.
+func (p *Plugin) registerGifShare(config *pluginConf.Configuration, gif provider.Gif, query string) {
+	if !config.RegisterShares {
+		return
+	}
+	gifProvider := p.getGifProvider(config)
+	go func() {
+		delay := shareRegistrationRetryDelay
+		for attempt := 1; ; attempt++ {
+			registered, err := provider.RegisterShare(gifProvider, gif, query)
+			if !registered || err == nil {
+				return
+			}
+			if attempt >= shareRegistrationAttempts {
+				p.API.LogWarn("Unable to register the share of the GIF with its provider", "gifId", gif.ID, "error", err.Error())
+				return
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
+
+// getShareQuery returns the search query that found the GIFs, or an empty query for the trending GIFs
+func getShareQuery(keywords string, trending bool) string {
+	if trending {
+		return ""
+	}
+	return keywords
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/moussetc/mattermost-plugin-giphy/server/internal/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest/mock"
+)
+
+// shareReporterGifProvider records the registered shares, and fails the first registrations if configured
+type shareReporterGifProvider struct {
+	mockGifProvider
+	lock     sync.Mutex
+	failures int
+	attempts int
+	queries  []string
+}
+
+func (m *shareReporterGifProvider) RegisterShare(_ provider.Gif, query string) (bool, *model.AppError) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.attempts++
+	if m.attempts <= m.failures {
+		return true, test.MockErrorGenerator().FromError("registration failed", errors.New("registration failed"))
+	}
+	m.queries = append(m.queries, query)
+	return true, nil
+}
+
+func (m *shareReporterGifProvider) getAttempts() (int, []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.attempts, append([]string{}, m.queries...)
+}
+
+func initSharesTest(t *testing.T, failures int) (*plugintest.API, *Plugin, *shareReporterGifProvider) {
+	api, p := initMockAPI()
+	p.configuration.RegisterShares = true
+	gifProvider := &shareReporterGifProvider{mockGifProvider: *newMockGifProvider(), failures: failures}
+	p.gifProvider = gifProvider
+	previousDelay := shareRegistrationRetryDelay
+	shareRegistrationRetryDelay = time.Millisecond
+	t.Cleanup(func() { shareRegistrationRetryDelay = previousDelay })
+	return api, p, gifProvider
+}
+
+func assertRegisteredShares(t *testing.T, gifProvider *shareReporterGifProvider, expectedAttempts int, expectedQueries []string) {
+	assert.Eventually(t, func() bool {
+		attempts, _ := gifProvider.getAttempts()
+		return attempts == expectedAttempts
+	}, time.Second, time.Millisecond)
+	_, queries := gifProvider.getAttempts()
+	assert.Equal(t, expectedQueries, queries)
+}
+
+func TestExecuteCommandGifShouldRegisterTheShareOfThePostedGif(t *testing.T) {
+	_, p, gifProvider := initSharesTest(t, 0)
+
+	_, err := p.executeCommandGif(testKeywords, "", "", provider.MediaTypeGif, testArgs)
+	assert.Nil(t, err)
+	assertRegisteredShares(t, gifProvider, 1, []string{testKeywords})
+}
+
+func TestExecuteCommandTrendingShouldRegisterTheShareWithoutQuery(t *testing.T) {
+	_, p, gifProvider := initSharesTest(t, 0)
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif trending", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assertRegisteredShares(t, gifProvider, 1, []string{""})
+}
+
+func TestHandleSendShouldRegisterTheShareOfThePostedGif(t *testing.T) {
+	api, p, gifProvider := initSharesTest(t, 0)
+	api.On("DeleteEphemeralPost", mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(nil)
+	api.On("CreatePost", mock.AnythingOfType("*model.Post")).Return(&model.Post{Id: testPostID}, nil)
+
+	w := httptest.NewRecorder()
+	(&defaultHTTPHandler{}).handleSend(p, w, generateTestIntegrationRequest(1))
+	assert.Equal(t, http.StatusOK, w.Result().StatusCode)
+	assertRegisteredShares(t, gifProvider, 1, []string{testKeywords})
+}
+
+func TestRegisterGifShareShouldRetryWhenTheProviderFails(t *testing.T) {
+	_, p, gifProvider := initSharesTest(t, 2)
+
+	p.registerGifShare(p.configuration, provider.NewGifFromURL(testGifURL), testKeywords)
+	assertRegisteredShares(t, gifProvider, 3, []string{testKeywords})
+}
+
+func TestRegisterGifShareShouldLogWhenAllAttemptsFail(t *testing.T) {
+	api, p, gifProvider := initSharesTest(t, shareRegistrationAttempts)
+	logged := make(chan bool, 1)
+	api.On("LogWarn", "Unable to register the share of the GIF with its provider", "gifId", testGifURL, "error", mock.AnythingOfType("string")).Run(func(_ mock.Arguments) {
+		logged <- true
+	}).Return(nil)
+
+	p.registerGifShare(p.configuration, provider.NewGifFromURL(testGifURL), testKeywords)
+	select {
+	case <-logged:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the failed registration was not logged")
+	}
+	attempts, queries := gifProvider.getAttempts()
+	assert.Equal(t, shareRegistrationAttempts, attempts)
+	assert.Empty(t, queries)
+}
+
+func TestRegisterGifShareShouldDoNothingWhenDisabled(t *testing.T) {
+	_, p, gifProvider := initSharesTest(t, 0)
+	p.configuration.RegisterShares = false
+
+	_, err := p.executeCommandGif(testKeywords, "", "", provider.MediaTypeGif, testArgs)
+	assert.Nil(t, err)
+	time.Sleep(10 * time.Millisecond)
+	attempts, _ := gifProvider.getAttempts()
+	assert.Equal(t, 0, attempts)
+}
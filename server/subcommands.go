@@ -0,0 +1,402 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// Contains what's related to the subcommands of the GIF commands (/gif fav, /gif alias, etc.) and their autocompletion
+
+const (
+	commandHelp     = "help"
+	commandTrending = "trending"
+
+	URLAutocomplete = "/autocomplete"
+
+	// autocompleteArgumentCount is the number of words of the command that can be suggested
+	autocompleteArgumentCount = 4
+)
+
+type subcommand struct {
+	name        string
+	hint        string
+	description string
+	// postsGifs is true if the subcommand posts GIFs, so it can't be used where the GIFs are disabled
+	postsGifs bool
+	execute   func(p *Plugin, arguments string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError)
+	// suggest returns the suggestions for the next argument of the subcommand
+	suggest func(p *Plugin, request *autocompleteRequest) []model.AutocompleteListItem
+}
+
+// autocompleteRequest describes the argument being typed by the user
+type autocompleteRequest struct {
+	userID    string
+	teamID    string
+	channelID string
+	// arguments are the arguments already typed after the subcommand
+	arguments []string
+	userInput string
+}
+
+// getSubcommands returns the subcommands available for all the GIF commands, in the order of the help message
+func getSubcommands() []subcommand {
+	return []subcommand{
+		{
+			name:        commandFavorite,
+			hint:        "[name]",
+			description: "Post one of your favorite GIFs, or list or remove them",
+			postsGifs:   true,
+			execute:     (*Plugin).executeCommandFavorite,
+			suggest:     (*Plugin).suggestFavoriteArguments,
+		},
+		{
+			name:        commandHistory,
+			hint:        "[number]",
+			description: "List the GIFs you posted recently, or post one of them again",
+			postsGifs:   true,
+			execute:     (*Plugin).executeCommandHistory,
+			suggest:     (*Plugin).suggestHistoryArguments,
+		},
+		{
+			name:        commandAlias,
+			hint:        "[add|remove|list]",
+			description: "Manage the GIF aliases of the team",
+			execute:     (*Plugin).executeCommandAlias,
+			suggest:     (*Plugin).suggestAliasArguments,
+		},
+		{
+			name:        commandTrending,
+			hint:        "\"[caption]\"",
+			description: "Post one of the GIFs currently trending",
+			postsGifs:   true,
+			execute:     (*Plugin).executeCommandTrending,
+		},
+		{
+			name:        commandSettings,
+			hint:        "[channel|team] [setting] [value]",
+			description: "Show or change the GIF settings of the channel or of the team",
+			execute:     (*Plugin).executeCommandSettings,
+			suggest:     (*Plugin).suggestSettingsArguments,
+		},
+		{
+			name:        commandPreferences,
+			hint:        "[preference] [value]",
+			description: "Show or change your GIF preferences",
+			execute:     (*Plugin).executeCommandPreferences,
+			suggest:     (*Plugin).suggestPreferencesArguments,
+		},
+		{
+			name:        commandAudit,
+			hint:        "[days] [@username]",
+			description: "Show the GIFs posted recently, and export them (system administrators only)",
+			execute:     (*Plugin).executeCommandAudit,
+		},
+		{
+			name:        commandHelp,
+			description: "Show how to use the GIF commands",
+			execute:     (*Plugin).executeCommandHelp,
+		},
+	}
+}
+
+// findSubcommand returns the subcommand that the command line starts with, and its arguments
+func findSubcommand(commandLine, trigger string) (*subcommand, string, bool) {
+	for _, subcommand := range getSubcommands() {
+		if arguments, ok := getSubcommandArguments(commandLine, trigger, subcommand.name); ok {
+			return &subcommand, arguments, true
+		}
+	}
+	return nil, "", false
+}
+
+// checkSubcommandAllowed returns a message explaining why the subcommand can't be used in the channel right now,
+// or an empty string if it can
+func (p *Plugin) checkSubcommandAllowed(subcommand *subcommand, args *model.CommandArgs) string {
+	if !subcommand.postsGifs {
+		return ""
+	}
+	return p.checkGifsAllowed(args.TeamId, args.ChannelId)
+}
+
+// getSubcommand returns the subcommand with the name, or nil if there is none
+func getSubcommand(name string) *subcommand {
+	for _, subcommand := range getSubcommands() {
+		if subcommand.name == name {
+			return &subcommand
+		}
+	}
+	return nil
+}
+
+// getSubcommandArguments returns the rest of the command line if it starts with the given subcommand.
+// A quoted name, like /gif "history", is not a subcommand: it is searched.
+func getSubcommandArguments(commandLine, trigger, subcommand string) (string, bool) {
+	arguments := strings.TrimSpace(strings.TrimPrefix(commandLine, "/"+trigger))
+	if arguments != subcommand && !strings.HasPrefix(arguments, subcommand+" ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(arguments, subcommand)), true
+}
+
+// getAutocompleteData describes the GIF command for the autocompletion. As a command can't have both
+// arguments and subcommands, the subcommands and the keywords are all suggested by the same dynamic list.
+func getAutocompleteData(trigger, description string) *model.AutocompleteData {
+	data := model.NewAutocompleteData(trigger, getHintMessage(trigger), description)
+	for i := 0; i < autocompleteArgumentCount; i++ {
+		data.AddDynamicListArgument("Keywords of the search, or a subcommand", URLAutocomplete, false)
+	}
+	return data
+}
+
+func (p *Plugin) executeCommandHelp(_ string, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	config := p.getConfiguration()
+	lines := []string{}
+	if config.CommandTriggerGif != "" {
+		lines = append(lines, fmt.Sprintf("- `/%s %s`: post a GIF matching your search", config.CommandTriggerGif, getHintMessage(config.CommandTriggerGif)))
+	}
+	if config.CommandTriggerGifWithPreview != "" {
+		lines = append(lines, fmt.Sprintf("- `/%s %s`: preview and shuffle GIFs matching your search before posting one", config.CommandTriggerGifWithPreview, getHintMessage(config.CommandTriggerGifWithPreview)))
+	}
+	for _, mediaType := range p.getOtherMediaTypes(config) {
+		lines = append(lines, fmt.Sprintf("- `/%s %s%s [happy kitty]`: search for %ss instead of GIFs", triggerGif, mediaTypeFlagPrefix, mediaType, mediaType))
+	}
+	lines = append(lines, fmt.Sprintf("- `/%s [happy kitty] \"[caption]\" %s \"[description]\"`: describe the GIF for the users who can't see it", triggerGif, altTextOption))
+	aliasHelp := fmt.Sprintf("- `/%s :name:`: post the GIF of a team alias", triggerGif)
+	if config.CommandTriggerGifWithPreview != "" {
+		aliasHelp += fmt.Sprintf(", or preview it with `/%s :name:`", config.CommandTriggerGifWithPreview)
+	}
+	lines = append(lines, aliasHelp)
+	names := []string{}
+	for _, subcommand := range getSubcommands() {
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("- `/%s %s %s`", triggerGif, subcommand.name, subcommand.hint))+": "+strings.ToLower(subcommand.description[:1])+subcommand.description[1:])
+		names = append(names, subcommand.name)
+	}
+	lines = append(lines, fmt.Sprintf("- `/%s \"%s\"`: search for the name of a subcommand (%s) by quoting it", triggerGif, commandHistory, strings.Join(names, ", ")))
+	return p.sendEphemeralBotMessage(args, strings.Join(lines, "\n"))
+}
+
+// Return the suggestions for the argument being typed: subcommands, aliases or search keywords for the first argument,
+// then the arguments of the subcommand or the rest of the search keywords
+func (p *Plugin) handleAutocomplete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	request := &autocompleteRequest{
+		userID:    r.Header.Get("Mattermost-User-Id"),
+		teamID:    query.Get("team_id"),
+		channelID: query.Get("channel_id"),
+		userInput: query.Get("user_input"),
+	}
+	// The parsed part of the command line starts with the trigger
+	parsed := strings.Fields(query.Get("parsed"))
+	if len(parsed) > 0 {
+		parsed = parsed[1:]
+	}
+
+	items := []model.AutocompleteListItem{}
+	if len(parsed) > 0 && strings.HasPrefix(parsed[0], mediaTypeFlagPrefix) {
+		// Only keywords can follow the media type option
+		typedKeywords := strings.Join(parsed[1:], " ")
+		if typedKeywords != "" {
+			items = p.suggestKeywords(request, typedKeywords+" ")
+		} else if strings.TrimSpace(request.userInput) != "" {
+			items = p.suggestKeywords(request, "")
+		}
+	} else if len(parsed) == 0 {
+		items = p.suggestFirstArgument(request)
+	} else if subcommand := getSubcommand(parsed[0]); subcommand != nil {
+		request.arguments = parsed[1:]
+		if subcommand.suggest != nil {
+			items = subcommand.suggest(p, request)
+		}
+	} else if !strings.HasPrefix(parsed[0], ":") {
+		items = p.suggestKeywords(request, strings.Join(parsed, " ")+" ")
+	}
+	writeAutocompleteItems(p, w, filterAutocompleteItems(items, request.userInput))
+}
+
+func (p *Plugin) suggestFirstArgument(request *autocompleteRequest) []model.AutocompleteListItem {
+	if strings.HasPrefix(request.userInput, ":") {
+		return p.suggestAliases(request)
+	}
+	if strings.HasPrefix(request.userInput, "-") {
+		return p.suggestMediaTypeFlags(request)
+	}
+
+	items := []model.AutocompleteListItem{}
+	for _, subcommand := range getSubcommands() {
+		items = append(items, model.AutocompleteListItem{Item: subcommand.name, Hint: subcommand.hint, HelpText: subcommand.description})
+	}
+	if strings.TrimSpace(request.userInput) != "" {
+		items = append(items, p.suggestKeywords(request, "")...)
+	}
+	return items
+}
+
+// suggestMediaTypeFlags returns the options to search for the other media types allowed on the server and supported by the GIF provider
+func (p *Plugin) suggestMediaTypeFlags(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	for _, mediaType := range p.getOtherMediaTypes(p.getUserConfiguration(request.userID, request.teamID, request.channelID)) {
+		items = append(items, model.AutocompleteListItem{Item: mediaTypeFlagPrefix + string(mediaType), Hint: "[happy kitty]", HelpText: "Search for " + string(mediaType) + "s instead of GIFs"})
+	}
+	return items
+}
+
+// suggestKeywords returns the rest of the search keywords suggested by the provider, after the keywords already typed
+func (p *Plugin) suggestKeywords(request *autocompleteRequest, typedKeywords string) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	gifProvider := p.getGifProvider(p.getUserConfiguration(request.userID, request.teamID, request.channelID))
+	suggestions, err := provider.GetSearchSuggestions(gifProvider, typedKeywords+request.userInput)
+	if err != nil {
+		// The suggestions are only a convenience: the search can still be typed without them
+		p.API.LogDebug("Unable to get search suggestions from the GIF provider", "error", err.Error())
+		return items
+	}
+	for _, suggestion := range suggestions {
+		if len(suggestion) > len(typedKeywords) && strings.HasPrefix(strings.ToLower(suggestion), strings.ToLower(typedKeywords)) {
+			items = append(items, model.AutocompleteListItem{Item: suggestion[len(typedKeywords):], HelpText: "Search GIFs for '" + suggestion + "'"})
+		}
+	}
+	return items
+}
+
+// Return the subcommands of the /gif fav subcommand and the favorites of the user
+func (p *Plugin) suggestFavoriteArguments(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	switch {
+	case len(request.arguments) == 0:
+		items = append(items,
+			model.AutocompleteListItem{Item: commandFavoriteList, HelpText: "List your favorite GIFs"},
+			model.AutocompleteListItem{Item: commandFavoriteRemove, Hint: "[name]", HelpText: "Remove a favorite GIF"},
+		)
+	case len(request.arguments) == 1 && request.arguments[0] == commandFavoriteRemove:
+		// Only the favorites can be suggested
+	default:
+		return items
+	}
+
+	favorites, err := p.getFavorites(request.userID)
+	if err != nil {
+		p.API.LogWarn("Unable to load the favorites for the autocompletion", "error", err.Error())
+	}
+	for _, favorite := range favorites {
+		items = append(items, model.AutocompleteListItem{Item: favorite.Name, HelpText: favorite.Keywords})
+	}
+	return items
+}
+
+// Return the numbers of the GIFs of the history of the user
+func (p *Plugin) suggestHistoryArguments(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	if len(request.arguments) > 0 {
+		return items
+	}
+	history, err := p.getHistory(request.userID)
+	if err != nil {
+		p.API.LogWarn("Unable to load the history for the autocompletion", "error", err.Error())
+	}
+	for i, entry := range history {
+		items = append(items, model.AutocompleteListItem{Item: strconv.Itoa(i + 1), HelpText: entry.Keywords})
+	}
+	return items
+}
+
+// Return the scopes, the names and the values of the settings of the /gif settings subcommand
+func (p *Plugin) suggestSettingsArguments(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	switch len(request.arguments) {
+	case 0:
+		items = append(items,
+			model.AutocompleteListItem{Item: settingsScopeChannel, Hint: "[setting] [value]", HelpText: "Change a GIF setting of the channel"},
+			model.AutocompleteListItem{Item: settingsScopeTeam, Hint: "[setting] [value]", HelpText: "Change a GIF setting of the team"},
+		)
+	case 1:
+		for _, setting := range getOverridableSettings() {
+			if setting.teamOnly && request.arguments[0] != settingsScopeTeam {
+				continue
+			}
+			items = append(items, model.AutocompleteListItem{Item: setting.name, Hint: "[value]", HelpText: setting.description})
+		}
+	case 2:
+		if setting := getOverridableSetting(request.arguments[1]); setting != nil {
+			for _, value := range append(setting.values(), settingsValueDefault) {
+				items = append(items, model.AutocompleteListItem{Item: value})
+			}
+		}
+	}
+	return items
+}
+
+// Return the names and the values of the preferences of the /gif prefs subcommand
+func (p *Plugin) suggestPreferencesArguments(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	switch len(request.arguments) {
+	case 0:
+		for _, setting := range getPreferenceSettings() {
+			items = append(items, model.AutocompleteListItem{Item: setting.name, Hint: "[value]", HelpText: setting.description})
+		}
+	case 1:
+		if setting := getPreferenceSetting(request.arguments[0]); setting != nil {
+			for _, value := range append(setting.values(), settingsValueDefault) {
+				items = append(items, model.AutocompleteListItem{Item: value})
+			}
+		}
+	}
+	return items
+}
+
+// Return the subcommands of the /gif alias subcommand, or the aliases of the team to remove
+func (p *Plugin) suggestAliasArguments(request *autocompleteRequest) []model.AutocompleteListItem {
+	switch {
+	case len(request.arguments) == 0:
+		return []model.AutocompleteListItem{
+			{Item: commandAliasAdd, Hint: ":name: <GIF URL> \"[caption]\"", HelpText: "Add or replace a GIF alias (team administrators only)"},
+			{Item: commandAliasRemove, Hint: ":name:", HelpText: "Remove a GIF alias (team administrators only)"},
+			{Item: commandAliasList, HelpText: "List the GIF aliases of the team"},
+		}
+	case len(request.arguments) == 1 && request.arguments[0] == commandAliasRemove:
+		return p.suggestAliases(request)
+	default:
+		return []model.AutocompleteListItem{}
+	}
+}
+
+// Return the aliases of the team, if the user is a member of the team
+func (p *Plugin) suggestAliases(request *autocompleteRequest) []model.AutocompleteListItem {
+	items := []model.AutocompleteListItem{}
+	if !p.API.HasPermissionToTeam(request.userID, request.teamID, model.PermissionViewTeam) {
+		return items
+	}
+	aliases, err := p.getAliases(request.teamID)
+	if err != nil {
+		p.API.LogWarn("Unable to load the aliases for the autocompletion", "error", err.Error())
+	}
+	for _, alias := range aliases {
+		items = append(items, model.AutocompleteListItem{Item: ":" + alias.Name + ":", HelpText: alias.Caption})
+	}
+	return items
+}
+
+// filterAutocompleteItems returns the items starting with the user input, ignoring case
+func filterAutocompleteItems(items []model.AutocompleteListItem, userInput string) []model.AutocompleteListItem {
+	userInput = strings.ToLower(strings.TrimSpace(userInput))
+	filtered := []model.AutocompleteListItem{}
+	for _, item := range items {
+		if strings.HasPrefix(strings.ToLower(item.Item), userInput) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+func writeAutocompleteItems(p *Plugin, w http.ResponseWriter, items []model.AutocompleteListItem) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		p.API.LogWarn("Could not write the autocomplete suggestions", "error", err.Error())
+	}
+}
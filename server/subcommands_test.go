@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	provider "github.com/moussetc/mattermost-plugin-giphy/server/internal/provider"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+func TestGetSubcommandArguments(t *testing.T) {
+	testCases := []struct {
+		command           string
+		expectedOK        bool
+		expectedArguments string
+	}{
+		{command: "/gif fav", expectedOK: true, expectedArguments: ""},
+		{command: "/gif fav  happy kitty ", expectedOK: true, expectedArguments: "happy kitty"},
+		{command: "/gif favorite kitty", expectedOK: false, expectedArguments: ""},
+		{command: "/gif kitty fav", expectedOK: false, expectedArguments: ""},
+	}
+	for _, testCase := range testCases {
+		arguments, ok := getSubcommandArguments(testCase.command, triggerGif, commandFavorite)
+		assert.Equal(t, testCase.expectedOK, ok, testCase.command)
+		assert.Equal(t, testCase.expectedArguments, arguments, testCase.command)
+	}
+}
+
+func TestFindSubcommand(t *testing.T) {
+	subcommand, arguments, ok := findSubcommand("/gifs alias add :shipit: url", triggerGifs)
+	assert.True(t, ok)
+	assert.Equal(t, commandAlias, subcommand.name)
+	assert.Equal(t, "add :shipit: url", arguments)
+
+	_, _, ok = findSubcommand("/gif happy kitty", triggerGif)
+	assert.False(t, ok)
+
+	_, _, ok = findSubcommand("/gif \"history\" \"caption\"", triggerGif)
+	assert.False(t, ok)
+}
+
+func TestExecuteCommandShouldSearchQuotedSubcommandName(t *testing.T) {
+	_, p, _ := initTestPlugin()
+	p.gifProvider = &mockGifProvider{testGifURL}
+
+	response, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif \"history\"", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	assert.Equal(t, model.CommandResponseTypeInChannel, response.ResponseType)
+	assert.Contains(t, response.Text, "history")
+	assert.Contains(t, response.Text, testGifURL)
+}
+
+func TestGetAutocompleteDataShouldBeValid(t *testing.T) {
+	for _, trigger := range []string{triggerGif, triggerGifs} {
+		data := getAutocompleteData(trigger, "description")
+		assert.Nil(t, data.IsValid(), trigger)
+		assert.Equal(t, trigger, data.Trigger)
+		assert.Len(t, data.Arguments, autocompleteArgumentCount)
+	}
+}
+
+func TestExecuteCommandHelpShouldDescribeAllSubcommands(t *testing.T) {
+	_, p, _, message := initFavoritesTest(t, []favorite{})
+
+	_, err := p.ExecuteCommand(nil, &model.CommandArgs{Command: "/gif help", UserId: testUserID, ChannelId: testChannelID})
+	assert.Nil(t, err)
+	for _, subcommand := range getSubcommands() {
+		assert.Contains(t, *message, "/gif "+subcommand.name)
+	}
+	assert.Contains(t, *message, "/gif \"history\"")
+}
+
+// suggestionGifProvider suggests keywords starting with the query
+type suggestionGifProvider struct {
+	mockGifProvider
+	suggestions []string
+	lastQuery   string
+}
+
+func (m *suggestionGifProvider) GetSearchSuggestions(query string) ([]string, *model.AppError) {
+	m.lastQuery = query
+	return m.suggestions, nil
+}
+
+// stickerGifProvider suggests keywords, and can search for stickers but not for clips
+type stickerGifProvider struct {
+	suggestionGifProvider
+}
+
+func (m *stickerGifProvider) SupportsMediaType(mediaType provider.MediaType) bool {
+	return mediaType != provider.MediaTypeClip
+}
+
+func requestAutocomplete(p *Plugin, parsed, userInput string) []model.AutocompleteListItem {
+	query := url.Values{}
+	query.Add("parsed", parsed)
+	query.Add("user_input", userInput)
+	query.Add("team_id", testTeamID)
+	r := httptest.NewRequest(http.MethodGet, URLAutocomplete+"?"+query.Encode(), nil)
+	r.Header.Add("Mattermost-User-Id", testUserID)
+	w := httptest.NewRecorder()
+	p.handleHTTPRequest(w, r)
+
+	items := []model.AutocompleteListItem{}
+	_ = json.NewDecoder(w.Result().Body).Decode(&items)
+	return items
+}
+
+func getAutocompleteItemNames(items []model.AutocompleteListItem) []string {
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.Item)
+	}
+	return names
+}
+
+func TestHandleAutocompleteShouldSuggestSubcommandsAndKeywords(t *testing.T) {
+	_, p := initMockAPI()
+	gifProvider := &suggestionGifProvider{suggestions: []string{"happy", "happy dance", "hello", "fun"}}
+	p.gifProvider = gifProvider
+
+	assert.Equal(t, []string{commandFavorite, commandHistory, commandAlias, commandTrending, commandSettings, commandPreferences, commandAudit, commandHelp}, getAutocompleteItemNames(requestAutocomplete(p, "/gif ", "")))
+	assert.Equal(t, []string{commandHistory, commandHelp, "happy", "happy dance", "hello"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif ", "h")))
+	assert.Equal(t, "h", gifProvider.lastQuery)
+}
+
+func TestHandleAutocompleteShouldSuggestTheRestOfTheKeywords(t *testing.T) {
+	_, p := initMockAPI()
+	gifProvider := &suggestionGifProvider{suggestions: []string{"happy", "happy dance", "happy dog", "dancing"}}
+	p.gifProvider = gifProvider
+
+	assert.Equal(t, []string{"dance"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif happy ", "da")))
+	assert.Equal(t, "happy da", gifProvider.lastQuery)
+}
+
+func TestHandleAutocompleteShouldIgnoreProvidersWithoutSuggestions(t *testing.T) {
+	_, p := initMockAPI()
+	p.gifProvider = newMockGifProvider()
+
+	assert.Equal(t, []string{commandFavorite}, getAutocompleteItemNames(requestAutocomplete(p, "/gif ", "fa")))
+	assert.Empty(t, requestAutocomplete(p, "/gif happy ", "da"))
+}
+
+func TestHandleAutocompleteShouldSuggestFavoriteArguments(t *testing.T) {
+	_, p, _, _ := initFavoritesTest(t, []favorite{testFavorite, {Name: "lol", URL: testGifURLNext}})
+
+	assert.Equal(t, []string{commandFavoriteList, commandFavoriteRemove, testKeywords, "lol"}, getAutocompleteItemNames(requestAutocomplete(p, "gif fav ", "")))
+	assert.Equal(t, []string{commandFavoriteList, "lol"}, getAutocompleteItemNames(requestAutocomplete(p, "gif fav ", "L")))
+	assert.Equal(t, []string{testKeywords, "lol"}, getAutocompleteItemNames(requestAutocomplete(p, "gif fav remove ", "")))
+	assert.Empty(t, requestAutocomplete(p, "gif fav lol ", ""))
+}
+
+func TestHandleAutocompleteShouldSuggestAliasesToTeamMembers(t *testing.T) {
+	api, p, _, _ := initAliasesTest(t, []alias{testAlias}, false)
+	api.On("HasPermissionToTeam", testUserID, testTeamID, model.PermissionViewTeam).Return(true)
+
+	assert.Equal(t, []string{commandAliasAdd, commandAliasRemove, commandAliasList}, getAutocompleteItemNames(requestAutocomplete(p, "gif alias ", "")))
+	assert.Equal(t, []string{":shipit:"}, getAutocompleteItemNames(requestAutocomplete(p, "gif alias remove ", ":s")))
+	assert.Equal(t, []string{":shipit:"}, getAutocompleteItemNames(requestAutocomplete(p, "gif ", ":")))
+}
+
+func TestHandleAutocompleteShouldNotSuggestAliasesOutsideOfTheTeam(t *testing.T) {
+	api, p, _, _ := initAliasesTest(t, []alias{testAlias}, false)
+	api.On("HasPermissionToTeam", testUserID, testTeamID, model.PermissionViewTeam).Return(false)
+
+	assert.Empty(t, requestAutocomplete(p, "gif alias remove ", ""))
+	assert.Empty(t, requestAutocomplete(p, "gif ", ":"))
+}
+
+func TestHandleAutocompleteShouldSuggestAllowedMediaTypeFlags(t *testing.T) {
+	_, p := initMockAPI()
+	p.configuration.AllowedMediaTypes = "gif,sticker,clip"
+	p.gifProvider = &stickerGifProvider{suggestionGifProvider{suggestions: []string{"party", "party hard"}}}
+
+	assert.Equal(t, []string{"--sticker"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif ", "-")))
+	assert.Equal(t, []string{"party", "party hard"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif --sticker ", "par")))
+	assert.Equal(t, []string{"hard"}, getAutocompleteItemNames(requestAutocomplete(p, "/gif --sticker party ", "")))
+
+	p.gifProvider = &suggestionGifProvider{}
+	assert.Empty(t, requestAutocomplete(p, "/gif ", "-"))
+}